@@ -0,0 +1,248 @@
+package attributes
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+
+	data "backend/api/v1/data"
+	structs "backend/api/v1/structs"
+)
+
+// maxEstimatedCost is the largest value estimated_cost, a NUMERIC(14,2),
+// can hold.
+const maxEstimatedCost = 999999999999.99
+
+var permitNumberPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9./-]{0,49}$`)
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func zoningOf(tags []structs.Tag) []string {
+	var zoning []string
+
+	for _, tag := range tags {
+		if tag.Classification == "Zoning" {
+			zoning = append(zoning, tag.Name)
+		}
+	}
+
+	return zoning
+}
+
+// Validate checks attributes against the Zoning tags of the revision they are
+// submitted with.
+func Validate(attributes *data.EntryAttributes, tags []structs.Tag) error {
+	if attributes == nil {
+		return nil
+	}
+
+	zoning := zoningOf(tags)
+
+	if len(attributes.PermitNumbers) > 20 {
+		return errors.New("At most 20 permit numbers can be attached")
+	}
+
+	for _, permitNumber := range attributes.PermitNumbers {
+		if !permitNumberPattern.MatchString(permitNumber) {
+			return fmt.Errorf("Invalid permit number %q", permitNumber)
+		}
+	}
+
+	if attributes.Developer != nil && len(*attributes.Developer) > 255 {
+		return errors.New("Developer must be at most 255 characters")
+	}
+
+	if attributes.ParcelID != nil && len(*attributes.ParcelID) > 50 {
+		return errors.New("Parcel ID must be at most 50 characters")
+	}
+
+	if attributes.Units != nil {
+		if !slices.Contains(zoning, "Multi Family") {
+			return errors.New("Units can only be set on Multi Family entries")
+		}
+
+		if *attributes.Units < 2 || *attributes.Units > 10000 {
+			return errors.New("Units must be between 2 and 10000")
+		}
+	}
+
+	if attributes.SquareFootage != nil && (*attributes.SquareFootage <= 0 || *attributes.SquareFootage > 50000000) {
+		return errors.New("Square footage must be between 1 and 50000000")
+	}
+
+	if attributes.EstimatedCost != nil && (*attributes.EstimatedCost < 0 || *attributes.EstimatedCost > maxEstimatedCost) {
+		return errors.New("Estimated cost must be between 0 and 999999999999.99")
+	}
+
+	if attributes.EstimatedCompletion != nil {
+		if _, err := time.Parse(time.DateOnly, *attributes.EstimatedCompletion); err != nil {
+			return errors.New("Estimated completion must be a YYYY-MM-DD date")
+		}
+	}
+
+	return nil
+}
+
+func Insert(tx *sql.Tx, entryRevisionId int, attributes *data.EntryAttributes) error {
+	if attributes == nil {
+		return nil
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO entry_revision_attributes (
+			entry_revision_id,
+			permit_numbers,
+			developer,
+			units,
+			square_footage,
+			parcel_id,
+			estimated_completion,
+			estimated_cost
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`,
+		entryRevisionId,
+		pq.Array(attributes.PermitNumbers),
+		attributes.Developer,
+		attributes.Units,
+		attributes.SquareFootage,
+		attributes.ParcelID,
+		attributes.EstimatedCompletion,
+		attributes.EstimatedCost,
+	)
+
+	return err
+}
+
+// RetrieveForEntryRevisions loads the attributes of several revisions at once.
+// Revisions without attributes are left out of the map.
+func RetrieveForEntryRevisions(db queryer, entryRevisionIds []int) (map[int]*data.EntryAttributes, error) {
+	result := make(map[int]*data.EntryAttributes)
+
+	if len(entryRevisionIds) == 0 {
+		return result, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT entry_revision_id,
+			permit_numbers,
+			developer,
+			units,
+			square_footage,
+			parcel_id,
+			to_char(estimated_completion, 'YYYY-MM-DD'),
+			estimated_cost::float8
+		FROM entry_revision_attributes
+		WHERE entry_revision_id = ANY($1)
+	`, pq.Array(entryRevisionIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entryRevisionId int
+		var attributes data.EntryAttributes
+
+		err := rows.Scan(
+			&entryRevisionId,
+			pq.Array(&attributes.PermitNumbers),
+			&attributes.Developer,
+			&attributes.Units,
+			&attributes.SquareFootage,
+			&attributes.ParcelID,
+			&attributes.EstimatedCompletion,
+			&attributes.EstimatedCost,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		result[entryRevisionId] = &attributes
+	}
+
+	return result, rows.Err()
+}
+
+func RetrieveForEntryRevision(db queryer, entryRevisionId int) (*data.EntryAttributes, error) {
+	result, err := RetrieveForEntryRevisions(db, []int{entryRevisionId})
+	if err != nil {
+		return nil, err
+	}
+
+	return result[entryRevisionId], nil
+}
+
+func stringValue(value *string) any {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func intValue(value *int) any {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func floatValue(value *float64) any {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// Diff lists the attributes that differ between two revisions. Either side
+// may be nil when a revision has no attributes.
+func Diff(from *data.EntryAttributes, to *data.EntryAttributes) []data.AttributeChange {
+	if from == nil {
+		from = &data.EntryAttributes{}
+	}
+	if to == nil {
+		to = &data.EntryAttributes{}
+	}
+
+	changes := []data.AttributeChange{}
+
+	if !slices.Equal(from.PermitNumbers, to.PermitNumbers) {
+		changes = append(changes, data.AttributeChange{
+			Field: "permit_numbers",
+			From:  from.PermitNumbers,
+			To:    to.PermitNumbers,
+		})
+	}
+
+	fields := []struct {
+		name string
+		from any
+		to   any
+	}{
+		{"developer", stringValue(from.Developer), stringValue(to.Developer)},
+		{"units", intValue(from.Units), intValue(to.Units)},
+		{"square_footage", intValue(from.SquareFootage), intValue(to.SquareFootage)},
+		{"parcel_id", stringValue(from.ParcelID), stringValue(to.ParcelID)},
+		{"estimated_completion", stringValue(from.EstimatedCompletion), stringValue(to.EstimatedCompletion)},
+		{"estimated_cost", floatValue(from.EstimatedCost), floatValue(to.EstimatedCost)},
+	}
+
+	for _, field := range fields {
+		if field.from != field.to {
+			changes = append(changes, data.AttributeChange{
+				Field: field.name,
+				From:  field.from,
+				To:    field.to,
+			})
+		}
+	}
+
+	return changes
+}
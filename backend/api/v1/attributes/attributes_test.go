@@ -0,0 +1,83 @@
+package attributes
+
+import (
+	"testing"
+
+	data "backend/api/v1/data"
+	structs "backend/api/v1/structs"
+)
+
+func TestValidateUnitsDependOnZoning(t *testing.T) {
+	units := 12
+	attrs := &data.EntryAttributes{Units: &units}
+
+	multiFamily := []structs.Tag{{Name: "Multi Family", Classification: "Zoning"}}
+	singleFamily := []structs.Tag{{Name: "Single Family", Classification: "Zoning"}}
+
+	if err := Validate(attrs, multiFamily); err != nil {
+		t.Fatalf("expected units to be valid on Multi Family, got %v", err)
+	}
+	if err := Validate(attrs, singleFamily); err == nil {
+		t.Fatalf("expected units to be rejected on Single Family")
+	}
+
+	units = 1
+	if err := Validate(attrs, multiFamily); err == nil {
+		t.Fatalf("expected a single unit to be rejected")
+	}
+}
+
+func TestValidateRejectsMalformedValues(t *testing.T) {
+	badDate := "03/14/2026"
+	negativeCost := -1.0
+	overflowingCost := 1e12
+
+	cases := map[string]*data.EntryAttributes{
+		"permit number":        {PermitNumbers: []string{"BP 2025;DROP"}},
+		"estimated completion": {EstimatedCompletion: &badDate},
+		"estimated cost":       {EstimatedCost: &negativeCost},
+		"overflowing cost":     {EstimatedCost: &overflowingCost},
+	}
+
+	for name, attrs := range cases {
+		if err := Validate(attrs, nil); err == nil {
+			t.Fatalf("expected invalid %s to be rejected", name)
+		}
+	}
+
+	if err := Validate(nil, nil); err != nil {
+		t.Fatalf("expected missing attributes to be valid, got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	developer := "Acme Homes"
+	otherDeveloper := "Acme Holdings"
+	units := 40
+
+	from := &data.EntryAttributes{
+		PermitNumbers: []string{"BP-2025-001"},
+		Developer:     &developer,
+	}
+	to := &data.EntryAttributes{
+		PermitNumbers: []string{"BP-2025-001"},
+		Developer:     &otherDeveloper,
+		Units:         &units,
+	}
+
+	changes := Diff(from, to)
+
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", changes)
+	}
+	if changes[0].Field != "developer" || changes[0].From != developer || changes[0].To != otherDeveloper {
+		t.Fatalf("unexpected developer change %+v", changes[0])
+	}
+	if changes[1].Field != "units" || changes[1].From != nil || changes[1].To != units {
+		t.Fatalf("unexpected units change %+v", changes[1])
+	}
+
+	if changes := Diff(nil, nil); len(changes) != 0 {
+		t.Fatalf("expected no changes between empty revisions, got %+v", changes)
+	}
+}
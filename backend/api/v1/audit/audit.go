@@ -0,0 +1,301 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+)
+
+// chainLockKey serialises writers to the audit log so every row is chained
+// to the one before it.
+const chainLockKey = 7_294_301
+
+const hashTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+var (
+	ErrBrokenLink = errors.New("Audit log entry does not follow the one before it")
+	ErrBadHash    = errors.New("Audit log entry does not match its hash")
+	ErrUnchained  = errors.New("Audit log entry is missing from the hash chain")
+)
+
+type txer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Event is one change to record. Before and After summarise the target on
+// either side of the change, Details holds anything else worth keeping, like
+// a moderator's reason.
+type Event struct {
+	ActorID    int
+	Action     string
+	TargetType string
+	TargetID   int
+	Before     any
+	After      any
+	Details    any
+}
+
+// record is an audit log row as it is hashed. The JSON columns are kept in
+// canonical form so the hash survives the round trip through JSONB.
+type record struct {
+	PrevHash    string          `json:"prev_hash"`
+	ActorID     *int            `json:"actor_id"`
+	Action      string          `json:"action"`
+	TargetType  string          `json:"target_type"`
+	TargetID    int             `json:"target_id"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	Details     json.RawMessage `json:"details"`
+	IPAddress   string          `json:"ip_address"`
+	UserAgent   string          `json:"user_agent"`
+	RequestID   string          `json:"request_id"`
+	DateCreated string          `json:"date_created"`
+}
+
+func (r record) hash() (string, error) {
+	encoded, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonical re-encodes JSON with sorted keys and no whitespace. Null and
+// empty documents become nil.
+func canonical(raw []byte) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(value)
+}
+
+func marshalCanonical(value any) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return canonical(raw)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Truncate(time.Microsecond).Format(hashTimeLayout)
+}
+
+// nullable turns the zero value into NULL for the database.
+func nullable[T comparable](value T) any {
+	var zero T
+	if value == zero {
+		return nil
+	}
+
+	return value
+}
+
+// RequestID tags each request with an id, reusing the caller's X-Request-ID
+// when it looks sane, so audit log rows can be tied back to access logs.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			buf := make([]byte, 16)
+			if _, err := rand.Read(buf); err == nil {
+				requestID = hex.EncodeToString(buf)
+			} else {
+				requestID = ""
+			}
+		}
+
+		if requestID != "" {
+			c.Set(requestIDKey, requestID)
+			c.Header(RequestIDHeader, requestID)
+		}
+
+		c.Next()
+	}
+}
+
+// Record appends an event to the audit log, chained to the previous row by
+// its hash. tx should be the transaction of the change being recorded so the
+// two commit together. c supplies the IP address, user agent and request id
+// and may be nil outside of a request.
+//
+// Chaining takes a lock that is held until tx ends, so audited writes commit
+// one at a time across the whole site. That is the price of a single chain;
+// to keep the window short, call Record as the last statement before Commit
+// and do nothing slow after it.
+func Record(tx txer, c *gin.Context, event Event) error {
+	r := record{
+		Action:      event.Action,
+		TargetType:  event.TargetType,
+		TargetID:    event.TargetID,
+		DateCreated: formatTime(time.Now()),
+	}
+
+	if event.ActorID != 0 {
+		actorID := event.ActorID
+		r.ActorID = &actorID
+	}
+
+	var err error
+
+	if r.Before, err = marshalCanonical(event.Before); err != nil {
+		return err
+	}
+	if r.After, err = marshalCanonical(event.After); err != nil {
+		return err
+	}
+	if r.Details, err = marshalCanonical(event.Details); err != nil {
+		return err
+	}
+
+	if c != nil {
+		r.IPAddress = c.ClientIP()
+		r.UserAgent = c.Request.UserAgent()
+		r.RequestID = c.GetString(requestIDKey)
+	}
+
+	// taken after everything that can be done without it, and held until tx
+	// ends so nobody else can chain onto the same row
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, chainLockKey); err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`
+		SELECT hash FROM audit_log
+		WHERE hash IS NOT NULL
+		ORDER BY id DESC
+		LIMIT 1
+	`).Scan(&r.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	hash, err := r.hash()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO audit_log (
+			actor_id, action, target_type, target_id,
+			before_state, after_state, details,
+			ip_address, user_agent, request_id,
+			date_created, prev_hash, hash
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`,
+		r.ActorID, r.Action, r.TargetType, r.TargetID,
+		nullableJSON(r.Before), nullableJSON(r.After), nullableJSON(r.Details),
+		nullable(r.IPAddress), nullable(r.UserAgent), nullable(r.RequestID),
+		r.DateCreated, nullable(r.PrevHash), hash,
+	)
+
+	return err
+}
+
+func nullableJSON(raw json.RawMessage) any {
+	if raw == nil {
+		return nil
+	}
+
+	return []byte(raw)
+}
+
+// verifier walks the audit log in id order. Rows from before the chain was
+// introduced have no hash; once the chain starts, every row has to link to
+// the one before it and match its own hash.
+type verifier struct {
+	prevHash string
+	started  bool
+	checked  int
+}
+
+func (v *verifier) check(r record, hash *string) error {
+	if hash == nil {
+		if v.started {
+			return ErrUnchained
+		}
+		return nil
+	}
+
+	if r.PrevHash != v.prevHash {
+		return ErrBrokenLink
+	}
+
+	expected, err := r.hash()
+	if err != nil {
+		return err
+	}
+
+	if expected != *hash {
+		return ErrBadHash
+	}
+
+	v.started = true
+	v.prevHash = *hash
+	v.checked++
+
+	return nil
+}
+
+// scanRecord rebuilds the hashed form of a row read back from the database.
+func scanRecord(
+	r *record,
+	before []byte,
+	after []byte,
+	details []byte,
+	dateCreated time.Time,
+) error {
+	var err error
+
+	if r.Before, err = canonical(before); err != nil {
+		return fmt.Errorf("before_state: %w", err)
+	}
+	if r.After, err = canonical(after); err != nil {
+		return fmt.Errorf("after_state: %w", err)
+	}
+	if r.Details, err = canonical(details); err != nil {
+		return fmt.Errorf("details: %w", err)
+	}
+
+	r.DateCreated = formatTime(dateCreated)
+
+	return nil
+}
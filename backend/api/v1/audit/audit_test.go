@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCanonicalSurvivesJSONB(t *testing.T) {
+	written, err := marshalCanonical(map[string]any{
+		"title":  "<Tower & Park>",
+		"tags":   []string{"b", "a"},
+		"count":  3,
+		"reason": nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// how PostgreSQL prints the same document back out of a JSONB column
+	read, err := canonical([]byte(`{"tags": ["b", "a"], "count": 3, "title": "<Tower & Park>", "reason": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(written) != string(read) {
+		t.Errorf("got %s back, wrote %s", read, written)
+	}
+
+	for _, empty := range []string{"", "null"} {
+		if raw, err := canonical([]byte(empty)); err != nil || raw != nil {
+			t.Errorf("canonical(%q) = %s, %v, want nil", empty, raw, err)
+		}
+	}
+}
+
+func chain(t *testing.T, actions ...string) ([]record, []string) {
+	t.Helper()
+
+	var records []record
+	var hashes []string
+	prevHash := ""
+
+	for i, action := range actions {
+		actorID := i + 1
+		r := record{
+			PrevHash:    prevHash,
+			ActorID:     &actorID,
+			Action:      action,
+			TargetType:  "entry",
+			TargetID:    10 + i,
+			After:       []byte(`{"title":"Tower"}`),
+			DateCreated: formatTime(time.Date(2026, 1, 2, 3, 4, 5, 678912345, time.UTC)),
+		}
+
+		hash, err := r.hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		records = append(records, r)
+		hashes = append(hashes, hash)
+		prevHash = hash
+	}
+
+	return records, hashes
+}
+
+func verify(records []record, hashes []*string) (int, error) {
+	var v verifier
+
+	for i, r := range records {
+		if err := v.check(r, hashes[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return -1, nil
+}
+
+func pointers(hashes []string) []*string {
+	ptrs := make([]*string, len(hashes))
+	for i := range hashes {
+		ptrs[i] = &hashes[i]
+	}
+	return ptrs
+}
+
+func TestVerifierAcceptsIntactChain(t *testing.T) {
+	records, hashes := chain(t, "entry.create", "entry.edit", "entry.vote")
+
+	// rows from before the chain have no hash
+	legacy := append([]record{{Action: "entry.merge"}}, records...)
+	legacyHashes := append([]*string{nil}, pointers(hashes)...)
+
+	if at, err := verify(legacy, legacyHashes); err != nil {
+		t.Errorf("row %d: %v", at, err)
+	}
+}
+
+func TestVerifierDetectsTampering(t *testing.T) {
+	records, hashes := chain(t, "entry.create", "entry.edit", "entry.vote")
+
+	edited := append([]record(nil), records...)
+	edited[1].After = []byte(`{"title":"Something else"}`)
+	if at, err := verify(edited, pointers(hashes)); err != ErrBadHash || at != 1 {
+		t.Errorf("edited row: got %v at %d", err, at)
+	}
+
+	removed := []record{records[0], records[2]}
+	if at, err := verify(removed, pointers([]string{hashes[0], hashes[2]})); err != ErrBrokenLink || at != 1 {
+		t.Errorf("removed row: got %v at %d", err, at)
+	}
+
+	unchained := []record{records[0], {Action: "entry.edit"}, records[1]}
+	if at, err := verify(unchained, []*string{&hashes[0], nil, &hashes[1]}); err != ErrUnchained || at != 1 {
+		t.Errorf("row without hash: got %v at %d", err, at)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RequestID())
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(requestIDKey))
+	})
+
+	tests := map[string]bool{
+		"abc-123":               true,
+		"":                      false,
+		"has spaces":            false,
+		"<script>":              false,
+		strings.Repeat("a", 65): false,
+	}
+
+	for header, kept := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set(RequestIDHeader, header)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		got := w.Header().Get(RequestIDHeader)
+		if got != w.Body.String() {
+			t.Errorf("header %q and context %q differ", got, w.Body.String())
+		}
+
+		if kept && got != header {
+			t.Errorf("%q was replaced with %q", header, got)
+		}
+		if !kept && (got == header || len(got) != 32) {
+			t.Errorf("%q should have been replaced, got %q", header, got)
+		}
+	}
+}
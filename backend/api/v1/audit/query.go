@@ -0,0 +1,206 @@
+package audit
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+)
+
+// RetrieveLog lists the audit log newest first, filtered by actor, action,
+// target, request id and date range.
+func RetrieveLog(c *gin.Context, db *sql.DB) {
+	var query data.AuditLogQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if query.Limit == 0 {
+		query.Limit = 50
+	}
+
+	rows, err := db.Query(`
+		SELECT a.id,
+			a.actor_id,
+			u.username,
+			a.action,
+			a.target_type,
+			a.target_id,
+			a.before_state,
+			a.after_state,
+			a.details,
+			a.ip_address,
+			a.user_agent,
+			a.request_id,
+			a.date_created,
+			a.hash,
+			COUNT(*) OVER ()
+		FROM audit_log a
+		LEFT JOIN users u ON u.id = a.actor_id
+		WHERE ($1 = 0 OR a.actor_id = $1)
+		AND ($2 = '' OR a.action = $2)
+		AND ($3 = '' OR a.target_type = $3)
+		AND ($4 = 0 OR a.target_id = $4)
+		AND ($5 = '' OR a.request_id = $5)
+		AND ($6 = '' OR a.date_created >= NULLIF($6, '')::date)
+		AND ($7 = '' OR a.date_created < NULLIF($7, '')::date + 1)
+		ORDER BY a.id DESC
+		LIMIT $8 OFFSET $9
+	`,
+		query.ActorID,
+		query.Action,
+		query.TargetType,
+		query.TargetID,
+		query.RequestID,
+		query.Since,
+		query.Until,
+		query.Limit,
+		query.Offset,
+	)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	page := data.AuditLogPage{
+		Entries: []data.AuditLogEntry{},
+		Limit:   query.Limit,
+		Offset:  query.Offset,
+	}
+
+	for rows.Next() {
+		var entry data.AuditLogEntry
+		var before, after, details []byte
+		var dateCreated time.Time
+
+		err := rows.Scan(
+			&entry.ID,
+			&entry.ActorID,
+			&entry.ActorUsername,
+			&entry.Action,
+			&entry.TargetType,
+			&entry.TargetID,
+			&before,
+			&after,
+			&details,
+			&entry.IPAddress,
+			&entry.UserAgent,
+			&entry.RequestID,
+			&dateCreated,
+			&entry.Hash,
+			&page.Total,
+		)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		entry.Before = before
+		entry.After = after
+		entry.Details = details
+		entry.DateCreated = dateCreated.Format(time.RFC3339)
+
+		page.Entries = append(page.Entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// VerifyLog recomputes the hash chain and reports the first row that was
+// altered, removed from under its successor or slipped in without a hash.
+func VerifyLog(c *gin.Context, db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT id,
+			actor_id,
+			action,
+			target_type,
+			target_id,
+			before_state,
+			after_state,
+			details,
+			COALESCE(ip_address, ''),
+			COALESCE(user_agent, ''),
+			COALESCE(request_id, ''),
+			date_created,
+			COALESCE(prev_hash, ''),
+			hash
+		FROM audit_log
+		ORDER BY id
+	`)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	var v verifier
+
+	for rows.Next() {
+		var id int
+		var r record
+		var before, after, details []byte
+		var dateCreated time.Time
+		var hash *string
+
+		err := rows.Scan(
+			&id,
+			&r.ActorID,
+			&r.Action,
+			&r.TargetType,
+			&r.TargetID,
+			&before,
+			&after,
+			&details,
+			&r.IPAddress,
+			&r.UserAgent,
+			&r.RequestID,
+			&dateCreated,
+			&r.PrevHash,
+			&hash,
+		)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		if err := scanRecord(&r, before, after, details, dateCreated); err != nil {
+			c.JSON(http.StatusOK, data.AuditVerification{
+				Checked:  v.checked,
+				BrokenAt: &id,
+				Problem:  err.Error(),
+			})
+			return
+		}
+
+		if err := v.check(r, hash); err != nil {
+			c.JSON(http.StatusOK, data.AuditVerification{
+				Checked:  v.checked,
+				BrokenAt: &id,
+				Problem:  err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, data.AuditVerification{
+		Valid:   true,
+		Checked: v.checked,
+	})
+}
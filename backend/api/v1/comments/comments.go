@@ -1,20 +1,37 @@
-package v1
+package comments
 
 import (
-	utils "backend/api/v1/utils"
 	"database/sql"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
 
-	"github.com/golang-jwt/jwt/v5"
+	audit "backend/api/v1/audit"
+	contributors "backend/api/v1/contributors"
+	markdown "backend/api/v1/markdown"
+	messages "backend/api/v1/messages"
+	notifications "backend/api/v1/notifications"
+	utils "backend/api/v1/utils"
 )
 
 type CommentRequest struct {
-	EntryID  int    `json:"entry_id"`
+	EntryID  int    `json:"entry_id" binding:"required"`
 	ParentID *int   `json:"parent_id,omitempty"`
-	Context  string `json:"context"`
-	Type     string `json:"classification"`
+	Context  string `json:"context" binding:"required"`
+	Type     string `json:"classification" binding:"required,oneof=opinion source update"`
+}
+
+type InteractionRequest struct {
+	CommentID       int    `json:"comment_id" binding:"required"`
+	InteractionType string `json:"interaction_type" binding:"required"`
+}
+
+type VoteResponse struct {
+	Upvotes         int    `json:"upvotes"`
+	Downvotes       int    `json:"downvotes"`
+	UserInteraction string `json:"user_interaction"`
 }
 
 type Comment struct {
@@ -23,104 +40,151 @@ type Comment struct {
 	EntryID                   int    `json:"entry_id"`
 	ParentID                  *int   `json:"parent_id,omitempty"`
 	Context                   string `json:"context"`
+	ContextHTML               string `json:"context_html"`
 	Type                      string `json:"type"`
 	Username                  string `json:"username,omitempty"`
 	NumOfReplies              int    `json:"num_of_replies"`
 	NumberOfUpvotes           int    `json:"num_of_upvotes"`
 	NumberOfDownvotes         int    `json:"num_of_downvotes"`
 	CurrentCommentInteraction string `json:"current_comment_interaction,omitempty"`
+	Hidden                    bool   `json:"hidden,omitempty"`
 }
 
-func AddComment(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	username, err := utils.VerifyTokenAndReturnUsername(r)
-
+// viewer returns the id and role of the signed in user, or 0 and "" for
+// anonymous readers.
+func viewer(c *gin.Context, db *sql.DB) (int, string) {
+	userID, role, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
 	if err != nil {
-		fmt.Println("Invalid Token, err: ", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return 0, ""
 	}
 
-	var userID int
-
-	err = db.QueryRow("SELECT id FROM users WHERE username=$1", username).Scan(&userID)
+	return userID, role
+}
 
+func AddComment(c *gin.Context, db *sql.DB) {
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		messages.StatusUnauthorized(c, err)
 		return
 	}
 
 	var req CommentRequest
-	var comment Comment
 
-	err = json.NewDecoder(r.Body).Decode(&req)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
 
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if len(req.Context) > markdown.MaxSourceLength {
+		messages.StatusBadRequest(c, errors.New("Comment is too long"))
 		return
 	}
 
-	if req.EntryID == -1 || req.Context == "" || req.Type == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	// a reply has to stay in its parent's thread
+	if req.ParentID != nil {
+		var parentEntryID int
+
+		err := db.QueryRow(`
+			SELECT entry_id FROM conversation WHERE id = $1
+		`, *req.ParentID).Scan(&parentEntryID)
+		if err == sql.ErrNoRows {
+			messages.StatusNotFound(c, errors.New("Parent comment not found"))
+			return
+		}
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		if parentEntryID != req.EntryID {
+			messages.StatusBadRequest(c, errors.New("A reply must be on the same entry as its parent"))
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
 		return
 	}
+	defer tx.Rollback()
 
-	err = db.QueryRow(
-		`INSERT INTO conversation (user_id, entry_id, parent_id, context, type)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, user_id, entry_id, parent_id, context, type`,
-		userID, req.EntryID, req.ParentID, req.Context, req.Type,
-	).Scan(&comment.ID, &comment.UserID, &comment.EntryID, &comment.ParentID, &comment.Context, &comment.Type)
+	var comment Comment
 
+	err = tx.QueryRow(`
+		INSERT INTO conversation (user_id, entry_id, parent_id, context, type)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, user_id, entry_id, parent_id, context, type,
+			(SELECT username FROM users WHERE id = $1)
+	`, userID, req.EntryID, req.ParentID, req.Context, req.Type).Scan(
+		&comment.ID,
+		&comment.UserID,
+		&comment.EntryID,
+		&comment.ParentID,
+		&comment.Context,
+		&comment.Type,
+		&comment.Username,
+	)
 	if err != nil {
-		http.Error(w, "Failed to add comment", http.StatusInternalServerError)
+		messages.InternalServerError(c, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	comment.Username = username
+	if contributors.CountsTowardsContribution(comment.Type) {
+		if err := contributors.Record(tx, comment.EntryID, userID); err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(comment)
-}
+	err = notifications.Notify(tx, comment.EntryID, userID, notifications.TypeComment, gin.H{
+		"comment_id": comment.ID,
+		"type":       comment.Type,
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
 
-func GetEntryComments(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	entryID := r.URL.Query().Get("entry_id")
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "comment.create",
+		TargetType: "comment",
+		TargetID:   comment.ID,
+		After: gin.H{
+			"entry_id":  comment.EntryID,
+			"parent_id": comment.ParentID,
+			"type":      comment.Type,
+		},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
 
-	if entryID == "" {
-		http.Error(w, "Missing entry_id parameter", http.StatusBadRequest)
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
 		return
 	}
 
-	rows, err := db.Query(`
-		SELECT 
-			c.id, 
-			c.user_id, 
-			(SELECT u.username FROM users u WHERE u.id = c.user_id) AS username,
-			c.entry_id, 
-			c.parent_id, 
-			c.context, 
-			c.type
-		FROM conversation c
-		WHERE c.entry_id = $1 AND c.parent_id IS NULL
-	`, entryID)
+	comment.ContextHTML = markdown.Render(comment.Context)
+
+	c.JSON(http.StatusCreated, comment)
+}
 
+func retrieveComments(c *gin.Context, db *sql.DB, query string, arg int) ([]Comment, error) {
+	rows, err := db.Query(query, arg)
 	if err != nil {
-		print(err)
-		http.Error(w, "Failed to retrieve comments", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
-	var comments []Comment
-
-	var commentCount int
+	comments := []Comment{}
 
 	for rows.Next() {
 		var comment Comment
-		var currentInteractionType string
-		var upvotes, downvotes int
 
-		err = rows.Scan(
+		err := rows.Scan(
 			&comment.ID,
 			&comment.UserID,
 			&comment.Username,
@@ -128,228 +192,221 @@ func GetEntryComments(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 			&comment.ParentID,
 			&comment.Context,
 			&comment.Type,
+			&comment.NumOfReplies,
+			&comment.Hidden,
 		)
-
 		if err != nil {
-			fmt.Println(err)
-			http.Error(w, "Failed to scan comment", http.StatusInternalServerError)
-			return
+			return nil, err
 		}
 
-		err = db.QueryRow(`
-			SELECT COUNT(*)
-			FROM conversation c
-			WHERE c.parent_id = $1
-		`, comment.ID).Scan(&commentCount)
+		comments = append(comments, comment)
+	}
 
-		if err != nil {
-			comment.NumOfReplies = 0
-		}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		err = db.QueryRow(`
-			SELECT interaction_type
-			FROM conversation_interactions
-			WHERE user_id = $1 AND conversation_id = $2
-		`, comment.UserID, comment.ID).Scan(&currentInteractionType)
+	userID, role := viewer(c, db)
 
-		if err != nil && err != sql.ErrNoRows {
-			fmt.Println(err)
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+	// Hidden comments keep their place in the thread so replies still make
+	// sense, only moderators see what they said.
+	for i := range comments {
+		if comments[i].Hidden && !utils.IsModerator(role) {
+			comments[i].Context = ""
 		}
 
-		upvotes, downvotes = utils.RetrieveNumberOfUpvotesAndDownvotesForTable("conversation", comment.ID, db)
-
-		fmt.Println(upvotes, downvotes)
-
-		comment.CurrentCommentInteraction = currentInteractionType
+		comments[i].ContextHTML = markdown.Render(comments[i].Context)
+	}
 
-		comment.NumOfReplies = commentCount
-		comment.NumberOfUpvotes = upvotes
-		comment.NumberOfDownvotes = downvotes
+	for i := range comments {
+		comments[i].NumberOfUpvotes, comments[i].NumberOfDownvotes = utils.RetrieveNumberOfUpvotesAndDownvotesForTable(
+			"conversation",
+			comments[i].ID,
+			db,
+		)
 
-		comments = append(comments, comment)
+		if userID != 0 {
+			comments[i].CurrentCommentInteraction = utils.RetrieveCurrentInteractionTypeForTable(
+				"conversation",
+				userID,
+				comments[i].ID,
+				db,
+			)
+		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(comments)
+	return comments, nil
 }
 
-func GetCommentReplies(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	commentID := r.URL.Query().Get("comment_id")
-	entryID := r.URL.Query().Get("entry_id")
+func GetEntryComments(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Query("entry_id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Missing entry_id parameter"))
+		return
+	}
 
-	if commentID == "" {
-		http.Error(w, "Missing comment_id parameter", http.StatusBadRequest)
+	visible, err := utils.EntryVisible(c, db, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
 		return
 	}
 
-	if entryID == "" {
-		http.Error(w, "Missing entry_id parameter", http.StatusBadRequest)
+	if !visible {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
 		return
 	}
 
-	rows, err := db.Query(`
-		SELECT 
-			c.id, 
-			c.user_id, 
-			(SELECT u.username FROM users u WHERE u.id = c.user_id) AS username,
-			c.entry_id, 
+	comments, err := retrieveComments(c, db, `
+		SELECT c.id,
+			COALESCE(c.user_id, 0),
+			COALESCE(u.username, ''),
+			c.entry_id,
 			c.parent_id,
-			c.context, 
-			c.type
+			c.context,
+			c.type,
+			(SELECT COUNT(*) FROM conversation r WHERE r.parent_id = c.id),
+			c.hidden_at IS NOT NULL
 		FROM conversation c
-		WHERE c.parent_id = $1
-	`, commentID)
-
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.entry_id = $1 AND c.parent_id IS NULL
+		ORDER BY c.id
+	`, entryID)
 	if err != nil {
-		http.Error(w, "Failed to retrieve replies", http.StatusInternalServerError)
+		messages.InternalServerError(c, err)
 		return
 	}
-	defer rows.Close()
-
-	var replies []Comment
-	var replyCount int
-
-	for rows.Next() {
-		var reply Comment
-		var upvotes, downvotes int
-
-		err := rows.Scan(&reply.ID, &reply.UserID, &reply.Username, &reply.EntryID, &reply.ParentID, &reply.Context, &reply.Type)
-
-		if err != nil {
-			http.Error(w, "Failed to scan reply", http.StatusInternalServerError)
-			return
-		}
-
-		upvotes, downvotes = utils.RetrieveNumberOfUpvotesAndDownvotesForTable("conversation", reply.ID, db)
 
-		err = db.QueryRow(`
-			SELECT COUNT(*)
-			FROM conversation c
-			WHERE c.parent_id = $1
-		`, reply.ID).Scan(&replyCount)
-
-		if err != nil {
-			reply.NumOfReplies = 0
-		}
-
-		reply.NumOfReplies = replyCount
-		reply.NumberOfUpvotes = upvotes
-		reply.NumberOfDownvotes = downvotes
-		reply.CurrentCommentInteraction = utils.RetrieveCurrentInteractionTypeForTable(
-			"conversation",
-			reply.UserID,
-			reply.ID,
-			db,
-		)
-
-		replies = append(replies, reply)
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(replies)
+	c.JSON(http.StatusOK, comments)
 }
 
-func VoteOnComment(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	token, err := jwt.Parse(r.Header.Get("Authorization"), func(token *jwt.Token) (interface{}, error) {
-		return utils.JwtSecret, nil
-	})
-
-	if err != nil || !token.Valid {
-		fmt.Println("Invalid token:", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+func GetCommentReplies(c *gin.Context, db *sql.DB) {
+	commentID, err := strconv.Atoi(c.Query("comment_id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Missing comment_id parameter"))
+		return
 	}
 
-	claims := token.Claims.(jwt.MapClaims)
-
-	username := claims["username"].(string)
-
-	var userID int
+	var entryID int
 
 	err = db.QueryRow(`
-		SELECT id FROM users WHERE username = $1	
-	`, username).Scan(&userID)
+		SELECT entry_id FROM conversation WHERE id = $1
+	`, commentID).Scan(&entryID)
+	if err == sql.ErrNoRows {
+		messages.StatusNotFound(c, errors.New("Comment not found"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
 
+	visible, err := utils.EntryVisible(c, db, entryID)
 	if err != nil {
-		fmt.Println("DB query error:", err)
-		http.Error(w, "internal Server Error", http.StatusInternalServerError)
+		messages.InternalServerError(c, err)
 		return
 	}
 
-	type InteractionRequest struct {
-		CommentID       int    `json:"comment_id"`
-		InteractionType string `json:"interaction_type"`
+	if !visible {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
 	}
 
-	var req InteractionRequest
+	replies, err := retrieveComments(c, db, `
+		SELECT c.id,
+			COALESCE(c.user_id, 0),
+			COALESCE(u.username, ''),
+			c.entry_id,
+			c.parent_id,
+			c.context,
+			c.type,
+			(SELECT COUNT(*) FROM conversation r WHERE r.parent_id = c.id),
+			c.hidden_at IS NOT NULL
+		FROM conversation c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.parent_id = $1
+		ORDER BY c.id
+	`, commentID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
 
-	err = json.NewDecoder(r.Body).Decode(&req)
+	c.JSON(http.StatusOK, replies)
+}
 
+func VoteOnComment(c *gin.Context, db *sql.DB) {
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
 	if err != nil {
-		fmt.Println("Error decoding json", err)
-		http.Error(w, "internal server error", http.StatusBadRequest)
+		messages.StatusUnauthorized(c, err)
 		return
 	}
 
-	if req.CommentID == 0 || req.InteractionType == "" {
-		http.Error(w, "Comment ID and interaction type are required", http.StatusBadRequest)
+	var req InteractionRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		messages.StatusBadRequest(c, err)
 		return
 	}
 
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
 	var currentInteraction string
 
-	err = db.QueryRow(`
+	err = tx.QueryRow(`
 		SELECT interaction_type
 		FROM conversation_interactions
-		WHERE user_id = $1 and conversation_id = $2
+		WHERE user_id = $1 AND conversation_id = $2
 	`, userID, req.CommentID).Scan(&currentInteraction)
-
 	if err != nil && err != sql.ErrNoRows {
-		fmt.Println("DB query error:", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		messages.InternalServerError(c, err)
 		return
 	}
 
-	fmt.Printf("DEBUG currentInteraction='%s', req.InteractionType='%s'\n", currentInteraction, req.InteractionType)
+	newInteraction := req.InteractionType
 
 	if currentInteraction == req.InteractionType {
-		_, err = db.Exec(`
+		newInteraction = ""
+		_, err = tx.Exec(`
 			DELETE FROM conversation_interactions
 			WHERE user_id = $1 AND conversation_id = $2
 		`, userID, req.CommentID)
 	} else if currentInteraction != "" {
-		fmt.Println("here?")
-		_, err = db.Exec(`
+		_, err = tx.Exec(`
 			UPDATE conversation_interactions
 			SET interaction_type = $3, created_at = CURRENT_TIMESTAMP
 			WHERE user_id = $1 AND conversation_id = $2
 		`, userID, req.CommentID, req.InteractionType)
 	} else {
-		_, err = db.Exec(`
-			INSERT into conversation_interactions (conversation_id, user_id, interaction_type)
+		_, err = tx.Exec(`
+			INSERT INTO conversation_interactions (conversation_id, user_id, interaction_type)
 			VALUES ($1, $2, $3)
 		`, req.CommentID, userID, req.InteractionType)
 	}
-
 	if err != nil {
-		fmt.Println("DB exec error:", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		messages.InternalServerError(c, err)
 		return
 	}
 
-	var updatedInteractionType string
-
-	err = db.QueryRow(`
-		SELECT interaction_type
-		FROM conversation_interactions
-		WHERE user_id = $1 and conversation_id = $2
-	`, userID, req.CommentID).Scan(&updatedInteractionType)
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "comment.vote",
+		TargetType: "comment",
+		TargetID:   req.CommentID,
+		Before:     gin.H{"interaction": currentInteraction},
+		After:      gin.H{"interaction": newInteraction},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
 
-	if err == sql.ErrNoRows {
-		updatedInteractionType = ""
-	} else if err != nil {
-		fmt.Println("DB query error", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
 		return
 	}
 
@@ -359,28 +416,14 @@ func VoteOnComment(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		db,
 	)
 
-	w.Header().Set("Content-Type", "application/json")
-
-	type VoteResponse struct {
-		Upvotes         int    `json:"upvotes"`
-		Downvotes       int    `json:"downvotes"`
-		UserInteraction string `json:"user_interaction"`
-	}
-
-	response := VoteResponse{
-		Upvotes:         upvotes,
-		Downvotes:       downvotes,
-		UserInteraction: updatedInteractionType,
-	}
-
-	err = json.NewEncoder(w).Encode(response)
-
-	if err != nil {
-		fmt.Println("Error encoding response:", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	fmt.Println("Vote interaction processed successfully")
-
+	c.JSON(http.StatusOK, VoteResponse{
+		Upvotes:   upvotes,
+		Downvotes: downvotes,
+		UserInteraction: utils.RetrieveCurrentInteractionTypeForTable(
+			"conversation",
+			userID,
+			req.CommentID,
+			db,
+		),
+	})
 }
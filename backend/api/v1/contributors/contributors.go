@@ -0,0 +1,130 @@
+package contributors
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Record credits a user with one more contribution to an entry.
+func Record(tx execer, entryID int, userID int) error {
+	_, err := tx.Exec(`
+		INSERT INTO entry_contributors (entry_id, user_id, contribution_count, last_contributed_at)
+		VALUES ($1, $2, 1, now())
+		ON CONFLICT (user_id, entry_id) DO UPDATE
+		SET contribution_count = entry_contributors.contribution_count + 1,
+			last_contributed_at = now()
+	`, entryID, userID)
+
+	return err
+}
+
+// CountsTowardsContribution reports whether a comment of the given type
+// credits its author as a contributor. Opinions do not.
+func CountsTowardsContribution(commentType string) bool {
+	return commentType == "update" || commentType == "source"
+}
+
+// AvatarURL returns the Gravatar image for an email address, falling back to
+// a generated identicon for addresses without one.
+func AvatarURL(email string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+
+	return fmt.Sprintf("https://www.gravatar.com/avatar/%s?d=identicon", hex.EncodeToString(hash[:]))
+}
+
+// RetrieveForEntry lists an entry's contributors, most active first. Only
+// contributors who turned on show_gravatar get an avatar.
+func RetrieveForEntry(db queryer, entryID int) ([]data.Contributor, error) {
+	rows, err := db.Query(`
+		SELECT u.id,
+			u.username,
+			u.first_name,
+			u.last_name,
+			CASE WHEN u.show_gravatar THEN u.email END,
+			ec.contribution_count,
+			ec.last_contributed_at
+		FROM entry_contributors ec
+		JOIN users u ON u.id = ec.user_id
+		WHERE ec.entry_id = $1
+		ORDER BY ec.contribution_count DESC, ec.last_contributed_at DESC
+	`, entryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contributors := []data.Contributor{}
+
+	for rows.Next() {
+		var contributor data.Contributor
+		var email sql.NullString
+
+		err := rows.Scan(
+			&contributor.UserID,
+			&contributor.Username,
+			&contributor.FirstName,
+			&contributor.LastName,
+			&email,
+			&contributor.ContributionCount,
+			&contributor.LastContributedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if email.Valid {
+			contributor.AvatarURL = AvatarURL(email.String)
+		}
+
+		contributors = append(contributors, contributor)
+	}
+
+	return contributors, rows.Err()
+}
+
+func RetrieveEntryContributors(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	visible, err := utils.EntryVisible(c, db, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !visible {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	contributors, err := RetrieveForEntry(db, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, contributors)
+}
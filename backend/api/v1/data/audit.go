@@ -0,0 +1,46 @@
+package data
+
+import "encoding/json"
+
+type AuditLogQuery struct {
+	ActorID    int    `form:"actor_id"`
+	Action     string `form:"action"`
+	TargetType string `form:"target_type"`
+	TargetID   int    `form:"target_id"`
+	RequestID  string `form:"request_id"`
+	Since      string `form:"since" binding:"omitempty,datetime=2006-01-02"`
+	Until      string `form:"until" binding:"omitempty,datetime=2006-01-02"`
+	Limit      int    `form:"limit" binding:"omitempty,min=1,max=500"`
+	Offset     int    `form:"offset" binding:"omitempty,min=0"`
+}
+
+type AuditLogEntry struct {
+	ID            int             `json:"id"`
+	ActorID       *int            `json:"actor_id"`
+	ActorUsername *string         `json:"actor_username"`
+	Action        string          `json:"action"`
+	TargetType    string          `json:"target_type"`
+	TargetID      int             `json:"target_id"`
+	Before        json.RawMessage `json:"before,omitempty"`
+	After         json.RawMessage `json:"after,omitempty"`
+	Details       json.RawMessage `json:"details,omitempty"`
+	IPAddress     *string         `json:"ip_address"`
+	UserAgent     *string         `json:"user_agent"`
+	RequestID     *string         `json:"request_id"`
+	DateCreated   string          `json:"date_created"`
+	Hash          *string         `json:"hash"`
+}
+
+type AuditLogPage struct {
+	Entries []AuditLogEntry `json:"entries"`
+	Total   int             `json:"total"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+}
+
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	BrokenAt *int   `json:"broken_at,omitempty"`
+	Problem  string `json:"problem,omitempty"`
+}
@@ -1,12 +1,82 @@
 package data
 
-import "backend/api/v1/structs"
+import (
+	"encoding/json"
+
+	"backend/api/v1/structs"
+)
 
 type Bounds struct {
-	North float64 `json:"north"`
-	South float64 `json:"south"`
-	East  float64 `json:"east"`
-	West  float64 `json:"west"`
+	North  float64 `json:"north"`
+	South  float64 `json:"south"`
+	East   float64 `json:"east"`
+	West   float64 `json:"west"`
+	Cursor string  `json:"cursor"`
+	Limit  int     `json:"limit" binding:"omitempty,min=1"`
+	Zoom   *int    `json:"zoom" binding:"omitempty,min=0,max=24"`
+	EntryFilter
+}
+
+// BoundsResponse answers a bounds request that gave a zoom. Mode is
+// "clusters" when zoomed out and "entries" at street level, the other list
+// is empty. Only entries are paginated.
+type BoundsResponse struct {
+	Mode       string         `json:"mode"`
+	Clusters   []EntryCluster `json:"clusters"`
+	Entries    []Entry        `json:"entries"`
+	NextCursor *string        `json:"next_cursor"`
+}
+
+// EntryCluster is the entries in one grid cell of the map. EntryID is set
+// when there is only one.
+type EntryCluster struct {
+	Count     int            `json:"count"`
+	Longitude float64        `json:"longitude"`
+	Latitude  float64        `json:"latitude"`
+	West      float64        `json:"west"`
+	South     float64        `json:"south"`
+	East      float64        `json:"east"`
+	North     float64        `json:"north"`
+	EntryID   *int           `json:"entry_id,omitempty"`
+	Zoning    []ClusterCount `json:"zoning"`
+}
+
+// ClusterCount is how many entries in a cluster carry a tag.
+type ClusterCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// EntryFilter narrows the feed and bounds listings. A tag is a tag name, or
+// Classification=Name to match the classification too, and every tag has to
+// be on the latest revision. Dates are YYYY-MM-DD and inclusive.
+type EntryFilter struct {
+	Developer        *string  `form:"developer" json:"developer"`
+	PermitNumber     *string  `form:"permit_number" json:"permit_number"`
+	ParcelID         *string  `form:"parcel_id" json:"parcel_id"`
+	MinUnits         *int     `form:"min_units" json:"min_units"`
+	MaxUnits         *int     `form:"max_units" json:"max_units"`
+	MinSquareFootage *int     `form:"min_square_footage" json:"min_square_footage"`
+	MaxSquareFootage *int     `form:"max_square_footage" json:"max_square_footage"`
+	MinCost          *float64 `form:"min_cost" json:"min_cost"`
+	MaxCost          *float64 `form:"max_cost" json:"max_cost"`
+	CompletionAfter  *string  `form:"completion_after" json:"completion_after"`
+	CompletionBefore *string  `form:"completion_before" json:"completion_before"`
+	Tags             []string `form:"tag" json:"tags" binding:"max=10"`
+	Creator          *string  `form:"creator" json:"creator"`
+	CreatedAfter     *string  `form:"created_after" json:"created_after"`
+	CreatedBefore    *string  `form:"created_before" json:"created_before"`
+	UpdatedAfter     *string  `form:"updated_after" json:"updated_after"`
+	UpdatedBefore    *string  `form:"updated_before" json:"updated_before"`
+	MinScore         *int     `form:"min_score" json:"min_score"`
+	HasPhotos        *bool    `form:"has_photos" json:"has_photos"`
+}
+
+// EntryPage is one page of a paginated entry listing. NextCursor is null on
+// the last page.
+type EntryPage struct {
+	Entries    []Entry `json:"entries"`
+	NextCursor *string `json:"next_cursor"`
 }
 
 type Comment struct {
@@ -26,10 +96,12 @@ type Tag struct {
 }
 
 type EditEntryRequest struct {
-	NewTitle   string        `json:"newTitle"`
-	NewContent string        `json:"newContent"`
-	NewTags    []structs.Tag `json:"newTags"`
-	EntryID    int           `json:"entryId"`
+	NewTitle      string           `json:"newTitle"`
+	NewContent    string           `json:"newContent"`
+	NewTags       []structs.Tag    `json:"newTags"`
+	NewAttributes *EntryAttributes `json:"newAttributes,omitempty"`
+	NewFootprint  json.RawMessage  `json:"newFootprint,omitempty"`
+	EntryID       int              `json:"entryId"`
 }
 
 type VoteRequest struct {
@@ -43,33 +115,195 @@ type VoteResponse struct {
 	UserInteraction string `json:"user_interaction"`
 }
 
+// MaxAddressLength is the size of entry.address, a VARCHAR(60).
+const MaxAddressLength = 60
+
 type CreateEntryRequest struct {
-	Title       string        `json:"title" binding:"required"`
-	Location    string        `json:"location" binding:"required"`
-	Latitude    float64       `json:"latitude" binding:"required"`
-	Longitude   float64       `json:"longitude" binding:"required"`
-	Tags        []structs.Tag `json:"tags" binding:"required"`
-	Description string        `json:"description" binding:"required"`
+	Title       string           `json:"title" binding:"required"`
+	Location    string           `json:"location" binding:"required"`
+	Latitude    float64          `json:"latitude" binding:"required"`
+	Longitude   float64          `json:"longitude" binding:"required"`
+	Tags        []structs.Tag    `json:"tags" binding:"required"`
+	Description string           `json:"description" binding:"required"`
+	Force       bool             `json:"force"`
+	MediaIDs    []int            `json:"media_ids,omitempty"`
+	Attributes  *EntryAttributes `json:"attributes,omitempty"`
+	Footprint   json.RawMessage  `json:"footprint,omitempty"`
+}
+
+type EntryAttributes struct {
+	PermitNumbers       []string `json:"permit_numbers,omitempty"`
+	Developer           *string  `json:"developer,omitempty"`
+	Units               *int     `json:"units,omitempty"`
+	SquareFootage       *int     `json:"square_footage,omitempty"`
+	ParcelID            *string  `json:"parcel_id,omitempty"`
+	EstimatedCompletion *string  `json:"estimated_completion,omitempty"`
+	EstimatedCost       *float64 `json:"estimated_cost,omitempty"`
+}
+
+type AttributeChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+type RevisionDiffQuery struct {
+	From int `form:"from" binding:"required"`
+	To   int `form:"to" binding:"required"`
+}
+
+type RevisionDiff struct {
+	EntryID     int               `json:"entry_id"`
+	From        int               `json:"from"`
+	To          int               `json:"to"`
+	Title       *AttributeChange  `json:"title,omitempty"`
+	Content     *AttributeChange  `json:"content,omitempty"`
+	AddedTags   []Tag             `json:"added_tags"`
+	RemovedTags []Tag             `json:"removed_tags"`
+	Attributes  []AttributeChange `json:"attributes"`
+}
+
+type PhotoEntryProposal struct {
+	Media         Media                `json:"media"`
+	CapturedAt    string               `json:"captured_at,omitempty"`
+	Proposal      CreateEntryRequest   `json:"proposal"`
+	RadiusMeters  int                  `json:"radius_meters"`
+	NearbyEntries []DuplicateCandidate `json:"nearby_entries"`
+}
+
+type DuplicateCandidate struct {
+	ID             int     `json:"id"`
+	Title          string  `json:"title"`
+	Address        string  `json:"address"`
+	DistanceMeters float64 `json:"distance_meters"`
+	Similarity     float64 `json:"similarity"`
+	Tags           []Tag   `json:"tags,omitempty"`
+}
+
+type DuplicateConflictResponse struct {
+	Error        string               `json:"error"`
+	RadiusMeters int                  `json:"radius_meters"`
+	Candidates   []DuplicateCandidate `json:"candidates"`
 }
 
 type Entry struct {
-	ID               int       `json:"id"`
-	Title            string    `json:"title"`
-	Address          string    `json:"address"`
-	Content          string    `json:"content"`
-	Upvotes          int       `json:"upvotes"`
-	Downvotes        int       `json:"downvotes"`
-	NumberOfComments int       `json:"number_of_comments"`
-	Views            int       `json:"views"`
-	DateCreated      string    `json:"date_created"`
-	Username         string    `json:"username"`
-	FirstName        string    `json:"first_name"`
-	LastName         string    `json:"last_name"`
-	Longitude        float64   `json:"longitude"`
-	Latitude         float64   `json:"latitude"`
-	Tags             []Tag     `json:"tags,omitempty"`
-	Comments         []Comment `json:"comments,omitempty"`
-	UserInteraction  string    `json:"user_interaction,omitempty"`
+	ID               int              `json:"id"`
+	Title            string           `json:"title"`
+	Address          string           `json:"address"`
+	Content          string           `json:"content"`
+	ContentHTML      string           `json:"content_html"`
+	Upvotes          int              `json:"upvotes"`
+	Downvotes        int              `json:"downvotes"`
+	NumberOfComments int              `json:"number_of_comments"`
+	Views            int              `json:"views"`
+	Watchers         int              `json:"watchers"`
+	DateCreated      string           `json:"date_created"`
+	Username         string           `json:"username"`
+	FirstName        string           `json:"first_name"`
+	LastName         string           `json:"last_name"`
+	Longitude        float64          `json:"longitude"`
+	Latitude         float64          `json:"latitude"`
+	Footprint        json.RawMessage  `json:"footprint,omitempty"`
+	Tags             []Tag            `json:"tags,omitempty"`
+	Comments         []Comment        `json:"comments,omitempty"`
+	Media            []Media          `json:"media,omitempty"`
+	Attributes       *EntryAttributes `json:"attributes,omitempty"`
+	Contributors     []Contributor    `json:"contributors,omitempty"`
+	Relations        []EntryRelation  `json:"relations,omitempty"`
+	Locked           bool             `json:"locked,omitempty"`
+	UserInteraction  string           `json:"user_interaction,omitempty"`
+}
+
+type Contributor struct {
+	UserID            int    `json:"user_id"`
+	Username          string `json:"username"`
+	FirstName         string `json:"first_name"`
+	LastName          string `json:"last_name"`
+	AvatarURL         string `json:"avatar_url,omitempty"`
+	ContributionCount int    `json:"contribution_count"`
+	LastContributedAt string `json:"last_contributed_at"`
+}
+
+type Media struct {
+	ID               int    `json:"id"`
+	URL              string `json:"url"`
+	ThumbnailURL     string `json:"thumbnail_url,omitempty"`
+	MimeType         string `json:"mime_type"`
+	SizeBytes        int    `json:"size_bytes"`
+	Width            int    `json:"width,omitempty"`
+	Height           int    `json:"height,omitempty"`
+	OriginalFilename string `json:"original_filename"`
+	Position         int    `json:"position"`
+}
+
+type ArchiveEntryRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+type EntryTombstone struct {
+	ID            int    `json:"id"`
+	Archived      bool   `json:"archived"`
+	ArchivedAt    string `json:"archived_at"`
+	ArchiveReason string `json:"archive_reason"`
+}
+
+type MergeEntryRequest struct {
+	TargetID int    `json:"target_id" binding:"required"`
+	Reason   string `json:"reason" binding:"max=500"`
+}
+
+type MergeEntryResponse struct {
+	SourceID           int   `json:"source_id"`
+	TargetID           int   `json:"target_id"`
+	MovedRevisions     int64 `json:"moved_revisions"`
+	MovedConversations int64 `json:"moved_conversations"`
+	MovedInteractions  int64 `json:"moved_interactions"`
+}
+
+type DailyViews struct {
+	Day   string `json:"day"`
+	Views int    `json:"views"`
+}
+
+type EntryViewsResponse struct {
+	EntryID    int          `json:"entry_id"`
+	TotalViews int          `json:"total_views"`
+	Daily      []DailyViews `json:"daily"`
+}
+
+type TimelineStage struct {
+	Status         string  `json:"status"`
+	RevisionNumber int     `json:"revision_number"`
+	StartedAt      string  `json:"started_at"`
+	EndedAt        string  `json:"ended_at,omitempty"`
+	DurationDays   float64 `json:"duration_days"`
+	Current        bool    `json:"current"`
+}
+
+type EntryTimeline struct {
+	EntryID       int             `json:"entry_id"`
+	CurrentStatus string          `json:"current_status,omitempty"`
+	Stages        []TimelineStage `json:"stages"`
+}
+
+// TimelineStatsQuery picks the entries within Distance of a city. Distance is
+// in Unit, miles unless it's km.
+type TimelineStatsQuery struct {
+	Location string  `form:"location" binding:"required"`
+	Distance float64 `form:"distance" binding:"required,gt=0,lte=100"`
+	Unit     string  `form:"unit" binding:"omitempty,oneof=mi km"`
+	From     string  `form:"from"`
+	To       string  `form:"to"`
+}
+
+type TimelineStats struct {
+	City       string   `json:"city"`
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	SampleSize int      `json:"sample_size"`
+	MedianDays *float64 `json:"median_days"`
+	P25Days    *float64 `json:"p25_days"`
+	P75Days    *float64 `json:"p75_days"`
 }
 
 type TomTomResponse struct {
@@ -84,6 +318,14 @@ type TomTomResponse struct {
 	} `json:"results"`
 }
 
+type TomTomReverseGeocodeResponse struct {
+	Addresses []struct {
+		Address struct {
+			FreeformAddress string `json:"freeformAddress"`
+		} `json:"address"`
+	} `json:"addresses"`
+}
+
 type AddressSuggestion struct {
 	Address string  `json:"address"`
 	Lat     float64 `json:"lat"`
@@ -109,7 +351,36 @@ type City struct {
 	Incorporated bool    `json:"incorporated"`
 }
 
+// FeedQuery centers the feed on exactly one of a city name, lat and lon, or
+// the signed in user's home. Distance is in Unit, miles unless it's km.
 type FeedQuery struct {
-	Location string `form:"location" binding:"required"`
-	Distance string `form:"distance" binding:"required"`
+	Location  string   `form:"location"`
+	Latitude  *float64 `form:"lat" binding:"omitempty,gte=-90,lte=90"`
+	Longitude *float64 `form:"lon" binding:"omitempty,gte=-180,lte=180"`
+	Near      string   `form:"near" binding:"omitempty,oneof=home"`
+	Distance  float64  `form:"distance" binding:"required,gt=0"`
+	Unit      string   `form:"unit" binding:"omitempty,oneof=mi km"`
+	Sort      string   `form:"sort" binding:"omitempty,oneof=new top hot discussed nearest"`
+	Window    string   `form:"window" binding:"omitempty,oneof=day week month year all"`
+	Cursor    string   `form:"cursor"`
+	Limit     int      `form:"limit" binding:"omitempty,min=1"`
+	EntryFilter
+}
+
+type LockEntryRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+type HideRevisionRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+type RevisionSummary struct {
+	ID             int     `json:"id"`
+	RevisionNumber int     `json:"revision_number"`
+	Title          string  `json:"title"`
+	Username       string  `json:"username"`
+	DateCreated    string  `json:"date_created"`
+	Hidden         bool    `json:"hidden"`
+	HiddenReason   *string `json:"hidden_reason,omitempty"`
 }
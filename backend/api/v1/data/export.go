@@ -0,0 +1,37 @@
+package data
+
+import "encoding/json"
+
+// ExportQuery selects the entries to export. A bounding box needs all four
+// sides, a city needs location and distance (in Unit, miles unless it's km,
+// as in the feed), and tags match entries whose latest revision has any of
+// the named tags.
+type ExportQuery struct {
+	Format   string   `form:"format" binding:"required,oneof=geojson csv kml"`
+	North    *float64 `form:"north"`
+	South    *float64 `form:"south"`
+	East     *float64 `form:"east"`
+	West     *float64 `form:"west"`
+	Location string   `form:"location"`
+	Distance *float64 `form:"distance"`
+	Unit     string   `form:"unit" binding:"omitempty,oneof=mi km"`
+	Tags     []string `form:"tag"`
+}
+
+type ExportEntry struct {
+	ID                  int             `json:"id"`
+	Title               string          `json:"title"`
+	Address             string          `json:"address"`
+	Content             string          `json:"content"`
+	RevisionNumber      int             `json:"revision_number"`
+	RevisionDateCreated string          `json:"revision_date_created"`
+	DateCreated         string          `json:"date_created"`
+	Username            string          `json:"username"`
+	Longitude           float64         `json:"longitude"`
+	Latitude            float64         `json:"latitude"`
+	Footprint           json.RawMessage `json:"-"`
+	FootprintKML        string          `json:"-"`
+	Tags                []Tag           `json:"tags"`
+	Upvotes             int             `json:"upvotes"`
+	Downvotes           int             `json:"downvotes"`
+}
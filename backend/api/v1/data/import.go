@@ -0,0 +1,23 @@
+package data
+
+type ImportRowReport struct {
+	Line        int                  `json:"line"`
+	Action      string               `json:"action"`
+	EntryID     *int                 `json:"entry_id,omitempty"`
+	Title       string               `json:"title,omitempty"`
+	MatchedBy   string               `json:"matched_by,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	Changes     []AttributeChange    `json:"changes,omitempty"`
+	AddedTags   []Tag                `json:"added_tags,omitempty"`
+	RemovedTags []Tag                `json:"removed_tags,omitempty"`
+	Candidates  []DuplicateCandidate `json:"candidates,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun    bool              `json:"dry_run"`
+	Created   int               `json:"created"`
+	Updated   int               `json:"updated"`
+	Unchanged int               `json:"unchanged"`
+	Skipped   int               `json:"skipped"`
+	Rows      []ImportRowReport `json:"rows"`
+}
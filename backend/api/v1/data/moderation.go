@@ -0,0 +1,39 @@
+package data
+
+type FlagRequest struct {
+	TargetType string `json:"target_type" binding:"required,oneof=entry revision comment"`
+	TargetID   int    `json:"target_id" binding:"required"`
+	Reason     string `json:"reason" binding:"required,oneof=spam inaccurate harassment private_info"`
+	Details    string `json:"details" binding:"max=1000"`
+}
+
+type ModerationQueueQuery struct {
+	TargetType string `form:"target_type" binding:"omitempty,oneof=entry revision comment"`
+	Reason     string `form:"reason" binding:"omitempty,oneof=spam inaccurate harassment private_info"`
+	Claimed    string `form:"claimed" binding:"omitempty,oneof=mine unclaimed"`
+	Limit      int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Offset     int    `form:"offset" binding:"omitempty,min=0"`
+}
+
+// ModerationQueueItem groups the open flags on one piece of content.
+type ModerationQueueItem struct {
+	TargetType     string   `json:"target_type"`
+	TargetID       int      `json:"target_id"`
+	EntryID        int      `json:"entry_id"`
+	FlagCount      int      `json:"flag_count"`
+	Reasons        []string `json:"reasons"`
+	Details        []string `json:"details"`
+	FirstFlaggedAt string   `json:"first_flagged_at"`
+	LastFlaggedAt  string   `json:"last_flagged_at"`
+	ClaimedBy      *string  `json:"claimed_by"`
+	ClaimedAt      *string  `json:"claimed_at"`
+	Hidden         bool     `json:"hidden"`
+}
+
+// ResolveFlagsRequest closes every open flag on a target. SuspendDays is
+// required by the suspend resolution, where 0 bans the author permanently.
+type ResolveFlagsRequest struct {
+	Resolution  string `json:"resolution" binding:"required,oneof=dismiss hide revert suspend"`
+	Reason      string `json:"reason" binding:"required,max=1000"`
+	SuspendDays *int   `json:"suspend_days" binding:"required_if=Resolution suspend,omitempty,min=0,max=3650"`
+}
@@ -0,0 +1,31 @@
+package data
+
+import "encoding/json"
+
+type WatchedEntry struct {
+	EntryID             int    `json:"entry_id"`
+	Title               string `json:"title"`
+	Address             string `json:"address"`
+	WatchingSince       string `json:"watching_since"`
+	UnreadNotifications int    `json:"unread_notifications"`
+}
+
+type Notification struct {
+	ID            int             `json:"id"`
+	EntryID       *int            `json:"entry_id,omitempty"`
+	EntryTitle    string          `json:"entry_title,omitempty"`
+	ActorUsername string          `json:"actor_username,omitempty"`
+	Type          string          `json:"type"`
+	Details       json.RawMessage `json:"details,omitempty"`
+	Read          bool            `json:"read"`
+	DateCreated   string          `json:"date_created"`
+}
+
+type NotificationsQuery struct {
+	Unread bool `form:"unread"`
+	Limit  int  `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type MarkNotificationsReadRequest struct {
+	IDs []int `json:"ids"`
+}
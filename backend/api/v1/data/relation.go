@@ -0,0 +1,70 @@
+package data
+
+type AddRelationRequest struct {
+	ToEntryID int    `json:"to_entry_id" binding:"required"`
+	Type      string `json:"type" binding:"required,oneof=phase_of replaces same_developer adjacent_to"`
+}
+
+// EntryRelation is a relation seen from one entry. Label reads from that
+// entry's side, e.g. "Phase of" or "Has phase".
+type EntryRelation struct {
+	ID          int    `json:"id"`
+	Type        string `json:"type"`
+	Label       string `json:"label"`
+	EntryID     int    `json:"entry_id"`
+	Title       string `json:"title"`
+	Status      string `json:"status"`
+	ProposedBy  string `json:"proposed_by"`
+	DateCreated string `json:"date_created"`
+}
+
+type PendingRelation struct {
+	ID          int    `json:"id"`
+	Type        string `json:"type"`
+	FromEntryID int    `json:"from_entry_id"`
+	FromTitle   string `json:"from_title"`
+	ToEntryID   int    `json:"to_entry_id"`
+	ToTitle     string `json:"to_title"`
+	ProposedBy  string `json:"proposed_by"`
+	DateCreated string `json:"date_created"`
+}
+
+type RelationHistoryEvent struct {
+	ID          int     `json:"id"`
+	RelationID  int     `json:"relation_id"`
+	Type        string  `json:"type"`
+	FromEntryID int     `json:"from_entry_id"`
+	ToEntryID   int     `json:"to_entry_id"`
+	Action      string  `json:"action"`
+	StatusFrom  *string `json:"status_from"`
+	StatusTo    string  `json:"status_to"`
+	Actor       string  `json:"actor"`
+	RevertsID   *int    `json:"reverts_id,omitempty"`
+	DateCreated string  `json:"date_created"`
+}
+
+type RelationGraphQuery struct {
+	Depth int      `form:"depth" binding:"omitempty,min=1,max=10"`
+	Types []string `form:"type"`
+}
+
+type RelationGraphNode struct {
+	EntryID int    `json:"entry_id"`
+	Title   string `json:"title"`
+	Address string `json:"address"`
+	Depth   int    `json:"depth"`
+}
+
+type RelationGraphEdge struct {
+	ID          int    `json:"id"`
+	FromEntryID int    `json:"from_entry_id"`
+	ToEntryID   int    `json:"to_entry_id"`
+	Type        string `json:"type"`
+}
+
+type RelationGraph struct {
+	EntryID   int                 `json:"entry_id"`
+	Nodes     []RelationGraphNode `json:"nodes"`
+	Edges     []RelationGraphEdge `json:"edges"`
+	Truncated bool                `json:"truncated"`
+}
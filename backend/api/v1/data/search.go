@@ -0,0 +1,72 @@
+package data
+
+// EntrySearchQuery searches entries by text, optionally within bounds or
+// within Distance of a point. Distance is in Unit, miles unless it's km.
+type EntrySearchQuery struct {
+	Q         string   `form:"q" binding:"required,max=200"`
+	West      *float64 `form:"west" binding:"omitempty,gte=-180,lte=180"`
+	South     *float64 `form:"south" binding:"omitempty,gte=-90,lte=90"`
+	East      *float64 `form:"east" binding:"omitempty,gte=-180,lte=180"`
+	North     *float64 `form:"north" binding:"omitempty,gte=-90,lte=90"`
+	Longitude *float64 `form:"longitude" binding:"omitempty,gte=-180,lte=180"`
+	Latitude  *float64 `form:"latitude" binding:"omitempty,gte=-90,lte=90"`
+	Distance  *float64 `form:"distance" binding:"omitempty,gt=0,lte=100"`
+	Unit      string   `form:"unit" binding:"omitempty,oneof=mi km"`
+	Cursor    string   `form:"cursor"`
+	Limit     int      `form:"limit" binding:"omitempty,min=1"`
+}
+
+// EntrySearchResult is an entry matching a search. TitleHighlight and Snippet
+// are escaped HTML with the matched words in <mark>.
+type EntrySearchResult struct {
+	ID             int     `json:"id"`
+	Title          string  `json:"title"`
+	Address        string  `json:"address"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+	Rank           float64 `json:"rank"`
+	DateCreated    string  `json:"date_created"`
+	Username       string  `json:"username"`
+	Longitude      float64 `json:"longitude"`
+	Latitude       float64 `json:"latitude"`
+	Tags           []Tag   `json:"tags,omitempty"`
+}
+
+type EntrySearchPage struct {
+	Results    []EntrySearchResult `json:"results"`
+	NextCursor *string             `json:"next_cursor"`
+}
+
+// DiscussionSearchQuery searches comments by text. After and Before are
+// YYYY-MM-DD and inclusive.
+type DiscussionSearchQuery struct {
+	Q       string  `form:"q" binding:"required,max=200"`
+	Type    *string `form:"type" binding:"omitempty,oneof=opinion source update"`
+	EntryID *int    `form:"entry_id" binding:"omitempty,min=1"`
+	Author  *string `form:"author"`
+	After   *string `form:"after"`
+	Before  *string `form:"before"`
+	Cursor  string  `form:"cursor"`
+	Limit   int     `form:"limit" binding:"omitempty,min=1"`
+}
+
+// DiscussionSearchResult is a comment matching a search. ThreadPath is the
+// ids of the comments above it, from the top of the thread down to its
+// parent, empty for a top-level comment.
+type DiscussionSearchResult struct {
+	ID          int     `json:"id"`
+	EntryID     int     `json:"entry_id"`
+	EntryTitle  string  `json:"entry_title"`
+	ParentID    *int    `json:"parent_id,omitempty"`
+	ThreadPath  []int   `json:"thread_path"`
+	Type        string  `json:"type"`
+	Username    string  `json:"username"`
+	Snippet     string  `json:"snippet"`
+	Rank        float64 `json:"rank"`
+	DateCreated *string `json:"date_created"`
+}
+
+type DiscussionSearchPage struct {
+	Results    []DiscussionSearchResult `json:"results"`
+	NextCursor *string                  `json:"next_cursor"`
+}
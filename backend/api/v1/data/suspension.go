@@ -0,0 +1,28 @@
+package data
+
+// SuspendUserRequest suspends a user for Days days, or bans them for good
+// when Days is 0. Days is a pointer so leaving it out is an error rather than
+// a ban.
+type SuspendUserRequest struct {
+	Reason string `json:"reason" binding:"required,max=1000"`
+	Days   *int   `json:"days" binding:"required,min=0,max=3650"`
+}
+
+type Suspension struct {
+	ID          int     `json:"id"`
+	UserID      int     `json:"user_id"`
+	Reason      string  `json:"reason"`
+	SuspendedBy string  `json:"suspended_by"`
+	EndsAt      *string `json:"ends_at"`
+	Permanent   bool    `json:"permanent"`
+	LiftedAt    *string `json:"lifted_at,omitempty"`
+	DateCreated string  `json:"date_created"`
+}
+
+// SuspendedResponse is the error body returned to suspended users.
+type SuspendedResponse struct {
+	Error     string  `json:"error"`
+	Reason    string  `json:"reason"`
+	EndsAt    *string `json:"ends_at"`
+	Permanent bool    `json:"permanent"`
+}
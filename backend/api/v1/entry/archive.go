@@ -0,0 +1,226 @@
+package entry
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	audit "backend/api/v1/audit"
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+func ArchiveEntry(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	var req data.ArchiveEntryRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	userID, role, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	var creatorID sql.NullInt64
+	var archivedAt sql.NullTime
+
+	err = db.QueryRow(`
+		SELECT creator_id, archived_at FROM entry WHERE id = $1
+	`, entryID).Scan(&creatorID, &archivedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			messages.StatusNotFound(c, errors.New("Entry not found"))
+			return
+		}
+
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if int(creatorID.Int64) != userID && !utils.IsModerator(role) {
+		messages.StatusForbidden(c, errors.New("Only the creator or a moderator can archive this entry"))
+		return
+	}
+
+	if archivedAt.Valid {
+		messages.StatusConflict(c, errors.New("Entry is already archived"))
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE entry
+		SET archived_at = now(), archived_by = $2, archive_reason = $3
+		WHERE id = $1 AND archived_at IS NULL
+	`, entryID, userID, req.Reason)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "entry.archive",
+		TargetType: "entry",
+		TargetID:   entryID,
+		Details:    gin.H{"reason": req.Reason},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Entry archived successfully!")
+}
+
+func RestoreEntry(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	moderatorID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	var archivedAt sql.NullTime
+
+	err = db.QueryRow(`
+		SELECT archived_at FROM entry WHERE id = $1
+	`, entryID).Scan(&archivedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			messages.StatusNotFound(c, errors.New("Entry not found"))
+			return
+		}
+
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !archivedAt.Valid {
+		messages.StatusConflict(c, errors.New("Entry is not archived"))
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE entry
+		SET archived_at = NULL, archived_by = NULL, archive_reason = NULL
+		WHERE id = $1
+	`, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    moderatorID,
+		Action:     "entry.restore",
+		TargetType: "entry",
+		TargetID:   entryID,
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Entry restored successfully!")
+}
+
+// PurgeArchivedEntries hard-deletes entries that have been archived for longer
+// than the retention window. Revisions, conversations and interactions go with
+// them through their ON DELETE CASCADE foreign keys. Each purge is audited
+// with no actor, it's the system doing it.
+func PurgeArchivedEntries(db *sql.DB, retention time.Duration) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		DELETE FROM entry
+		WHERE archived_at IS NOT NULL
+		AND archived_at < now() - make_interval(secs => $1)
+		RETURNING id, archived_at
+	`, retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	var purged []audit.Event
+
+	for rows.Next() {
+		var entryID int
+		var archivedAt string
+
+		if err := rows.Scan(&entryID, &archivedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		purged = append(purged, audit.Event{
+			Action:     "entry.purge",
+			TargetType: "entry",
+			TargetID:   entryID,
+			Before:     gin.H{"archived_at": archivedAt},
+			Details:    gin.H{"retention_days": int(retention.Hours() / 24)},
+		})
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, event := range purged {
+		if err := audit.Record(tx, nil, event); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int64(len(purged)), nil
+}
@@ -0,0 +1,143 @@
+package entry
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	data "backend/api/v1/data"
+)
+
+const (
+	boundsModeClusters = "clusters"
+	boundsModeEntries  = "entries"
+)
+
+// streetLevelZoom is the first web map zoom level that shows entries one by
+// one rather than clustered.
+const streetLevelZoom = 15
+
+// clusterCellsPerTile splits each 256 pixel map tile into a grid of cells
+// about 64 pixels across.
+const clusterCellsPerTile = 4
+
+func clustersAtZoom(zoom *int) bool {
+	return zoom != nil && *zoom < streetLevelZoom
+}
+
+// clusterCellSize is the side of a grid cell in degrees. The grid is
+// anchored at 0,0 rather than the viewport so clusters stay put as the map
+// pans.
+func clusterCellSize(zoom int) float64 {
+	return 360 / math.Exp2(float64(zoom)) / clusterCellsPerTile
+}
+
+// queryClusters groups the entries within bounds into grid cells, biggest
+// clusters first.
+func queryClusters(db queryer, bounds data.Bounds) ([]data.EntryCluster, error) {
+	b := newQueryBuilder(
+		bounds.West,
+		bounds.South,
+		bounds.East,
+		bounds.North,
+		clusterCellSize(*bounds.Zoom),
+	)
+	addEntryFilter(b, bounds.EntryFilter)
+
+	rows, err := db.Query(fmt.Sprintf(`
+		WITH matched AS (
+			SELECT e.id,
+				er.id AS revision_id,
+				ST_Centroid(COALESCE(e.footprint, e.location)::geometry) AS point
+			FROM entry e
+			JOIN users u ON e.creator_id = u.id
+			JOIN (
+				SELECT DISTINCT ON (entry_id) id, entry_id, revision_number, date_created
+				FROM entry_revision
+				ORDER BY entry_id, revision_number DESC
+			) er ON e.id = er.entry_id
+			LEFT JOIN entry_revision_attributes era ON era.entry_revision_id = er.id
+			WHERE ST_Intersects(
+				COALESCE(e.footprint, e.location)::geometry,
+				ST_MakeEnvelope($1, $2, $3, $4, 4326)
+			)
+			AND e.archived_at IS NULL
+			AND e.hidden_at IS NULL
+			AND %s
+		),
+		cells AS (
+			SELECT id,
+				revision_id,
+				point,
+				ST_X(ST_SnapToGrid(point, $5)) AS cell_x,
+				ST_Y(ST_SnapToGrid(point, $5)) AS cell_y
+			FROM matched
+		),
+		zoning AS (
+			SELECT c.cell_x, c.cell_y, t.name, COUNT(*) AS count
+			FROM cells c
+			JOIN tags_entry_revision ter ON ter.entry_revision_id = c.revision_id
+			JOIN tags t ON t.id = ter.tag_id
+			WHERE t.classification = 'Zoning'
+			GROUP BY c.cell_x, c.cell_y, t.name
+		)
+		SELECT COUNT(*),
+			ST_X(ST_Centroid(ST_Collect(c.point))),
+			ST_Y(ST_Centroid(ST_Collect(c.point))),
+			ST_XMin(ST_Extent(c.point)),
+			ST_YMin(ST_Extent(c.point)),
+			ST_XMax(ST_Extent(c.point)),
+			ST_YMax(ST_Extent(c.point)),
+			MIN(c.id),
+			(
+				SELECT json_agg(json_build_object('name', z.name, 'count', z.count) ORDER BY z.count DESC, z.name)
+				FROM zoning z
+				WHERE z.cell_x = c.cell_x AND z.cell_y = c.cell_y
+			)
+		FROM cells c
+		GROUP BY c.cell_x, c.cell_y
+		ORDER BY COUNT(*) DESC, c.cell_x, c.cell_y
+	`, b.clause()), b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clusters := []data.EntryCluster{}
+
+	for rows.Next() {
+		var cluster data.EntryCluster
+		var entryID int
+		var zoning []byte
+
+		err := rows.Scan(
+			&cluster.Count,
+			&cluster.Longitude,
+			&cluster.Latitude,
+			&cluster.West,
+			&cluster.South,
+			&cluster.East,
+			&cluster.North,
+			&entryID,
+			&zoning,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if cluster.Count == 1 {
+			cluster.EntryID = &entryID
+		}
+
+		cluster.Zoning = []data.ClusterCount{}
+		if zoning != nil {
+			if err := json.Unmarshal(zoning, &cluster.Zoning); err != nil {
+				return nil, err
+			}
+		}
+
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters, rows.Err()
+}
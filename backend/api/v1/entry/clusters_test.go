@@ -0,0 +1,28 @@
+package entry
+
+import "testing"
+
+func TestClustersAtZoom(t *testing.T) {
+	if clustersAtZoom(nil) {
+		t.Error("clustered without a zoom")
+	}
+
+	for zoom, want := range map[int]bool{0: true, 10: true, streetLevelZoom - 1: true, streetLevelZoom: false, 20: false} {
+		if got := clustersAtZoom(&zoom); got != want {
+			t.Errorf("zoom %d: got %v, want %v", zoom, got, want)
+		}
+	}
+}
+
+func TestClusterCellSize(t *testing.T) {
+	if got := clusterCellSize(0); got != 90 {
+		t.Errorf("zoom 0: got %v, want a quarter of the world", got)
+	}
+
+	// each zoom level halves the cell, like the tiles
+	for zoom := 1; zoom < streetLevelZoom; zoom++ {
+		if clusterCellSize(zoom)*2 != clusterCellSize(zoom-1) {
+			t.Errorf("zoom %d: %v is not half of %v", zoom, clusterCellSize(zoom), clusterCellSize(zoom-1))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package entry
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	data "backend/api/v1/data"
+	structs "backend/api/v1/structs"
+	utils "backend/api/v1/utils"
+)
+
+const defaultDuplicateRadiusMeters = 50
+
+// DuplicateRadiusForTags returns how close another entry has to be to count as
+// a possible duplicate. Denser zoning sits closer together, so the radius is
+// looked up per Zoning tag and the widest one wins.
+func DuplicateRadiusForTags(db *sql.DB, tags []structs.Tag) (int, error) {
+	var zoning []string
+
+	for _, tag := range tags {
+		if tag.Classification == "Zoning" {
+			zoning = append(zoning, tag.Name)
+		}
+	}
+
+	if len(zoning) == 0 {
+		return defaultDuplicateRadiusMeters, nil
+	}
+
+	var radius int
+
+	err := db.QueryRow(`
+		SELECT COALESCE(MAX(radius_meters), $2)
+		FROM duplicate_radius
+		WHERE zoning = ANY($1)
+	`, pq.Array(zoning), defaultDuplicateRadiusMeters).Scan(&radius)
+	if err != nil {
+		return 0, err
+	}
+
+	return radius, nil
+}
+
+// FindNearbyEntries lists the live entries within radiusMeters of a point,
+// closest first, scored by how similar their latest revision reads to text.
+// When footprint GeoJSON is given it is used in place of the point, and
+// entries are measured by their own footprint where they have one, so
+// overlapping developments always count as nearby.
+func FindNearbyEntries(
+	db *sql.DB,
+	longitude float64,
+	latitude float64,
+	footprint string,
+	radiusMeters int,
+	text string,
+) ([]data.DuplicateCandidate, error) {
+	rows, err := db.Query(`
+		WITH probe AS (
+			SELECT COALESCE(
+				ST_Multi(ST_SetSRID(ST_GeomFromGeoJSON(NULLIF($4, '')), 4326))::geography,
+				ST_MakePoint($1, $2)::geography
+			) AS shape
+		)
+		SELECT e.id,
+			e.address,
+			er.id AS revision_id,
+			er.title,
+			er.content,
+			ST_Distance(COALESCE(e.footprint, e.location), probe.shape) AS distance
+		FROM entry e
+		CROSS JOIN probe
+		JOIN (
+			SELECT DISTINCT ON (entry_id) id, entry_id, title, content, revision_number
+			FROM entry_revision
+			ORDER BY entry_id, revision_number DESC
+		) er ON e.id = er.entry_id
+		WHERE ST_DWithin(COALESCE(e.footprint, e.location), probe.shape, $3)
+		AND e.archived_at IS NULL
+		ORDER BY distance
+	`, longitude, latitude, radiusMeters, footprint)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []data.DuplicateCandidate
+	var revisionIds []int
+
+	for rows.Next() {
+		var candidate data.DuplicateCandidate
+		var revisionId int
+		var title sql.NullString
+		var content string
+
+		err := rows.Scan(
+			&candidate.ID,
+			&candidate.Address,
+			&revisionId,
+			&title,
+			&content,
+			&candidate.DistanceMeters,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		candidate.Title = title.String
+		candidate.Similarity = utils.TextSimilarity(text, title.String+" "+content)
+
+		candidates = append(candidates, candidate)
+		revisionIds = append(revisionIds, revisionId)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range candidates {
+		candidates[i].Tags, err = retrieveTagsForEntryRevision(db, revisionIds[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return candidates, nil
+}
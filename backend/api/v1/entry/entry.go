@@ -4,18 +4,35 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"backend/api/v1/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 	"github.com/lithammer/fuzzysearch/fuzzy"
 
+	attributes "backend/api/v1/attributes"
+	audit "backend/api/v1/audit"
+	contributors "backend/api/v1/contributors"
 	data "backend/api/v1/data"
+	footprint "backend/api/v1/footprint"
+	markdown "backend/api/v1/markdown"
+	media "backend/api/v1/media"
 	messages "backend/api/v1/messages"
+	notifications "backend/api/v1/notifications"
+	pagination "backend/api/v1/pagination"
+	relations "backend/api/v1/relations"
+	search "backend/api/v1/search"
+	structs "backend/api/v1/structs"
+	views "backend/api/v1/views"
 )
 
 func AutocompleteAddress(c *gin.Context, db *sql.DB) {
@@ -81,53 +98,70 @@ func CreateEntry(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	query := `
-		SELECT EXISTS (
-			SELECT 1
-			FROM entry
-			WHERE ST_DWithin(location, geography(ST_MakePoint($1, $2)), 50)
-		);
-	`
-
-	var entryAlreadyExists bool
-	err := db.QueryRow(query, payload.Longitude, payload.Latitude).Scan(&entryAlreadyExists)
+	userID, role, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
 	if err != nil {
-		messages.InternalServerError(c, err)
+		messages.StatusUnauthorized(c, err)
 		return
 	}
 
-	if entryAlreadyExists {
-		messages.StatusConflict(c, err)
+	if payload.Force && !utils.IsTrusted(role) {
+		messages.StatusForbidden(c, errors.New("Only trusted users can force a new entry next to an existing one"))
 		return
 	}
 
-	var username string
-
-	cookie, err := c.Cookie("access_token")
-	if err != nil {
-		messages.StatusUnauthorized(c, err)
+	if len(payload.Description) > markdown.MaxSourceLength {
+		messages.StatusBadRequest(c, errors.New("Description is too long"))
+		return
 	}
 
-	username, err = utils.ParseTokenAndReturnUsername(cookie)
-	if err != nil {
-		messages.StatusUnauthorized(c, err)
+	if err := attributes.Validate(payload.Attributes, payload.Tags); err != nil {
+		messages.StatusBadRequest(c, err)
 		return
 	}
 
-	var userID int
-	err = db.QueryRow(`
-		SELECT id FROM users WHERE username = $1
-	`, username).Scan(&userID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			messages.StatusUnauthorized(c, err)
+	var geometry string
+
+	if len(payload.Footprint) > 0 && !footprint.IsNull(payload.Footprint) {
+		geometry, err = footprint.Parse(payload.Footprint)
+		if err != nil {
+			messages.StatusBadRequest(c, err)
+			return
+		}
+
+		if err := footprint.Validate(db, geometry); err != nil {
+			messages.StatusBadRequest(c, err)
 			return
 		}
+	}
+
+	radius, err := DuplicateRadiusForTags(db, payload.Tags)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
 
+	candidates, err := FindNearbyEntries(
+		db,
+		payload.Longitude,
+		payload.Latitude,
+		geometry,
+		radius,
+		payload.Title+" "+payload.Description,
+	)
+	if err != nil {
 		messages.InternalServerError(c, err)
 		return
 	}
 
+	if len(candidates) > 0 && !payload.Force {
+		c.JSON(http.StatusConflict, data.DuplicateConflictResponse{
+			Error:        "An entry already exists near this location",
+			RadiusMeters: radius,
+			Candidates:   candidates,
+		})
+		return
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		messages.InternalServerError(c, err)
@@ -140,27 +174,59 @@ func CreateEntry(c *gin.Context, db *sql.DB) {
 		}
 	}()
 
-	var entryRevisionId int
+	entryID, entryRevisionId, err := insertEntry(
+		tx,
+		userID,
+		payload.Location,
+		payload.Longitude,
+		payload.Latitude,
+		newRevision{
+			Title:      payload.Title,
+			Content:    payload.Description,
+			Tags:       payload.Tags,
+			Attributes: payload.Attributes,
+			Geometry:   geometry,
+		},
+	)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
 
-	err = tx.QueryRow(`
-		WITH entry_insert AS (
-			INSERT INTO entry (address, creator_id, location) 
-			VALUES ($2, $3, ST_SetSRID(ST_MakePoint($4, $5), 4326))
-			RETURNING id
-		),
-		revision_number AS (
-			SELECT COUNT(*) + 1 AS revision_number FROM entry_revision WHERE entry_id = (SELECT id FROM entry_insert)
-		)
-		INSERT INTO entry_revision (entry_id, title, content, revision_number, creator_id)
-		SELECT (SELECT id FROM entry_insert), $1, $6, (SELECT revision_number FROM revision_number), $3
-		RETURNING id
-		`, payload.Title, payload.Location, userID, payload.Longitude, payload.Latitude, payload.Description).Scan(&entryRevisionId)
+	err = media.AttachPendingMedia(tx, entryID, entryRevisionId, userID, payload.MediaIDs)
+	if err != nil {
+		if err == media.ErrMediaNotFound {
+			messages.StatusBadRequest(c, err)
+			return
+		}
+
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = notifications.Watch(tx, entryID, userID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "entry.create",
+		TargetType: "entry",
+		TargetID:   entryID,
+		After: gin.H{
+			"revision_id": entryRevisionId,
+			"title":       payload.Title,
+			"address":     payload.Location,
+			"tags":        payload.Tags,
+		},
+	})
 	if err != nil {
 		messages.InternalServerError(c, err)
 		return
 	}
 
-	utils.InsertTagAndEntryRevisionAssociation(tx, entryRevisionId, payload.Tags)
 	messages.StatusCreated(c, "Entry created successfully!")
 }
 
@@ -172,33 +238,79 @@ func RetrieveEntriesWithinVisibleBounds(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	rows, err := db.Query(`
-		SELECT entry.id,
-			   address, 
-			   er.content, 
-			   views, 
-			   date_created, 
-			   username, 
-			   first_name, 
-			   last_name,
-				 er.id as revision_id,
-				 er.title,
-			   ST_X(location::geometry) AS longitude,
-			   ST_Y(location::geometry) AS latitude
-		FROM entry
-		JOIN users ON entry.creator_id = users.id
-		JOIN (
-			SELECT DISTINCT ON (entry_id) id, entry_id, title, content, revision_number
-			FROM entry_revision
-			ORDER BY entry_id, revision_number DESC
-		) er ON entry.id = er.entry_id
-		WHERE location::geometry && ST_MakeEnvelope($1, $2, $3, $4, 4326)
-	`,
+	cursor, err := pagination.Decode(bounds.Cursor, boundsSort)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if err := validateEntryFilter(bounds.EntryFilter); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if clustersAtZoom(bounds.Zoom) {
+		clusters, err := queryClusters(db, bounds)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, data.BoundsResponse{
+			Mode:     boundsModeClusters,
+			Clusters: clusters,
+			Entries:  []data.Entry{},
+		})
+		return
+	}
+
+	// clients that send a zoom know about pages
+	paged := pageRequested(bounds.Cursor, bounds.Limit) || bounds.Zoom != nil
+	limit := pageLimit(paged, bounds.Limit)
+
+	b := newQueryBuilder(
 		bounds.West,
 		bounds.South,
 		bounds.East,
 		bounds.North,
+		cursor.IDArg(),
+		pagination.LimitArg(limit),
 	)
+	addEntryFilter(b, bounds.EntryFilter)
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT e.id,
+			e.address,
+			er.content,
+			e.views,
+			e.date_created,
+			u.username,
+			u.first_name,
+			u.last_name,
+			er.id AS revision_id,
+			er.title,
+			ST_X(e.location::geometry) AS longitude,
+			ST_Y(e.location::geometry) AS latitude,
+			ST_AsGeoJSON(e.footprint) AS footprint
+		FROM entry e
+		JOIN users u ON e.creator_id = u.id
+		JOIN (
+			SELECT DISTINCT ON (entry_id) id, entry_id, title, content, revision_number, date_created
+			FROM entry_revision
+			ORDER BY entry_id, revision_number DESC
+		) er ON e.id = er.entry_id
+		LEFT JOIN entry_revision_attributes era ON era.entry_revision_id = er.id
+		WHERE ST_Intersects(
+			COALESCE(e.footprint, e.location)::geometry,
+			ST_MakeEnvelope($1, $2, $3, $4, 4326)
+		)
+		AND e.archived_at IS NULL
+		AND e.hidden_at IS NULL
+		AND ($5::int IS NULL OR e.id > $5)
+		AND %s
+		ORDER BY e.id
+		LIMIT $6
+	`, b.clause()), b.args...)
 	if err != nil {
 		messages.InternalServerError(c, err)
 		return
@@ -206,10 +318,12 @@ func RetrieveEntriesWithinVisibleBounds(c *gin.Context, db *sql.DB) {
 	defer rows.Close()
 
 	var entries []data.Entry
+	var entryRevisionIds []int
 
 	for rows.Next() {
 		var entry data.Entry
 		var entryRevisionId int
+		var footprintGeoJSON sql.NullString
 
 		err := rows.Scan(
 			&entry.ID,
@@ -224,51 +338,277 @@ func RetrieveEntriesWithinVisibleBounds(c *gin.Context, db *sql.DB) {
 			&entry.Title,
 			&entry.Longitude,
 			&entry.Latitude,
+			&footprintGeoJSON,
 		)
 		if err != nil {
 			messages.InternalServerError(c, err)
 			return
 		}
 
-		var tags []data.Tag
+		if footprintGeoJSON.Valid {
+			entry.Footprint = json.RawMessage(footprintGeoJSON.String)
+		}
+
+		entries = append(entries, entry)
+		entryRevisionIds = append(entryRevisionIds, entryRevisionId)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	entries, more := pagination.Trim(entries, limit)
+	entryRevisionIds, _ = pagination.Trim(entryRevisionIds, limit)
 
-		tagRows, err := db.Query(`
-					SELECT tags.name, tags.classification
-					FROM tags
-					JOIN tags_entry_revision ON tags.id = tags_entry_revision.tag_id
-					WHERE tags_entry_revision.entry_revision_id = $1
-			`, entryRevisionId)
+	tagsByRevision, err := retrieveTagsForEntryRevisions(db, entryRevisionIds)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	attributesByRevision, err := attributes.RetrieveForEntryRevisions(db, entryRevisionIds)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	for i, entryRevisionId := range entryRevisionIds {
+		entries[i].Tags = tagsByRevision[entryRevisionId]
+		entries[i].Attributes = attributesByRevision[entryRevisionId]
+		entries[i].ContentHTML = markdown.Render(entries[i].Content)
+	}
+
+	var next *pagination.Cursor
+	if more {
+		last := entries[len(entries)-1]
+		next = &pagination.Cursor{Sort: boundsSort, ID: last.ID}
+	}
+
+	if bounds.Zoom != nil {
+		respondWithBoundsEntries(c, entries, next)
+		return
+	}
+
+	respondWithPage(c, paged, entries, next, http.StatusCreated)
+}
+
+func RetrieveEntry(c *gin.Context, db *sql.DB, viewTracker *views.Tracker, mediaStorage media.Storage) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	var entry data.Entry
+	var entryRevisionId int
+	var footprintGeoJSON sql.NullString
+	var archivedAt sql.NullString
+	var archiveReason sql.NullString
+	var hidden bool
+
+	err = db.QueryRow(`
+		SELECT e.id,
+			e.address,
+			er.id AS revision_id,
+			er.title,
+			er.content,
+			e.views,
+			(SELECT COUNT(*) FROM entry_watchers w WHERE w.entry_id = e.id) AS watchers,
+			e.date_created,
+			u.username,
+			u.first_name,
+			u.last_name,
+			ST_X(e.location::geometry) AS longitude,
+			ST_Y(e.location::geometry) AS latitude,
+			ST_AsGeoJSON(e.footprint) AS footprint,
+			e.archived_at,
+			e.archive_reason,
+			e.hidden_at IS NOT NULL,
+			e.locked_at IS NOT NULL
+		FROM entry e
+		JOIN users u ON e.creator_id = u.id
+		JOIN (
+			SELECT DISTINCT ON (entry_id) id, entry_id, title, content, revision_number
+			FROM entry_revision
+			WHERE entry_id = $1
+			ORDER BY entry_id, revision_number DESC
+		) er ON e.id = er.entry_id
+		WHERE e.id = $1
+	`, entryID).Scan(
+		&entry.ID,
+		&entry.Address,
+		&entryRevisionId,
+		&entry.Title,
+		&entry.Content,
+		&entry.Views,
+		&entry.Watchers,
+		&entry.DateCreated,
+		&entry.Username,
+		&entry.FirstName,
+		&entry.LastName,
+		&entry.Longitude,
+		&entry.Latitude,
+		&footprintGeoJSON,
+		&archivedAt,
+		&archiveReason,
+		&hidden,
+		&entry.Locked,
+	)
+	if err == sql.ErrNoRows {
+		targetID, redirected, err := retrieveEntryRedirect(db, entryID)
 		if err != nil {
 			messages.InternalServerError(c, err)
 			return
 		}
-		defer tagRows.Close()
 
-		for tagRows.Next() {
-			var tag data.Tag
+		if !redirected {
+			messages.StatusNotFound(c, errors.New("Entry not found"))
+			return
+		}
+
+		c.Header("Location", "/entries/"+strconv.Itoa(targetID))
+		c.JSON(http.StatusMovedPermanently, gin.H{
+			"redirect_to": targetID,
+		})
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
 
-			err := tagRows.Scan(
-				&tag.Name,
-				&tag.Classification,
-			)
-			if err != nil {
-				messages.InternalServerError(c, err)
-			}
+	if archivedAt.Valid {
+		c.JSON(http.StatusGone, data.EntryTombstone{
+			ID:            entry.ID,
+			Archived:      true,
+			ArchivedAt:    archivedAt.String,
+			ArchiveReason: archiveReason.String,
+		})
+		return
+	}
 
-			tags = append(tags, tag)
+	if hidden {
+		_, role, _ := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+		if !utils.IsModerator(role) {
+			messages.StatusNotFound(c, errors.New("Entry is hidden pending review"))
+			return
 		}
+	}
 
-		entry.Tags = tags
+	entry.ContentHTML = markdown.Render(entry.Content)
 
-		entries = append(entries, entry)
+	if footprintGeoJSON.Valid {
+		entry.Footprint = json.RawMessage(footprintGeoJSON.String)
 	}
 
-	if len(entries) == 0 {
-		messages.StatusNoContent(c, err)
+	entry.Tags, err = retrieveTagsForEntryRevision(db, entryRevisionId)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	entry.Media, err = media.RetrieveMediaForEntryRevision(db, mediaStorage, entryRevisionId)
+	if err != nil {
+		messages.InternalServerError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, entries)
+	entry.Attributes, err = attributes.RetrieveForEntryRevision(db, entryRevisionId)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	entry.Contributors, err = contributors.RetrieveForEntry(db, entry.ID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	entry.Relations, err = relations.RetrieveForEntry(db, entry.ID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM conversation WHERE entry_id = $1
+	`, entry.ID).Scan(&entry.NumberOfComments)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	entry.Upvotes, entry.Downvotes = utils.RetrieveNumberOfUpvotesAndDownvotesForTable("entry", entry.ID, db)
+
+	viewTracker.Record(entry.ID, views.ViewerKey(c, db), time.Now())
+
+	c.JSON(http.StatusOK, entry)
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func retrieveTagsForEntryRevision(db queryer, entryRevisionId int) ([]data.Tag, error) {
+	rows, err := db.Query(`
+		SELECT tags.name, tags.classification
+		FROM tags
+		JOIN tags_entry_revision ON tags.id = tags_entry_revision.tag_id
+		WHERE tags_entry_revision.entry_revision_id = $1
+	`, entryRevisionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []data.Tag
+
+	for rows.Next() {
+		var tag data.Tag
+
+		if err := rows.Scan(&tag.Name, &tag.Classification); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// retrieveTagsForEntryRevisions loads the tags of several revisions at once.
+func retrieveTagsForEntryRevisions(db queryer, entryRevisionIds []int) (map[int][]data.Tag, error) {
+	result := make(map[int][]data.Tag)
+
+	if len(entryRevisionIds) == 0 {
+		return result, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT tags_entry_revision.entry_revision_id, tags.name, tags.classification
+		FROM tags
+		JOIN tags_entry_revision ON tags.id = tags_entry_revision.tag_id
+		WHERE tags_entry_revision.entry_revision_id = ANY($1)
+	`, pq.Array(entryRevisionIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entryRevisionId int
+		var tag data.Tag
+
+		if err := rows.Scan(&entryRevisionId, &tag.Name, &tag.Classification); err != nil {
+			return nil, err
+		}
+
+		result[entryRevisionId] = append(result[entryRevisionId], tag)
+	}
+
+	return result, rows.Err()
 }
 
 func RetrieveCity(c *gin.Context, db *sql.DB) {
@@ -338,136 +678,83 @@ func RetrieveFeed(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	location := query.Location
-	distance := query.Distance
-
-	jsonFile, err := os.Open("/app/static/us_cities.json")
-	if err != nil {
-		messages.InternalServerError(c, err)
+	if err := validateEntryFilter(query.EntryFilter); err != nil {
+		messages.StatusBadRequest(c, err)
 		return
 	}
 
-	defer jsonFile.Close()
-
-	byteValue, _ := io.ReadAll(jsonFile)
-
-	var cities []data.City
+	longitude, latitude, ok := feedCenter(c, db, query)
+	if !ok {
+		return
+	}
 
-	err = json.Unmarshal(byteValue, &cities)
+	params, err := newFeedParams(query, longitude, latitude)
 	if err != nil {
-		messages.InternalServerError(c, err)
+		messages.StatusBadRequest(c, err)
 		return
 	}
 
-	var city data.City
-
-	for _, c := range cities {
-		if c.Name == location {
-			city = c
-			break
-		}
-	}
+	paged := pageRequested(query.Cursor, query.Limit)
+	params.Limit = pageLimit(paged, query.Limit)
 
-	if city.Name == "" {
-		messages.StatusNoContent(c, errors.New("Unable to find city matching location."))
+	page, err := queryFeed(db, params)
+	if err != nil {
+		messages.InternalServerError(c, err)
 		return
 	}
 
-	rows, err := db.Query(`
-		SELECT e.id AS id,
-			e.address,
-			er.title,
-			er.content,
-			e.views,
-			e.date_created,
-			u.username,
-			u.first_name,
-			u.last_name,
-			ST_X(e.location::geometry) AS longitude,
-			ST_Y(e.location::geometry) AS latitude
-		FROM entry e
-		JOIN users u ON e.creator_id = u.id
-		JOIN (
-			SELECT DISTINCT ON (entry_id) entry_id, title, content, revision_number, date_created
-			FROM entry_revision
-			ORDER BY entry_id, revision_number DESC
-		) er ON e.id = er.entry_id
-		WHERE ST_DWithin(
-			e.location,
-			ST_MakePoint($1, $2)::geography,
-			$3 * 1609.34
-		)
-		ORDER BY e.date_created DESC;
-	`, city.Longitude, city.Latitude, distance)
+	attributesByRevision, err := attributes.RetrieveForEntryRevisions(db, page.EntryRevisionIds)
 	if err != nil {
 		messages.InternalServerError(c, err)
 		return
 	}
 
-	defer rows.Close()
+	for i, entryRevisionId := range page.EntryRevisionIds {
+		page.Entries[i].Attributes = attributesByRevision[entryRevisionId]
+		page.Entries[i].ContentHTML = markdown.Render(page.Entries[i].Content)
+	}
 
-	var entries []data.Entry
+	var next *pagination.Cursor
+	if page.More {
+		next = params.nextCursor(page.Entries[len(page.Entries)-1], page.LastKey)
+	}
 
-	for rows.Next() {
+	respondWithPage(c, paged, page.Entries, next, http.StatusOK)
+}
 
-		var entry data.Entry
-		err := rows.Scan(&entry.ID,
-			&entry.Address,
-			&entry.Title,
-			&entry.Content,
-			&entry.Views,
-			&entry.DateCreated,
-			&entry.Username,
-			&entry.FirstName,
-			&entry.LastName,
-			&entry.Longitude,
-			&entry.Latitude)
-		if err != nil {
-			messages.InternalServerError(c, err)
-			return
-		}
+// retrieveCityByName finds a city by name, ignoring case. "Springfield, IL"
+// or "Springfield, Illinois" picks the one in that state.
+func retrieveCityByName(name string) (data.City, error) {
+	var city data.City
 
-		entries = append(entries, entry)
+	jsonFile, err := os.Open("/app/static/us_cities.json")
+	if err != nil {
+		return city, err
 	}
 
-	if err := rows.Err(); err != nil {
-		messages.InternalServerError(c, err)
-		return
+	defer jsonFile.Close()
+
+	var cities []data.City
+
+	if err := json.NewDecoder(jsonFile).Decode(&cities); err != nil {
+		return city, err
 	}
 
-	for i, entry := range entries {
-		var upvotes, downvotes int
+	cityName, state, hasState := strings.Cut(name, ",")
+	cityName = strings.TrimSpace(cityName)
+	state = strings.TrimSpace(state)
 
-		err = db.QueryRow(`
-			SELECT COUNT(*) as number_of_upvotes
-			FROM entry_interactions
-			WHERE entry_id = $1 AND interaction_type = 'upvote'
-		`, entry.ID).Scan(&upvotes)
-		if err != nil {
-			messages.InternalServerError(c, err)
-			return
+	for _, candidate := range cities {
+		if !strings.EqualFold(candidate.Name, cityName) {
+			continue
 		}
 
-		err = db.QueryRow(`
-			SELECT COUNT(*) as number_of_downvotes
-			FROM entry_interactions
-			WHERE entry_id = $1 AND interaction_type = 'downvote'
-		`, entry.ID).Scan(&downvotes)
-		if err != nil {
-			messages.InternalServerError(c, err)
-			return
+		if !hasState || strings.EqualFold(candidate.StateId, state) || strings.EqualFold(candidate.StateName, state) {
+			return candidate, nil
 		}
-
-		entries[i].Upvotes = upvotes
-		entries[i].Downvotes = downvotes
-	}
-
-	if len(entries) == 0 {
-		messages.StatusNoContent(c, errors.New("No entries found"))
-		return
 	}
 
-	c.JSON(http.StatusOK, entries)
+	return city, nil
 }
 
 func VoteEntry(c *gin.Context, db *sql.DB) {
@@ -495,15 +782,27 @@ func VoteEntry(c *gin.Context, db *sql.DB) {
 
 	var req data.VoteRequest
 
-	if err := c.ShouldBindJSON(req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil {
 		messages.StatusBadRequest(c, err)
 		return
 	}
 
+	entryID, err := strconv.Atoi(req.EntryID)
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
 	var currentInteraction string
-	entryID := req.EntryID
 
-	err = db.QueryRow(`
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
 		SELECT interaction_type
 		FROM entry_interactions
 		WHERE user_id = $1 AND entry_id = $2
@@ -514,19 +813,22 @@ func VoteEntry(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	newInteraction := req.InteractionType
+
 	if currentInteraction == req.InteractionType {
-		_, err = db.Exec(`
+		newInteraction = ""
+		_, err = tx.Exec(`
 			DELETE FROM entry_interactions 
 			WHERE user_id = $1 AND entry_id = $2
 		`, userID, entryID)
 	} else if currentInteraction != "" {
-		_, err = db.Exec(`
+		_, err = tx.Exec(`
 			UPDATE entry_interactions
 			SET interaction_type = $3, created_at = CURRENT_TIMESTAMP
 			WHERE user_id = $1 AND entry_id = $2
 		`, userID, entryID, req.InteractionType)
 	} else {
-		_, err = db.Exec(`
+		_, err = tx.Exec(`
 			INSERT INTO entry_interactions (entry_id, user_id, interaction_type)
 			VALUES ($1, $2, $3)
 		`, entryID, userID, req.InteractionType)
@@ -537,6 +839,24 @@ func VoteEntry(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "entry.vote",
+		TargetType: "entry",
+		TargetID:   entryID,
+		Before:     gin.H{"interaction": currentInteraction},
+		After:      gin.H{"interaction": newInteraction},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
 	var updatedInteractionType string
 	err = db.QueryRow(`
 			SELECT interaction_type
@@ -586,10 +906,36 @@ func EditEntry(c *gin.Context, db *sql.DB) {
 	var req data.EditEntryRequest
 	var username string
 	var userID int
-	var entryRevisionId int
+	var role string
 
-	if err := c.ShouldBindJSON(req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil {
 		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if len(req.NewContent) > markdown.MaxSourceLength {
+		messages.StatusBadRequest(c, errors.New("Content is too long"))
+		return
+	}
+
+	// an absent footprint carries over from the previous revision, an explicit
+	// null clears it
+	var newGeometry string
+	carryFootprint := len(req.NewFootprint) == 0
+
+	if !carryFootprint && !footprint.IsNull(req.NewFootprint) {
+		var err error
+
+		newGeometry, err = footprint.Parse(req.NewFootprint)
+		if err != nil {
+			messages.StatusBadRequest(c, err)
+			return
+		}
+
+		if err := footprint.Validate(db, newGeometry); err != nil {
+			messages.StatusBadRequest(c, err)
+			return
+		}
 	}
 
 	cookie, err := c.Cookie("access_token")
@@ -601,8 +947,8 @@ func EditEntry(c *gin.Context, db *sql.DB) {
 	}
 
 	err = db.QueryRow(`
-		SELECT id FROM users WHERE username = $1
-	`, username).Scan(&userID)
+		SELECT id, role FROM users WHERE username = $1
+	`, username).Scan(&userID, &role)
 	if err != nil {
 		messages.InternalServerError(c, err)
 		return
@@ -621,20 +967,81 @@ func EditEntry(c *gin.Context, db *sql.DB) {
 		}
 	}()
 
+	var previousRevisionId int
+	var previousTitle string
+	var locked bool
+
 	err = tx.QueryRow(`
-		WITH revision_number AS (
-			SELECT COUNT(*) + 1 AS revision_number FROM entry_revision WHERE entry_id = $1
-		)
-		INSERT INTO entry_revision (entry_id, title, content, revision_number, creator_id)
-		SELECT $1, $2, $3, revision_number, $4 FROM revision_number
-		RETURNING id
-	`, req.EntryID, req.NewTitle, req.NewContent, userID).Scan(&entryRevisionId)
+		SELECT er.id, COALESCE(er.title, ''), e.locked_at IS NOT NULL
+		FROM entry e
+		JOIN entry_revision er ON er.entry_id = e.id
+		WHERE e.id = $1
+		ORDER BY er.revision_number DESC
+		LIMIT 1
+		FOR UPDATE OF e
+	`, req.EntryID).Scan(&previousRevisionId, &previousTitle, &locked)
+	if err == sql.ErrNoRows {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
 	if err != nil {
 		messages.InternalServerError(c, err)
 		return
 	}
 
-	err = utils.InsertTagAndEntryRevisionAssociation(tx, entryRevisionId, req.NewTags)
+	if locked && !utils.IsModerator(role) {
+		err = ErrEntryLocked
+		messages.StatusForbidden(c, err)
+		return
+	}
+
+	// attributes left out of the edit carry over from the previous revision,
+	// but still have to hold up against the new tags
+	newAttributes := req.NewAttributes
+	if newAttributes == nil {
+		newAttributes, err = attributes.RetrieveForEntryRevision(tx, previousRevisionId)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+	}
+
+	err = attributes.Validate(newAttributes, req.NewTags)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if carryFootprint {
+		err = tx.QueryRow(`
+			SELECT COALESCE(ST_AsGeoJSON(footprint), '') FROM entry_revision WHERE id = $1
+		`, previousRevisionId).Scan(&newGeometry)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+	}
+
+	revisionID, err := appendRevision(tx, req.EntryID, previousRevisionId, userID, newRevision{
+		Title:      req.NewTitle,
+		Content:    req.NewContent,
+		Tags:       req.NewTags,
+		Attributes: newAttributes,
+		Geometry:   newGeometry,
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "entry.edit",
+		TargetType: "entry",
+		TargetID:   req.EntryID,
+		Before:     gin.H{"revision_id": previousRevisionId, "title": previousTitle},
+		After:      gin.H{"revision_id": revisionID, "title": req.NewTitle},
+	})
 	if err != nil {
 		messages.InternalServerError(c, err)
 		return
@@ -642,3 +1049,160 @@ func EditEntry(c *gin.Context, db *sql.DB) {
 
 	messages.StatusOk(c, "Entry edited successfully!")
 }
+
+type newRevision struct {
+	Title      string
+	Content    string
+	Tags       []structs.Tag
+	Attributes *data.EntryAttributes
+	Geometry   string
+}
+
+// insertEntry creates an entry with its first revision and credits the user
+// as a contributor.
+func insertEntry(
+	tx *sql.Tx,
+	userID int,
+	address string,
+	longitude float64,
+	latitude float64,
+	revision newRevision,
+) (int, int, error) {
+	var entryID, entryRevisionId int
+
+	err := tx.QueryRow(`
+		WITH entry_insert AS (
+			INSERT INTO entry (address, creator_id, location) 
+			VALUES ($2, $3, ST_SetSRID(ST_MakePoint($4, $5), 4326))
+			RETURNING id
+		),
+		revision_number AS (
+			SELECT COUNT(*) + 1 AS revision_number FROM entry_revision WHERE entry_id = (SELECT id FROM entry_insert)
+		)
+		INSERT INTO entry_revision (entry_id, title, content, revision_number, creator_id)
+		SELECT (SELECT id FROM entry_insert), $1, $6, (SELECT revision_number FROM revision_number), $3
+		RETURNING id, entry_id
+		`, revision.Title, address, userID, longitude, latitude, revision.Content).Scan(&entryRevisionId, &entryID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := utils.InsertTagAndEntryRevisionAssociation(tx, entryRevisionId, revision.Tags); err != nil {
+		return 0, 0, err
+	}
+
+	if err := attributes.Insert(tx, entryRevisionId, revision.Attributes); err != nil {
+		return 0, 0, err
+	}
+
+	if revision.Geometry != "" {
+		if err := footprint.Apply(tx, entryID, entryRevisionId, revision.Geometry); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if err := contributors.Record(tx, entryID, userID); err != nil {
+		return 0, 0, err
+	}
+
+	if err := search.IndexEntry(tx, entryID); err != nil {
+		return 0, 0, err
+	}
+
+	return entryID, entryRevisionId, nil
+}
+
+// appendRevision adds a revision on top of previousRevisionId. The gallery
+// carries over unchanged, the revision's footprint becomes the entry's, and
+// watchers hear about it, with a Progress change taking precedence over a
+// plain edit.
+func appendRevision(
+	tx *sql.Tx,
+	entryID int,
+	previousRevisionId int,
+	userID int,
+	revision newRevision,
+) (int, error) {
+	var entryRevisionId, revisionNumber int
+
+	previousTags, err := retrieveTagsForEntryRevision(tx, previousRevisionId)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow(`
+		WITH revision_number AS (
+			SELECT COUNT(*) + 1 AS revision_number FROM entry_revision WHERE entry_id = $1
+		)
+		INSERT INTO entry_revision (entry_id, title, content, revision_number, creator_id)
+		SELECT $1, $2, $3, revision_number, $4 FROM revision_number
+		RETURNING id, revision_number
+	`, entryID, revision.Title, revision.Content, userID).Scan(&entryRevisionId, &revisionNumber)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := utils.InsertTagAndEntryRevisionAssociation(tx, entryRevisionId, revision.Tags); err != nil {
+		return 0, err
+	}
+
+	if err := attributes.Insert(tx, entryRevisionId, revision.Attributes); err != nil {
+		return 0, err
+	}
+
+	if err := footprint.Apply(tx, entryID, entryRevisionId, revision.Geometry); err != nil {
+		return 0, err
+	}
+
+	if err := contributors.Record(tx, entryID, userID); err != nil {
+		return 0, err
+	}
+
+	if err := search.IndexEntry(tx, entryID); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO entry_revision_media (entry_revision_id, media_id, position)
+		SELECT $1, media_id, position
+		FROM entry_revision_media
+		WHERE entry_revision_id = $2
+	`, entryRevisionId, previousRevisionId)
+	if err != nil {
+		return 0, err
+	}
+
+	var previousStatuses, newStatuses []string
+
+	for _, tag := range previousTags {
+		if tag.Classification == "Progress" {
+			previousStatuses = append(previousStatuses, tag.Name)
+		}
+	}
+
+	for _, tag := range revision.Tags {
+		if tag.Classification == "Progress" {
+			newStatuses = append(newStatuses, tag.Name)
+		}
+	}
+
+	previousProgress := furthestProgress(previousStatuses)
+	newProgress := furthestProgress(newStatuses)
+
+	if newProgress != "" && newProgress != previousProgress {
+		err = notifications.Notify(tx, entryID, userID, notifications.TypeProgress, gin.H{
+			"revision_number": revisionNumber,
+			"from":            previousProgress,
+			"to":              newProgress,
+		})
+	} else {
+		err = notifications.Notify(tx, entryID, userID, notifications.TypeRevision, gin.H{
+			"revision_number": revisionNumber,
+		})
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return entryRevisionId, nil
+}
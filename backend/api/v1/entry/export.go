@@ -0,0 +1,223 @@
+package entry
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	data "backend/api/v1/data"
+	export "backend/api/v1/export"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+// exportFlushInterval is how many entries are written between flushes.
+const exportFlushInterval = 100
+
+// ExportEntries streams every entry matching a bounding box, a city and
+// radius, or a tag filter as GeoJSON, CSV or KML. Rows are written as they are
+// read from the database, so exports of any size use constant memory.
+func ExportEntries(c *gin.Context, db *sql.DB) {
+	var query data.ExportQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	bounds := []*float64{query.West, query.South, query.East, query.North}
+	boundsGiven := 0
+	for _, side := range bounds {
+		if side != nil {
+			boundsGiven++
+		}
+	}
+
+	if boundsGiven != 0 && boundsGiven != len(bounds) {
+		messages.StatusBadRequest(c, errors.New("A bounding box needs north, south, east and west"))
+		return
+	}
+
+	if (query.Location == "") != (query.Distance == nil) {
+		messages.StatusBadRequest(c, errors.New("A city filter needs location and distance"))
+		return
+	}
+
+	if boundsGiven == 0 && query.Location == "" && len(query.Tags) == 0 {
+		messages.StatusBadRequest(c, errors.New("Export needs a bounding box, a city and distance, or a tag"))
+		return
+	}
+
+	var cityLongitude, cityLatitude *float64
+
+	if query.Location != "" {
+		city, err := retrieveCityByName(query.Location)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		if city.Name == "" {
+			messages.StatusNotFound(c, errors.New("Unable to find city matching location."))
+			return
+		}
+
+		cityLongitude, cityLatitude = &city.Longitude, &city.Latitude
+	}
+
+	var distance *float64
+	if query.Distance != nil {
+		meters := utils.DistanceMeters(*query.Distance, query.Unit)
+		distance = &meters
+	}
+
+	var tags any
+	if len(query.Tags) > 0 {
+		tags = pq.Array(query.Tags)
+	}
+
+	rows, err := db.Query(`
+		SELECT e.id,
+			er.title,
+			e.address,
+			er.content,
+			er.revision_number,
+			er.date_created,
+			e.date_created,
+			u.username,
+			ST_X(e.location::geometry),
+			ST_Y(e.location::geometry),
+			ST_AsGeoJSON(e.footprint),
+			ST_AsKML(e.footprint),
+			t.tags,
+			(SELECT COUNT(*) FROM entry_interactions ei WHERE ei.entry_id = e.id AND ei.interaction_type = 'upvote'),
+			(SELECT COUNT(*) FROM entry_interactions ei WHERE ei.entry_id = e.id AND ei.interaction_type = 'downvote')
+		FROM entry e
+		JOIN users u ON e.creator_id = u.id
+		JOIN (
+			SELECT DISTINCT ON (entry_id) id, entry_id, title, content, revision_number, date_created
+			FROM entry_revision
+			ORDER BY entry_id, revision_number DESC
+		) er ON e.id = er.entry_id
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(
+				json_agg(json_build_object('name', tags.name, 'classification', tags.classification)
+					ORDER BY tags.classification, tags.name),
+				'[]'
+			) AS tags
+			FROM tags
+			JOIN tags_entry_revision ter ON ter.tag_id = tags.id
+			WHERE ter.entry_revision_id = er.id
+		) t
+		WHERE e.archived_at IS NULL
+		AND e.hidden_at IS NULL
+		AND ($1::float8 IS NULL OR ST_Intersects(
+			COALESCE(e.footprint, e.location)::geometry,
+			ST_MakeEnvelope($1, $2, $3, $4, 4326)
+		))
+		AND ($5::float8 IS NULL OR ST_DWithin(
+			COALESCE(e.footprint, e.location),
+			ST_MakePoint($5, $6)::geography,
+			$7
+		))
+		AND ($8::text[] IS NULL OR EXISTS (
+			SELECT 1
+			FROM tags_entry_revision ter
+			JOIN tags ON tags.id = ter.tag_id
+			WHERE ter.entry_revision_id = er.id AND tags.name = ANY($8)
+		))
+		ORDER BY e.id
+	`,
+		query.West,
+		query.South,
+		query.East,
+		query.North,
+		cityLongitude,
+		cityLatitude,
+		distance,
+		tags,
+	)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	writer, err := export.NewWriter(query.Format, c.Writer)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	c.Header("Content-Type", export.ContentType(query.Format))
+	c.Header("Content-Disposition", `attachment; filename="`+export.Filename(query.Format)+`"`)
+	c.Status(http.StatusOK)
+
+	// Once the first byte is out the status can no longer change, so errors
+	// from here on are logged and the response is cut short.
+	if err := writer.Begin(); err != nil {
+		log.Printf("Failed to export entries: %v", err)
+		return
+	}
+
+	for written := 1; rows.Next(); written++ {
+		var entry data.ExportEntry
+		var footprintGeoJSON, footprintKML sql.NullString
+		var tagsJSON []byte
+
+		err := rows.Scan(
+			&entry.ID,
+			&entry.Title,
+			&entry.Address,
+			&entry.Content,
+			&entry.RevisionNumber,
+			&entry.RevisionDateCreated,
+			&entry.DateCreated,
+			&entry.Username,
+			&entry.Longitude,
+			&entry.Latitude,
+			&footprintGeoJSON,
+			&footprintKML,
+			&tagsJSON,
+			&entry.Upvotes,
+			&entry.Downvotes,
+		)
+		if err != nil {
+			log.Printf("Failed to export entries: %v", err)
+			return
+		}
+
+		if footprintGeoJSON.Valid {
+			entry.Footprint = json.RawMessage(footprintGeoJSON.String)
+		}
+		entry.FootprintKML = footprintKML.String
+
+		if err := json.Unmarshal(tagsJSON, &entry.Tags); err != nil {
+			log.Printf("Failed to export entries: %v", err)
+			return
+		}
+
+		if err := writer.Write(entry); err != nil {
+			log.Printf("Failed to export entries: %v", err)
+			return
+		}
+
+		if written%exportFlushInterval == 0 {
+			c.Writer.Flush()
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Failed to export entries: %v", err)
+		return
+	}
+
+	if err := writer.End(); err != nil {
+		log.Printf("Failed to export entries: %v", err)
+	}
+}
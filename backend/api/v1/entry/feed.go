@@ -0,0 +1,425 @@
+package entry
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	pagination "backend/api/v1/pagination"
+	users "backend/api/v1/users"
+	utils "backend/api/v1/utils"
+)
+
+const (
+	SortNew       = "new"
+	SortTop       = "top"
+	SortHot       = "hot"
+	SortDiscussed = "discussed"
+	SortNearest   = "nearest"
+)
+
+const defaultTopWindow = "week"
+
+// hotGravity is how quickly hot entries sink as they age, the exponent in
+// score / (hours + 2)^gravity.
+const hotGravity = 1.8
+
+// topWindows are the periods the top sort counts votes over, as PostgreSQL
+// intervals. An empty interval counts every vote.
+var topWindows = map[string]string{
+	"day":   "1 day",
+	"week":  "7 days",
+	"month": "30 days",
+	"year":  "365 days",
+	"all":   "",
+}
+
+// maxFeedDistance caps how far from its center the feed reaches, in meters.
+const maxFeedDistance = 100 * utils.MetersPerMile
+
+var ErrFeedDistanceTooFar = errors.New("Distance can be at most 100 miles (160 km)")
+
+// distanceMeters converts a feed distance in miles, or kilometers when unit
+// is km, to meters.
+func distanceMeters(distance float64, unit string) (float64, error) {
+	meters := utils.DistanceMeters(distance, unit)
+
+	if !(meters > 0) {
+		return 0, errors.New("Distance must be a positive number")
+	}
+	if meters > maxFeedDistance {
+		return 0, ErrFeedDistanceTooFar
+	}
+
+	return meters, nil
+}
+
+const (
+	centerLocation    = "location"
+	centerCoordinates = "coordinates"
+	centerHome        = "home"
+)
+
+// feedCenterKind reports which of the ways to center the feed a query uses.
+// It has to use exactly one.
+func feedCenterKind(query data.FeedQuery) (string, error) {
+	var kinds []string
+
+	if query.Location != "" {
+		kinds = append(kinds, centerLocation)
+	}
+	if query.Latitude != nil || query.Longitude != nil {
+		if query.Latitude == nil || query.Longitude == nil {
+			return "", errors.New("Give both lat and lon")
+		}
+		kinds = append(kinds, centerCoordinates)
+	}
+	if query.Near == centerHome {
+		kinds = append(kinds, centerHome)
+	}
+
+	if len(kinds) != 1 {
+		return "", errors.New("Center the feed on one of location, lat and lon, or near=home")
+	}
+
+	return kinds[0], nil
+}
+
+// feedCenter returns the longitude and latitude the feed is centered on. When
+// it can't, it responds to the client itself and returns false.
+func feedCenter(c *gin.Context, db *sql.DB, query data.FeedQuery) (float64, float64, bool) {
+	kind, err := feedCenterKind(query)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return 0, 0, false
+	}
+
+	switch kind {
+	case centerCoordinates:
+		return *query.Longitude, *query.Latitude, true
+
+	case centerHome:
+		userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+		if err != nil {
+			messages.StatusUnauthorized(c, err)
+			return 0, 0, false
+		}
+
+		home, err := users.RetrieveHomeLocation(db, userID)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return 0, 0, false
+		}
+
+		if home == nil {
+			messages.StatusNotFound(c, errors.New("No home location saved"))
+			return 0, 0, false
+		}
+
+		return home.Longitude, home.Latitude, true
+	}
+
+	city, err := retrieveCityByName(query.Location)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return 0, 0, false
+	}
+
+	if city.Name == "" {
+		messages.StatusNoContent(c, errors.New("Unable to find city matching location."))
+		return 0, 0, false
+	}
+
+	return city.Longitude, city.Latitude, true
+}
+
+// feedSortSpec ranks feed entries by a float8 SQL expression over the ranked
+// query's columns. Ties are broken by entry id in the same direction.
+type feedSortSpec struct {
+	key       string
+	ascending bool
+}
+
+var feedSorts = map[string]feedSortSpec{
+	SortNew: {key: `EXTRACT(EPOCH FROM e.date_created)::float8`},
+	SortTop: {key: `votes.window_score::float8`},
+	SortHot: {key: fmt.Sprintf(
+		`(votes.upvotes - votes.downvotes)::float8
+			/ power(GREATEST(EXTRACT(EPOCH FROM ($4::timestamptz - e.date_created))::float8, 0) / 3600 + 2, %g)`,
+		hotGravity,
+	)},
+	SortDiscussed: {key: `discussion.comments::float8`},
+	SortNearest: {
+		key:       `ST_Distance(COALESCE(e.footprint, e.location), ST_MakePoint($1, $2)::geography)`,
+		ascending: true,
+	},
+}
+
+// feedCursorSort names the order a feed cursor belongs to. Top cursors carry
+// their window, a score over a week means nothing over a year.
+func feedCursorSort(sort string, window string) string {
+	if sort == SortTop {
+		return sort + ":" + window
+	}
+
+	return sort
+}
+
+// feedParams is a feed query within Distance meters of a center point. At pins the time the
+// first page was read so time-based scores and the set of entries stay the
+// same from page to page. The query compares it as a timestamptz, the
+// TIMESTAMP columns hold the database's local time.
+type feedParams struct {
+	Query     data.FeedQuery
+	Longitude float64
+	Latitude  float64
+	Distance  float64
+	Sort      string
+	Window    string
+	Cursor    *pagination.Cursor
+	At        time.Time
+	Limit     int
+}
+
+// newFeedParams resolves the distance, sort, window and cursor of a feed
+// query.
+func newFeedParams(query data.FeedQuery, longitude float64, latitude float64) (feedParams, error) {
+	distance, err := distanceMeters(query.Distance, query.Unit)
+	if err != nil {
+		return feedParams{}, err
+	}
+
+	params := feedParams{
+		Query:     query,
+		Longitude: longitude,
+		Latitude:  latitude,
+		Distance:  distance,
+		Sort:      query.Sort,
+		Window:    query.Window,
+		At:        time.Now().UTC(),
+	}
+
+	if params.Sort == "" {
+		params.Sort = SortNew
+	}
+	if params.Window == "" {
+		params.Window = defaultTopWindow
+	}
+
+	if _, ok := feedSorts[params.Sort]; !ok {
+		return params, fmt.Errorf("unknown sort %q", params.Sort)
+	}
+	if _, ok := topWindows[params.Window]; !ok {
+		return params, fmt.Errorf("unknown window %q", params.Window)
+	}
+
+	cursor, err := pagination.Decode(query.Cursor, feedCursorSort(params.Sort, params.Window))
+	if err != nil {
+		return params, err
+	}
+
+	if cursor != nil {
+		if _, err := strconv.ParseFloat(cursor.Key, 64); err != nil {
+			return params, pagination.ErrInvalidCursor
+		}
+
+		at, err := time.Parse(time.RFC3339Nano, cursor.At)
+		if err != nil {
+			return params, pagination.ErrInvalidCursor
+		}
+
+		params.At = at
+	}
+
+	params.Cursor = cursor
+
+	return params, nil
+}
+
+func (params feedParams) cursorKey() any {
+	if params.Cursor == nil {
+		return nil
+	}
+
+	key, _ := strconv.ParseFloat(params.Cursor.Key, 64)
+	return key
+}
+
+func (params feedParams) windowInterval() any {
+	if params.Sort != SortTop || topWindows[params.Window] == "" {
+		return nil
+	}
+
+	return topWindows[params.Window]
+}
+
+func (params feedParams) nextCursor(entry data.Entry, key float64) *pagination.Cursor {
+	return &pagination.Cursor{
+		Sort: feedCursorSort(params.Sort, params.Window),
+		Key:  strconv.FormatFloat(key, 'g', -1, 64),
+		ID:   entry.ID,
+		At:   params.At.Format(time.RFC3339Nano),
+	}
+}
+
+// feedPage is one page of the feed, with the latest revision of each entry
+// and the sort key of the last one.
+type feedPage struct {
+	Entries          []data.Entry
+	EntryRevisionIds []int
+	More             bool
+	LastKey          float64
+}
+
+// queryFeed ranks the entries within the query's distance of the center in
+// SQL, so every sort pages the same way: by its key, then by id.
+func queryFeed(db queryer, params feedParams) (feedPage, error) {
+	var page feedPage
+
+	spec := feedSorts[params.Sort]
+	direction, comparison := "DESC", "<"
+	if spec.ascending {
+		direction, comparison = "ASC", ">"
+	}
+
+	limit := params.Limit
+
+	b := newQueryBuilder(
+		params.Longitude,
+		params.Latitude,
+		params.Distance,
+		params.At,
+		params.windowInterval(),
+		params.cursorKey(),
+		params.Cursor.IDArg(),
+		pagination.LimitArg(limit),
+	)
+	addEntryFilter(b, params.Query.EntryFilter)
+
+	rows, err := db.Query(fmt.Sprintf(`
+		WITH ranked AS (
+			SELECT e.id AS id,
+				e.address,
+				er.id AS revision_id,
+				er.title,
+				er.content,
+				e.views,
+				(SELECT COUNT(*) FROM entry_watchers w WHERE w.entry_id = e.id) AS watchers,
+				e.date_created,
+				u.username,
+				u.first_name,
+				u.last_name,
+				ST_X(e.location::geometry) AS longitude,
+				ST_Y(e.location::geometry) AS latitude,
+				ST_AsGeoJSON(e.footprint) AS footprint,
+				votes.upvotes,
+				votes.downvotes,
+				discussion.comments,
+				%s AS sort_key
+			FROM entry e
+			JOIN users u ON e.creator_id = u.id
+			JOIN (
+				SELECT DISTINCT ON (entry_id) id, entry_id, title, content, revision_number, date_created
+				FROM entry_revision
+				ORDER BY entry_id, revision_number DESC
+			) er ON e.id = er.entry_id
+			LEFT JOIN entry_revision_attributes era ON era.entry_revision_id = er.id
+			CROSS JOIN LATERAL (
+				SELECT COUNT(*) FILTER (WHERE ei.interaction_type = 'upvote') AS upvotes,
+					COUNT(*) FILTER (WHERE ei.interaction_type = 'downvote') AS downvotes,
+					COALESCE(SUM(CASE ei.interaction_type WHEN 'upvote' THEN 1 ELSE -1 END) FILTER (
+						WHERE $5::interval IS NULL OR ei.created_at >= $4::timestamptz - $5::interval
+					), 0) AS window_score
+				FROM entry_interactions ei
+				WHERE ei.entry_id = e.id AND ei.created_at <= $4::timestamptz
+			) votes
+			CROSS JOIN LATERAL (
+				SELECT COUNT(*) AS comments
+				FROM conversation conv
+				WHERE conv.entry_id = e.id AND conv.hidden_at IS NULL
+			) discussion
+			WHERE ST_DWithin(
+				COALESCE(e.footprint, e.location),
+				ST_MakePoint($1, $2)::geography,
+				$3
+			)
+			AND e.archived_at IS NULL
+			AND e.hidden_at IS NULL
+			AND e.date_created <= $4::timestamptz
+			AND %s
+		)
+		SELECT id, address, revision_id, title, content, views, watchers,
+			date_created, username, first_name, last_name, longitude, latitude,
+			footprint, upvotes, downvotes, comments, sort_key
+		FROM ranked
+		WHERE $6::float8 IS NULL OR (sort_key, id) %s ($6::float8, $7::int)
+		ORDER BY sort_key %s, id %s
+		LIMIT $8
+	`, spec.key, b.clause(), comparison, direction, direction), b.args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var keys []float64
+
+	for rows.Next() {
+		var entry data.Entry
+		var entryRevisionId int
+		var footprintGeoJSON sql.NullString
+		var key float64
+
+		err := rows.Scan(
+			&entry.ID,
+			&entry.Address,
+			&entryRevisionId,
+			&entry.Title,
+			&entry.Content,
+			&entry.Views,
+			&entry.Watchers,
+			&entry.DateCreated,
+			&entry.Username,
+			&entry.FirstName,
+			&entry.LastName,
+			&entry.Longitude,
+			&entry.Latitude,
+			&footprintGeoJSON,
+			&entry.Upvotes,
+			&entry.Downvotes,
+			&entry.NumberOfComments,
+			&key,
+		)
+		if err != nil {
+			return page, err
+		}
+
+		if footprintGeoJSON.Valid {
+			entry.Footprint = json.RawMessage(footprintGeoJSON.String)
+		}
+
+		page.Entries = append(page.Entries, entry)
+		page.EntryRevisionIds = append(page.EntryRevisionIds, entryRevisionId)
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	page.Entries, page.More = pagination.Trim(page.Entries, limit)
+	page.EntryRevisionIds, _ = pagination.Trim(page.EntryRevisionIds, limit)
+	keys, _ = pagination.Trim(keys, limit)
+
+	if len(keys) > 0 {
+		page.LastKey = keys[len(keys)-1]
+	}
+
+	return page, nil
+}
@@ -0,0 +1,336 @@
+package entry
+
+import (
+	"database/sql"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	data "backend/api/v1/data"
+	pagination "backend/api/v1/pagination"
+	utils "backend/api/v1/utils"
+)
+
+func TestFeedSortsCoverEveryMode(t *testing.T) {
+	for _, sort := range []string{SortNew, SortTop, SortHot, SortDiscussed, SortNearest} {
+		spec, ok := feedSorts[sort]
+		if !ok {
+			t.Errorf("no spec for %q", sort)
+			continue
+		}
+
+		if spec.ascending != (sort == SortNearest) {
+			t.Errorf("%q ascending = %v", sort, spec.ascending)
+		}
+	}
+}
+
+func TestNewFeedParamsDefaults(t *testing.T) {
+	params, err := newFeedParams(data.FeedQuery{Distance: 5}, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if params.Sort != SortNew || params.Window != defaultTopWindow || params.Cursor != nil {
+		t.Errorf("got %+v", params)
+	}
+
+	if params.windowInterval() != nil {
+		t.Error("only the top sort has a window")
+	}
+
+	params.Sort = SortTop
+	if params.windowInterval() != "7 days" {
+		t.Errorf("got window %v, want 7 days", params.windowInterval())
+	}
+
+	params.Window = "all"
+	if params.windowInterval() != nil {
+		t.Error("the all window should count every vote")
+	}
+}
+
+func TestNewFeedParamsResumesFromCursor(t *testing.T) {
+	first, err := newFeedParams(data.FeedQuery{Distance: 5, Sort: SortHot}, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := first.nextCursor(data.Entry{ID: 7}, 0.125)
+
+	params, err := newFeedParams(data.FeedQuery{Distance: 5, Sort: SortHot, Cursor: next.Encode()}, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !params.At.Equal(first.At) {
+		t.Errorf("got time %v, want the first page's %v", params.At, first.At)
+	}
+
+	if params.cursorKey() != 0.125 || params.Cursor.ID != 7 {
+		t.Errorf("got key %v and id %d", params.cursorKey(), params.Cursor.ID)
+	}
+}
+
+func TestNewFeedParamsRejectsForeignCursors(t *testing.T) {
+	at := time.Now().UTC().Format(time.RFC3339Nano)
+
+	tests := map[string]data.FeedQuery{
+		"other sort": {
+			Sort:   SortNew,
+			Cursor: pagination.Cursor{Sort: SortHot, Key: "1", ID: 1, At: at}.Encode(),
+		},
+		"other window": {
+			Sort:   SortTop,
+			Window: "month",
+			Cursor: pagination.Cursor{Sort: "top:week", Key: "1", ID: 1, At: at}.Encode(),
+		},
+		"bounds cursor": {
+			Cursor: pagination.Cursor{Sort: boundsSort, ID: 1}.Encode(),
+		},
+		"key not a number": {
+			Cursor: pagination.Cursor{Sort: SortNew, Key: "2026-01-02T03:04:05Z", ID: 1, At: at}.Encode(),
+		},
+		"missing time": {
+			Cursor: pagination.Cursor{Sort: SortNew, Key: "1", ID: 1}.Encode(),
+		},
+	}
+
+	for name, query := range tests {
+		query.Distance = 5
+		if _, err := newFeedParams(query, 1, 2); err != pagination.ErrInvalidCursor {
+			t.Errorf("%s: got %v, want ErrInvalidCursor", name, err)
+		}
+	}
+}
+
+func TestDistanceMeters(t *testing.T) {
+	tests := []struct {
+		distance float64
+		unit     string
+		want     float64
+	}{
+		{5, "", 5 * utils.MetersPerMile},
+		{5, "mi", 5 * utils.MetersPerMile},
+		{8, "km", 8000},
+		{100, "mi", maxFeedDistance},
+	}
+
+	for _, test := range tests {
+		got, err := distanceMeters(test.distance, test.unit)
+		if err != nil || got != test.want {
+			t.Errorf("distanceMeters(%v, %q) = %v, %v, want %v", test.distance, test.unit, got, err, test.want)
+		}
+	}
+
+	if _, err := distanceMeters(101, "mi"); err != ErrFeedDistanceTooFar {
+		t.Errorf("101 miles: got %v", err)
+	}
+	if _, err := distanceMeters(161, "km"); err != ErrFeedDistanceTooFar {
+		t.Errorf("161 km: got %v", err)
+	}
+	if _, err := distanceMeters(math.NaN(), "km"); err == nil {
+		t.Error("accepted NaN")
+	}
+}
+
+func TestFeedCenterKind(t *testing.T) {
+	lat, lon := 30.27, -97.74
+
+	tests := map[string]data.FeedQuery{
+		centerLocation:    {Location: "Austin"},
+		centerCoordinates: {Latitude: &lat, Longitude: &lon},
+		centerHome:        {Near: "home"},
+	}
+
+	for want, query := range tests {
+		if got, err := feedCenterKind(query); err != nil || got != want {
+			t.Errorf("got %q, %v, want %q", got, err, want)
+		}
+	}
+
+	invalid := map[string]data.FeedQuery{
+		"nothing":       {},
+		"only lat":      {Latitude: &lat},
+		"city and lat":  {Location: "Austin", Latitude: &lat, Longitude: &lon},
+		"city and home": {Location: "Austin", Near: "home"},
+	}
+
+	for name, query := range invalid {
+		if _, err := feedCenterKind(query); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+// feedFixture is an entry north of the fixture center with votes and
+// comments at fixed ages.
+type feedFixture struct {
+	name     string
+	north    float64
+	age      time.Duration
+	upvotes  []time.Duration
+	down     []time.Duration
+	comments int
+}
+
+// beginTestDB opens TEST_DATABASE_URL, a migrated database, in a transaction
+// that is rolled back after the test.
+func beginTestDB(t *testing.T) *sql.Tx {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+
+	return tx
+}
+
+func insertFeedFixtures(t *testing.T, tx *sql.Tx, longitude float64, latitude float64, at time.Time, fixtures []feedFixture) map[int]string {
+	t.Helper()
+
+	var voters []int
+	for i := range 5 {
+		var userID int
+
+		err := tx.QueryRow(`
+			INSERT INTO users (username, first_name, last_name, password, email, phone_number)
+			VALUES ($1, 'Feed', 'Test', '!', $1 || '@example.com', $2)
+			RETURNING id
+		`, "feedtest"+strconv.Itoa(i), "+1999000000"+strconv.Itoa(i)).Scan(&userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		voters = append(voters, userID)
+	}
+
+	names := make(map[int]string)
+
+	for _, fixture := range fixtures {
+		entryID, _, err := insertEntry(tx, voters[0], fixture.name, longitude, latitude+fixture.north, newRevision{
+			Title: fixture.name,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names[entryID] = fixture.name
+
+		_, err = tx.Exec(`UPDATE entry SET date_created = $2::timestamptz WHERE id = $1`, entryID, at.Add(-fixture.age))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vote := func(voter int, interactionType string, age time.Duration) {
+			_, err := tx.Exec(`
+				INSERT INTO entry_interactions (user_id, entry_id, interaction_type, created_at)
+				VALUES ($1, $2, $3, $4::timestamptz)
+			`, voters[voter], entryID, interactionType, at.Add(-age))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for i, age := range fixture.upvotes {
+			vote(i, "upvote", age)
+		}
+		for i, age := range fixture.down {
+			vote(len(voters)-1-i, "downvote", age)
+		}
+
+		for range fixture.comments {
+			_, err := tx.Exec(`
+				INSERT INTO conversation (user_id, entry_id, context, type)
+				VALUES ($1, $2, 'Fixture comment', 'opinion')
+			`, voters[0], entryID)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	return names
+}
+
+func TestFeedSortModes(t *testing.T) {
+	tx := beginTestDB(t)
+
+	// far from any real entries
+	const longitude, latitude = 10.0, -60.0
+
+	hour := time.Hour
+	day := 24 * hour
+	at := time.Now().UTC().Add(-time.Minute).Truncate(time.Microsecond)
+
+	names := insertFeedFixtures(t, tx, longitude, latitude, at, []feedFixture{
+		{name: "old favourite", north: 0.001, age: 30 * day, upvotes: []time.Duration{20 * day, 20 * day, 20 * day, 20 * day, 20 * day}},
+		{name: "fresh", north: 0.01, age: 2 * hour, upvotes: []time.Duration{hour, hour}, comments: 1},
+		{name: "argued", north: 0.005, age: 3 * day, upvotes: []time.Duration{2 * day, 2 * day, 2 * day}, comments: 3},
+		{name: "quiet", north: 0.02, age: day, down: []time.Duration{hour}, comments: 2},
+	})
+
+	tests := []struct {
+		sort   string
+		window string
+		want   []string
+	}{
+		{SortNew, "", []string{"fresh", "quiet", "argued", "old favourite"}},
+		{SortTop, "week", []string{"argued", "fresh", "old favourite", "quiet"}},
+		{SortTop, "all", []string{"old favourite", "argued", "fresh", "quiet"}},
+		{SortHot, "", []string{"fresh", "argued", "old favourite", "quiet"}},
+		{SortDiscussed, "", []string{"argued", "quiet", "fresh", "old favourite"}},
+		{SortNearest, "", []string{"old favourite", "argued", "fresh", "quiet"}},
+	}
+
+	for _, test := range tests {
+		query := data.FeedQuery{Distance: 5, Sort: test.sort, Window: test.window}
+
+		// one entry per page, following the cursors, has to give the same
+		// order as the whole list
+		var got []string
+
+		for {
+			params, err := newFeedParams(query, longitude, latitude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params.Limit = 1
+
+			page, err := queryFeed(tx, params)
+			if err != nil {
+				t.Fatalf("%s %s: %v", test.sort, test.window, err)
+			}
+
+			for _, entry := range page.Entries {
+				got = append(got, names[entry.ID])
+			}
+
+			if !page.More {
+				break
+			}
+
+			query.Cursor = params.nextCursor(page.Entries[0], page.LastKey).Encode()
+		}
+
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s %s: got %v, want %v", test.sort, test.window, got, test.want)
+		}
+	}
+}
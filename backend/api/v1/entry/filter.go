@@ -0,0 +1,193 @@
+package entry
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	data "backend/api/v1/data"
+)
+
+// queryBuilder collects the conditions of a WHERE clause. Conditions are SQL
+// written in this package, values only ever reach the database as arguments.
+type queryBuilder struct {
+	args       []any
+	conditions []string
+}
+
+// newQueryBuilder starts after the arguments the rest of the query already
+// uses, so the first value added is bound to $len(args)+1.
+func newQueryBuilder(args ...any) *queryBuilder {
+	return &queryBuilder{args: args}
+}
+
+// where adds a condition. Each %s in condition is replaced with the
+// placeholder of the matching value.
+func (b *queryBuilder) where(condition string, values ...any) {
+	placeholders := make([]any, len(values))
+	for i, value := range values {
+		b.args = append(b.args, value)
+		placeholders[i] = "$" + strconv.Itoa(len(b.args))
+	}
+
+	b.conditions = append(b.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+// clause joins the conditions for a WHERE, TRUE when there are none.
+func (b *queryBuilder) clause() string {
+	if len(b.conditions) == 0 {
+		return "TRUE"
+	}
+
+	return strings.Join(b.conditions, "\n\t\t\tAND ")
+}
+
+// tagFilter is a tag the entry must have, by name and optionally
+// classification.
+type tagFilter struct {
+	Classification string
+	Name           string
+}
+
+func parseTagFilter(value string) (tagFilter, error) {
+	classification, name, found := strings.Cut(value, "=")
+	if !found {
+		classification, name = "", value
+	}
+
+	classification = strings.TrimSpace(classification)
+	name = strings.TrimSpace(name)
+
+	if name == "" || (found && classification == "") {
+		return tagFilter{}, fmt.Errorf("Invalid tag filter %q", value)
+	}
+
+	return tagFilter{Classification: classification, Name: name}, nil
+}
+
+// validateEntryFilter checks the values addEntryFilter can't pass to the
+// database as they are.
+func validateEntryFilter(filter data.EntryFilter) error {
+	dates := []*string{
+		filter.CompletionAfter,
+		filter.CompletionBefore,
+		filter.CreatedAfter,
+		filter.CreatedBefore,
+		filter.UpdatedAfter,
+		filter.UpdatedBefore,
+	}
+
+	for _, date := range dates {
+		if date == nil {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, *date); err != nil {
+			return errors.New("Dates must be YYYY-MM-DD")
+		}
+	}
+
+	for _, tag := range filter.Tags {
+		if _, err := parseTagFilter(tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addEntryFilter adds the conditions of a validated filter to b. They refer
+// to the entry as e, its creator as u, its latest revision as er and that
+// revision's attributes as era.
+func addEntryFilter(b *queryBuilder, filter data.EntryFilter) {
+	if filter.Developer != nil {
+		b.where(`era.developer ILIKE '%%' || %s || '%%'`, *filter.Developer)
+	}
+	if filter.PermitNumber != nil {
+		b.where(`%s = ANY(era.permit_numbers)`, *filter.PermitNumber)
+	}
+	if filter.ParcelID != nil {
+		b.where(`era.parcel_id = %s`, *filter.ParcelID)
+	}
+	if filter.MinUnits != nil {
+		b.where(`era.units >= %s`, *filter.MinUnits)
+	}
+	if filter.MaxUnits != nil {
+		b.where(`era.units <= %s`, *filter.MaxUnits)
+	}
+	if filter.MinSquareFootage != nil {
+		b.where(`era.square_footage >= %s`, *filter.MinSquareFootage)
+	}
+	if filter.MaxSquareFootage != nil {
+		b.where(`era.square_footage <= %s`, *filter.MaxSquareFootage)
+	}
+	if filter.MinCost != nil {
+		b.where(`era.estimated_cost >= %s`, *filter.MinCost)
+	}
+	if filter.MaxCost != nil {
+		b.where(`era.estimated_cost <= %s`, *filter.MaxCost)
+	}
+	if filter.CompletionAfter != nil {
+		b.where(`era.estimated_completion >= %s::date`, *filter.CompletionAfter)
+	}
+	if filter.CompletionBefore != nil {
+		b.where(`era.estimated_completion <= %s::date`, *filter.CompletionBefore)
+	}
+
+	for _, value := range filter.Tags {
+		tag, _ := parseTagFilter(value)
+
+		if tag.Classification == "" {
+			b.where(`EXISTS (
+				SELECT 1
+				FROM tags_entry_revision ter
+				JOIN tags t ON t.id = ter.tag_id
+				WHERE ter.entry_revision_id = er.id AND lower(t.name) = lower(%s)
+			)`, tag.Name)
+			continue
+		}
+
+		b.where(`EXISTS (
+			SELECT 1
+			FROM tags_entry_revision ter
+			JOIN tags t ON t.id = ter.tag_id
+			WHERE ter.entry_revision_id = er.id
+				AND lower(t.classification) = lower(%s)
+				AND lower(t.name) = lower(%s)
+		)`, tag.Classification, tag.Name)
+	}
+
+	if filter.Creator != nil {
+		b.where(`lower(u.username) = lower(%s)`, *filter.Creator)
+	}
+
+	// the end date is inclusive, so compare against the start of the next day
+	if filter.CreatedAfter != nil {
+		b.where(`e.date_created >= %s::date`, *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		b.where(`e.date_created < %s::date + 1`, *filter.CreatedBefore)
+	}
+	if filter.UpdatedAfter != nil {
+		b.where(`er.date_created >= %s::date`, *filter.UpdatedAfter)
+	}
+	if filter.UpdatedBefore != nil {
+		b.where(`er.date_created < %s::date + 1`, *filter.UpdatedBefore)
+	}
+
+	if filter.MinScore != nil {
+		b.where(`(
+			SELECT COUNT(*) FILTER (WHERE ei.interaction_type = 'upvote')
+				- COUNT(*) FILTER (WHERE ei.interaction_type = 'downvote')
+			FROM entry_interactions ei
+			WHERE ei.entry_id = e.id
+		) >= %s`, *filter.MinScore)
+	}
+
+	if filter.HasPhotos != nil {
+		b.where(`EXISTS (
+			SELECT 1 FROM entry_revision_media erm WHERE erm.entry_revision_id = er.id
+		) = %s`, *filter.HasPhotos)
+	}
+}
@@ -0,0 +1,123 @@
+package entry
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	data "backend/api/v1/data"
+)
+
+func TestQueryBuilderNumbersAfterExistingArgs(t *testing.T) {
+	b := newQueryBuilder("west", "south")
+
+	if b.clause() != "TRUE" {
+		t.Errorf("empty builder: got %q", b.clause())
+	}
+
+	b.where(`era.units >= %s`, 10)
+	b.where(`lower(t.classification) = lower(%s) AND lower(t.name) = lower(%s)`, "Zoning", "Multi Family")
+
+	want := "era.units >= $3\n\t\t\tAND lower(t.classification) = lower($4) AND lower(t.name) = lower($5)"
+	if b.clause() != want {
+		t.Errorf("got clause %q, want %q", b.clause(), want)
+	}
+
+	if !reflect.DeepEqual(b.args, []any{"west", "south", 10, "Zoning", "Multi Family"}) {
+		t.Errorf("got args %v", b.args)
+	}
+}
+
+func TestAddEntryFilterKeepsValuesOutOfSQL(t *testing.T) {
+	developer := "'; DROP TABLE entry; --"
+	creator := "100%_sure"
+	photos := true
+
+	b := newQueryBuilder()
+	addEntryFilter(b, data.EntryFilter{
+		Developer: &developer,
+		Creator:   &creator,
+		Tags:      []string{"Zoning=Multi Family", "Construction Started"},
+		HasPhotos: &photos,
+	})
+
+	clause := b.clause()
+	for _, value := range []string{"DROP TABLE", "100%", "Multi Family", "Construction Started"} {
+		if strings.Contains(clause, value) {
+			t.Errorf("%q was written into the SQL: %s", value, clause)
+		}
+	}
+
+	if !strings.Contains(clause, "ILIKE '%' || $1 || '%'") {
+		t.Errorf("developer condition lost its wildcards: %s", clause)
+	}
+
+	want := []any{developer, "Zoning", "Multi Family", "Construction Started", creator, true}
+	if !reflect.DeepEqual(b.args, want) {
+		t.Errorf("got args %v, want %v", b.args, want)
+	}
+}
+
+func TestParseTagFilter(t *testing.T) {
+	tests := map[string]tagFilter{
+		"Multi Family":                     {Name: "Multi Family"},
+		"Zoning=Multi Family":              {Classification: "Zoning", Name: "Multi Family"},
+		" Progress = Construction Started": {Classification: "Progress", Name: "Construction Started"},
+	}
+
+	for value, want := range tests {
+		got, err := parseTagFilter(value)
+		if err != nil || got != want {
+			t.Errorf("parseTagFilter(%q) = %+v, %v, want %+v", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", " ", "Zoning=", "=Multi Family"} {
+		if _, err := parseTagFilter(value); err == nil {
+			t.Errorf("parseTagFilter(%q) should fail", value)
+		}
+	}
+}
+
+func TestValidateEntryFilter(t *testing.T) {
+	date := "2026-02-30"
+	if err := validateEntryFilter(data.EntryFilter{UpdatedBefore: &date}); err == nil {
+		t.Error("accepted an impossible date")
+	}
+
+	if err := validateEntryFilter(data.EntryFilter{Tags: []string{"Zoning="}}); err == nil {
+		t.Error("accepted a tag without a name")
+	}
+
+	date = "2026-02-28"
+	if err := validateEntryFilter(data.EntryFilter{CreatedAfter: &date, Tags: []string{"Zoning=Mixed Use"}}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFeedQueryBindsFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET",
+		"/feed?location=Austin&distance=5&tag=Zoning%3DMulti+Family&tag=Progress%3DConstruction+Started&creator=alice&min_score=3&has_photos=true",
+		nil,
+	)
+
+	var query data.FeedQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(query.Tags) != 2 || query.Tags[1] != "Progress=Construction Started" {
+		t.Errorf("got tags %q", query.Tags)
+	}
+
+	if query.Creator == nil || *query.Creator != "alice" || query.MinScore == nil || *query.MinScore != 3 ||
+		query.HasPhotos == nil || !*query.HasPhotos {
+		t.Errorf("got %+v", query.EntryFilter)
+	}
+}
@@ -0,0 +1,605 @@
+package entry
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	attributes "backend/api/v1/attributes"
+	audit "backend/api/v1/audit"
+	data "backend/api/v1/data"
+	footprint "backend/api/v1/footprint"
+	importer "backend/api/v1/importer"
+	markdown "backend/api/v1/markdown"
+	messages "backend/api/v1/messages"
+	structs "backend/api/v1/structs"
+	utils "backend/api/v1/utils"
+)
+
+const (
+	ImportActionCreate    = "create"
+	ImportActionUpdate    = "update"
+	ImportActionUnchanged = "unchanged"
+	ImportActionSkip      = "skip"
+)
+
+// RetrieveSystemUserID looks up the account imports are attributed to,
+// IMPORT_SYSTEM_USERNAME or "system" by default.
+func RetrieveSystemUserID(db *sql.DB) (int, error) {
+	username := os.Getenv("IMPORT_SYSTEM_USERNAME")
+	if username == "" {
+		username = "system"
+	}
+
+	var userID int
+
+	err := db.QueryRow(`
+		SELECT id FROM users WHERE username = $1
+	`, username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("import user %q does not exist", username)
+	}
+
+	return userID, err
+}
+
+// ImportRecords creates an entry for every record without a match and a new
+// revision for every match that the record would change. Matches are found
+// by permit number first, then by the same duplicate check CreateEntry runs,
+// where only a lone, similar entry counts and anything else skips the record.
+// Each record is written in its own transaction, so a database error stops
+// the import but keeps the records already written. With dryRun nothing is
+// written and the report describes what would have happened. c ties the
+// audit log rows to the request and is nil when importing from the command
+// line.
+func ImportRecords(db *sql.DB, c *gin.Context, records []importer.Record, systemUserID int, dryRun bool) (data.ImportReport, error) {
+	report := data.ImportReport{
+		DryRun: dryRun,
+		Rows:   []data.ImportRowReport{},
+	}
+
+	for _, record := range records {
+		row, err := importRecord(db, c, record, systemUserID, dryRun)
+		if err != nil {
+			return report, fmt.Errorf("line %d: %w", record.Line, err)
+		}
+
+		switch row.Action {
+		case ImportActionCreate:
+			report.Created++
+		case ImportActionUpdate:
+			report.Updated++
+		case ImportActionUnchanged:
+			report.Unchanged++
+		case ImportActionSkip:
+			report.Skipped++
+		}
+
+		report.Rows = append(report.Rows, row)
+	}
+
+	return report, nil
+}
+
+// knownTag reports whether a tag already exists with that classification.
+// Imports only use existing tags, a raw source value could otherwise add a
+// tag or move one to another classification.
+func knownTag(db *sql.DB, tag structs.Tag) (bool, error) {
+	var known bool
+
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM tags WHERE name = $1 AND classification = $2)
+	`, tag.Name, tag.Classification).Scan(&known)
+
+	return known, err
+}
+
+func skipRecord(row data.ImportRowReport, reason string) data.ImportRowReport {
+	row.Action = ImportActionSkip
+	row.Error = reason
+	return row
+}
+
+func importRecord(db *sql.DB, c *gin.Context, record importer.Record, systemUserID int, dryRun bool) (data.ImportRowReport, error) {
+	row := data.ImportRowReport{
+		Line:  record.Line,
+		Title: record.Title,
+	}
+
+	if record.Error != "" {
+		return skipRecord(row, record.Error), nil
+	}
+
+	if len(record.Description) > markdown.MaxSourceLength {
+		return skipRecord(row, "description is too long"), nil
+	}
+
+	if utf8.RuneCountInString(record.Address) > data.MaxAddressLength {
+		return skipRecord(row, "address is too long"), nil
+	}
+
+	for _, tag := range record.Tags {
+		known, err := knownTag(db, tag)
+		if err != nil {
+			return row, err
+		}
+
+		if !known {
+			return skipRecord(row, fmt.Sprintf("unknown %s tag %q", tag.Classification, tag.Name)), nil
+		}
+	}
+
+	if record.Footprint != "" {
+		if err := footprint.Validate(db, record.Footprint); err != nil {
+			return skipRecord(row, err.Error()), nil
+		}
+	}
+
+	entryID, matchedBy, candidates, err := matchImportRecord(db, record)
+	if err != nil {
+		return row, err
+	}
+
+	if len(candidates) > 0 {
+		row.Candidates = candidates
+		return skipRecord(row, "nearby entries may be the same project, resolve by hand"), nil
+	}
+
+	if entryID == 0 {
+		return createImportedEntry(db, c, record, row, systemUserID, dryRun)
+	}
+
+	row.EntryID = &entryID
+	row.MatchedBy = matchedBy
+
+	return updateImportedEntry(db, c, record, row, entryID, systemUserID, dryRun)
+}
+
+// importMatchSimilarity is how alike a record and the one entry near it have
+// to read before the import updates that entry rather than asking.
+const importMatchSimilarity = 0.4
+
+// matchImportRecord returns the entry a record describes, or 0 when it is new.
+// When entries nearby can't be told apart from the record's project they are
+// returned instead, and the record shouldn't be imported.
+func matchImportRecord(db *sql.DB, record importer.Record) (int, string, []data.DuplicateCandidate, error) {
+	if record.PermitNumber != "" {
+		var entryID int
+
+		err := db.QueryRow(`
+			SELECT e.id
+			FROM entry e
+			JOIN LATERAL (
+				SELECT id FROM entry_revision
+				WHERE entry_id = e.id
+				ORDER BY revision_number DESC
+				LIMIT 1
+			) er ON true
+			JOIN entry_revision_attributes era ON era.entry_revision_id = er.id
+			WHERE $1 = ANY(era.permit_numbers) AND e.archived_at IS NULL
+			ORDER BY e.id
+			LIMIT 1
+		`, record.PermitNumber).Scan(&entryID)
+		if err == nil {
+			return entryID, "permit_number", nil, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, "", nil, err
+		}
+	}
+
+	radius, err := DuplicateRadiusForTags(db, record.Tags)
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	candidates, err := FindNearbyEntries(
+		db,
+		record.Longitude,
+		record.Latitude,
+		record.Footprint,
+		radius,
+		record.Title+" "+record.Description,
+	)
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	entryID, ambiguous := matchByLocation(candidates)
+	if ambiguous {
+		return 0, "", candidates, nil
+	}
+	if entryID == 0 {
+		return 0, "", nil, nil
+	}
+
+	return entryID, "location", nil, nil
+}
+
+// matchByLocation decides what the entries near a record mean. With none the
+// record is new, and a lone entry that reads like the record is the same
+// project. Anything else is ambiguous, a dense block has unrelated projects
+// within the duplicate radius.
+func matchByLocation(candidates []data.DuplicateCandidate) (int, bool) {
+	switch {
+	case len(candidates) == 0:
+		return 0, false
+	case len(candidates) == 1 && candidates[0].Similarity >= importMatchSimilarity:
+		return candidates[0].ID, false
+	}
+
+	return 0, true
+}
+
+func createImportedEntry(
+	db *sql.DB,
+	c *gin.Context,
+	record importer.Record,
+	row data.ImportRowReport,
+	systemUserID int,
+	dryRun bool,
+) (data.ImportRowReport, error) {
+	var entryAttributes *data.EntryAttributes
+	if record.PermitNumber != "" {
+		entryAttributes = &data.EntryAttributes{PermitNumbers: []string{record.PermitNumber}}
+	}
+
+	if err := attributes.Validate(entryAttributes, record.Tags); err != nil {
+		return skipRecord(row, err.Error()), nil
+	}
+
+	row.Action = ImportActionCreate
+
+	for _, tag := range record.Tags {
+		row.AddedTags = append(row.AddedTags, data.Tag(tag))
+	}
+
+	if dryRun {
+		return row, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return row, err
+	}
+	defer tx.Rollback()
+
+	entryID, revisionID, err := insertEntry(
+		tx,
+		systemUserID,
+		record.Address,
+		record.Longitude,
+		record.Latitude,
+		newRevision{
+			Title:      record.Title,
+			Content:    record.Description,
+			Tags:       record.Tags,
+			Attributes: entryAttributes,
+			Geometry:   record.Footprint,
+		},
+	)
+	if err != nil {
+		return row, err
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    systemUserID,
+		Action:     "entry.import",
+		TargetType: "entry",
+		TargetID:   entryID,
+		After:      gin.H{"revision_id": revisionID, "title": record.Title},
+		Details:    gin.H{"line": record.Line},
+	})
+	if err != nil {
+		return row, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return row, err
+	}
+
+	row.EntryID = &entryID
+
+	return row, nil
+}
+
+// mergeImportedTags replaces the classifications an import provides and keeps
+// every other tag the entry already has.
+func mergeImportedTags(current []data.Tag, imported []structs.Tag) []structs.Tag {
+	var merged []structs.Tag
+
+	for _, tag := range current {
+		replaced := slices.ContainsFunc(imported, func(importedTag structs.Tag) bool {
+			return importedTag.Classification == tag.Classification
+		})
+
+		if !replaced {
+			merged = append(merged, structs.Tag(tag))
+		}
+	}
+
+	return append(merged, imported...)
+}
+
+// mergeImportedAttributes adds the imported permit number to the entry's
+// current attributes.
+func mergeImportedAttributes(current *data.EntryAttributes, permitNumber string) *data.EntryAttributes {
+	if permitNumber == "" {
+		return current
+	}
+
+	merged := data.EntryAttributes{}
+	if current != nil {
+		merged = *current
+	}
+
+	if !slices.Contains(merged.PermitNumbers, permitNumber) {
+		merged.PermitNumbers = append(slices.Clone(merged.PermitNumbers), permitNumber)
+	}
+
+	return &merged
+}
+
+func updateImportedEntry(
+	db *sql.DB,
+	c *gin.Context,
+	record importer.Record,
+	row data.ImportRowReport,
+	entryID int,
+	systemUserID int,
+	dryRun bool,
+) (data.ImportRowReport, error) {
+	var current revisionSnapshot
+	var currentGeometry string
+	var footprintChanged, locked bool
+
+	err := db.QueryRow(`
+		SELECT e.locked_at IS NOT NULL,
+			er.id,
+			er.title,
+			er.content,
+			COALESCE(ST_AsGeoJSON(e.footprint), ''),
+			CASE WHEN $2 = '' THEN false
+				ELSE NOT COALESCE(ST_Equals(
+					e.footprint::geometry,
+					ST_Multi(ST_SetSRID(ST_GeomFromGeoJSON(NULLIF($2, '')), 4326))
+				), false)
+			END
+		FROM entry e
+		JOIN entry_revision er ON er.entry_id = e.id
+		WHERE e.id = $1
+		ORDER BY er.revision_number DESC
+		LIMIT 1
+	`, entryID, record.Footprint).Scan(
+		&locked,
+		&current.ID,
+		&current.Title,
+		&current.Content,
+		&currentGeometry,
+		&footprintChanged,
+	)
+	if err != nil {
+		return row, err
+	}
+
+	if locked {
+		return skipRecord(row, "entry is locked"), nil
+	}
+
+	current.Tags, err = retrieveTagsForEntryRevision(db, current.ID)
+	if err != nil {
+		return row, err
+	}
+
+	current.Attributes, err = attributes.RetrieveForEntryRevision(db, current.ID)
+	if err != nil {
+		return row, err
+	}
+
+	tags := mergeImportedTags(current.Tags, record.Tags)
+	entryAttributes := mergeImportedAttributes(current.Attributes, record.PermitNumber)
+
+	if err := attributes.Validate(entryAttributes, tags); err != nil {
+		return skipRecord(row, err.Error()), nil
+	}
+
+	if current.Title != record.Title {
+		row.Changes = append(row.Changes, data.AttributeChange{Field: "title", From: current.Title, To: record.Title})
+	}
+	if current.Content != record.Description {
+		row.Changes = append(row.Changes, data.AttributeChange{Field: "content", From: current.Content, To: record.Description})
+	}
+	row.Changes = append(row.Changes, attributes.Diff(current.Attributes, entryAttributes)...)
+
+	geometry := currentGeometry
+	if footprintChanged {
+		var from any
+		if currentGeometry != "" {
+			from = json.RawMessage(currentGeometry)
+		}
+
+		row.Changes = append(row.Changes, data.AttributeChange{
+			Field: "footprint",
+			From:  from,
+			To:    json.RawMessage(record.Footprint),
+		})
+		geometry = record.Footprint
+	}
+
+	mergedTags := make([]data.Tag, len(tags))
+	for i, tag := range tags {
+		mergedTags[i] = data.Tag(tag)
+	}
+
+	if added := diffTags(current.Tags, mergedTags); len(added) > 0 {
+		row.AddedTags = added
+	}
+	if removed := diffTags(mergedTags, current.Tags); len(removed) > 0 {
+		row.RemovedTags = removed
+	}
+
+	if len(row.Changes) == 0 && len(row.AddedTags) == 0 && len(row.RemovedTags) == 0 {
+		row.Action = ImportActionUnchanged
+		return row, nil
+	}
+
+	row.Action = ImportActionUpdate
+
+	if dryRun {
+		return row, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return row, err
+	}
+	defer tx.Rollback()
+
+	revisionID, err := appendRevision(tx, entryID, current.ID, systemUserID, newRevision{
+		Title:      record.Title,
+		Content:    record.Description,
+		Tags:       tags,
+		Attributes: entryAttributes,
+		Geometry:   geometry,
+	})
+	if err != nil {
+		return row, err
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    systemUserID,
+		Action:     "entry.import",
+		TargetType: "entry",
+		TargetID:   entryID,
+		Before:     gin.H{"revision_id": current.ID, "title": current.Title},
+		After:      gin.H{"revision_id": revisionID, "title": record.Title},
+		Details:    gin.H{"line": record.Line, "matched_by": row.MatchedBy},
+	})
+	if err != nil {
+		return row, err
+	}
+
+	return row, tx.Commit()
+}
+
+// maxImportSize caps the source file accepted by the import endpoint.
+const maxImportSize = 50 << 20
+
+// ImportEntries runs an import from an uploaded CSV or GeoJSON file and YAML
+// mapping. Pass dry_run=true to get the report without writing anything.
+func ImportEntries(c *gin.Context, db *sql.DB) {
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", "false"))
+
+	sourceHeader, err := c.FormFile("file")
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("A source file is required"))
+		return
+	}
+
+	if sourceHeader.Size > maxImportSize {
+		messages.StatusBadRequest(c, errors.New("Source file is too large"))
+		return
+	}
+
+	mappingHeader, err := c.FormFile("mapping")
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("A mapping file is required"))
+		return
+	}
+
+	mappingFile, err := mappingHeader.Open()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer mappingFile.Close()
+
+	mappingContent, err := io.ReadAll(io.LimitReader(mappingFile, 1<<20))
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	mapping, err := importer.ParseMapping(mappingContent, importer.FormatFromFilename(sourceHeader.Filename))
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	source, err := sourceHeader.Open()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer source.Close()
+
+	records, err := importer.Read(source, mapping)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	systemUserID, err := RetrieveSystemUserID(db)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	report, err := ImportRecords(db, c, records, systemUserID, dryRun)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !dryRun {
+		if err := recordImport(db, c, systemUserID, sourceHeader.Filename, report); err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// recordImport logs who ran an import. The entries themselves are logged as
+// written by the system user, under the same request id.
+func recordImport(db *sql.DB, c *gin.Context, systemUserID int, filename string, report data.ImportReport) error {
+	adminID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    adminID,
+		Action:     "entries.import",
+		TargetType: "user",
+		TargetID:   systemUserID,
+		Details: gin.H{
+			"file":      filename,
+			"created":   report.Created,
+			"updated":   report.Updated,
+			"unchanged": report.Unchanged,
+			"skipped":   report.Skipped,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
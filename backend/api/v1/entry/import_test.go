@@ -0,0 +1,77 @@
+package entry
+
+import (
+	"slices"
+	"testing"
+
+	data "backend/api/v1/data"
+	structs "backend/api/v1/structs"
+)
+
+func TestMatchByLocation(t *testing.T) {
+	similar := data.DuplicateCandidate{ID: 1, Similarity: 0.8}
+	unrelated := data.DuplicateCandidate{ID: 2, Similarity: 0.1}
+
+	tests := map[string]struct {
+		candidates []data.DuplicateCandidate
+		entryID    int
+		ambiguous  bool
+	}{
+		"nothing nearby":     {nil, 0, false},
+		"the same project":   {[]data.DuplicateCandidate{similar}, 1, false},
+		"unrelated neighbor": {[]data.DuplicateCandidate{unrelated}, 0, true},
+		"dense block":        {[]data.DuplicateCandidate{similar, unrelated}, 0, true},
+	}
+
+	for name, test := range tests {
+		entryID, ambiguous := matchByLocation(test.candidates)
+		if entryID != test.entryID || ambiguous != test.ambiguous {
+			t.Errorf("%s: got %d, %v, want %d, %v", name, entryID, ambiguous, test.entryID, test.ambiguous)
+		}
+	}
+}
+
+func TestMergeImportedTags(t *testing.T) {
+	current := []data.Tag{
+		{Name: "Residential", Classification: "Zoning"},
+		{Name: "Proposed", Classification: "Progress"},
+		{Name: "Affordable", Classification: "Other"},
+	}
+
+	merged := mergeImportedTags(current, []structs.Tag{{Name: "Approved", Classification: "Progress"}})
+
+	want := []structs.Tag{
+		{Name: "Residential", Classification: "Zoning"},
+		{Name: "Affordable", Classification: "Other"},
+		{Name: "Approved", Classification: "Progress"},
+	}
+
+	if !slices.Equal(merged, want) {
+		t.Errorf("got %+v, want %+v", merged, want)
+	}
+}
+
+func TestMergeImportedAttributes(t *testing.T) {
+	developer := "Acme Homes"
+	current := &data.EntryAttributes{PermitNumbers: []string{"BP-1"}, Developer: &developer}
+
+	if merged := mergeImportedAttributes(current, ""); merged != current {
+		t.Error("a record without a permit number should keep the attributes as they are")
+	}
+
+	merged := mergeImportedAttributes(current, "BP-2")
+	if !slices.Equal(merged.PermitNumbers, []string{"BP-1", "BP-2"}) || merged.Developer != &developer {
+		t.Errorf("got %+v", merged)
+	}
+	if len(current.PermitNumbers) != 1 {
+		t.Error("merging changed the current attributes")
+	}
+
+	if merged := mergeImportedAttributes(current, "BP-1"); len(merged.PermitNumbers) != 1 {
+		t.Errorf("a known permit number was added again: %v", merged.PermitNumbers)
+	}
+
+	if merged := mergeImportedAttributes(nil, "BP-3"); merged == nil || !slices.Equal(merged.PermitNumbers, []string{"BP-3"}) {
+		t.Errorf("got %+v for an entry without attributes", merged)
+	}
+}
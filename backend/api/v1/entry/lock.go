@@ -0,0 +1,134 @@
+package entry
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	audit "backend/api/v1/audit"
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+var ErrEntryLocked = errors.New("Entry is locked, only moderators can edit it")
+
+// LockEntry stops everyone but moderators from editing an entry.
+func LockEntry(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	var req data.LockEntryRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	moderatorID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	setEntryLock(c, db, entryID, moderatorID, &req.Reason)
+}
+
+func UnlockEntry(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	moderatorID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	setEntryLock(c, db, entryID, moderatorID, nil)
+}
+
+// setEntryLock locks an entry with a reason, or unlocks it when reason is
+// nil.
+func setEntryLock(c *gin.Context, db *sql.DB, entryID int, moderatorID int, reason *string) {
+	locking := reason != nil
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var locked bool
+
+	err = tx.QueryRow(`
+		SELECT locked_at IS NOT NULL FROM entry WHERE id = $1 AND archived_at IS NULL FOR UPDATE
+	`, entryID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if locked == locking {
+		if locking {
+			messages.StatusConflict(c, errors.New("Entry is already locked"))
+		} else {
+			messages.StatusConflict(c, errors.New("Entry is not locked"))
+		}
+		return
+	}
+
+	action := "entry.unlock"
+
+	if locking {
+		action = "entry.lock"
+		_, err = tx.Exec(`
+			UPDATE entry SET locked_at = now(), locked_by = $2, lock_reason = $3 WHERE id = $1
+		`, entryID, moderatorID, *reason)
+	} else {
+		_, err = tx.Exec(`
+			UPDATE entry SET locked_at = NULL, locked_by = NULL, lock_reason = NULL WHERE id = $1
+		`, entryID)
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    moderatorID,
+		Action:     action,
+		TargetType: "entry",
+		TargetID:   entryID,
+		Before:     gin.H{"locked": !locking},
+		After:      gin.H{"locked": locking},
+		Details:    gin.H{"reason": reason},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if locking {
+		messages.StatusOk(c, "Entry locked")
+	} else {
+		messages.StatusOk(c, "Entry unlocked")
+	}
+}
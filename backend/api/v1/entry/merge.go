@@ -0,0 +1,379 @@
+package entry
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	audit "backend/api/v1/audit"
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	relations "backend/api/v1/relations"
+	utils "backend/api/v1/utils"
+)
+
+func MergeEntry(c *gin.Context, db *sql.DB) {
+	sourceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	var req data.MergeEntryRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if req.TargetID == sourceID {
+		messages.StatusBadRequest(c, errors.New("An entry cannot be merged into itself"))
+		return
+	}
+
+	moderatorID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, archived_at IS NOT NULL
+		FROM entry
+		WHERE id IN ($1, $2)
+		ORDER BY id
+		FOR UPDATE
+	`, sourceID, req.TargetID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	archived := make(map[int]bool)
+
+	for rows.Next() {
+		var id int
+		var isArchived bool
+
+		if err := rows.Scan(&id, &isArchived); err != nil {
+			rows.Close()
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		archived[id] = isArchived
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if _, ok := archived[sourceID]; !ok {
+		messages.StatusNotFound(c, errors.New("Source entry not found"))
+		return
+	}
+
+	if isArchived, ok := archived[req.TargetID]; !ok || isArchived {
+		messages.StatusNotFound(c, errors.New("Target entry not found"))
+		return
+	}
+
+	response, err := mergeEntries(tx, sourceID, req.TargetID, moderatorID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    moderatorID,
+		Action:     "entry.merge",
+		TargetType: "entry",
+		TargetID:   sourceID,
+		Details: gin.H{
+			"target_id":           req.TargetID,
+			"reason":              req.Reason,
+			"moved_revisions":     response.MovedRevisions,
+			"moved_conversations": response.MovedConversations,
+			"moved_interactions":  response.MovedInteractions,
+		},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// mergeEntries folds source into target and deletes source. Source revisions
+// are appended after the target's, and the target's latest revision is then
+// re-applied on top so the merge doesn't change what the target shows.
+func mergeEntries(tx *sql.Tx, sourceID int, targetID int, moderatorID int) (data.MergeEntryResponse, error) {
+	response := data.MergeEntryResponse{
+		SourceID: sourceID,
+		TargetID: targetID,
+	}
+
+	var targetRevisionId int
+
+	err := tx.QueryRow(`
+		SELECT id FROM entry_revision
+		WHERE entry_id = $1
+		ORDER BY revision_number DESC
+		LIMIT 1
+	`, targetID).Scan(&targetRevisionId)
+	if err != nil {
+		return response, err
+	}
+
+	result, err := tx.Exec(`
+		WITH target_max AS (
+			SELECT COALESCE(MAX(revision_number), 0) AS revision_number
+			FROM entry_revision
+			WHERE entry_id = $2
+		),
+		renumbered AS (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY revision_number, id) AS position
+			FROM entry_revision
+			WHERE entry_id = $1
+		)
+		UPDATE entry_revision er
+		SET entry_id = $2,
+			revision_number = (SELECT revision_number FROM target_max) + r.position
+		FROM renumbered r
+		WHERE er.id = r.id
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	response.MovedRevisions, err = result.RowsAffected()
+	if err != nil {
+		return response, err
+	}
+
+	if response.MovedRevisions > 0 {
+		var entryRevisionId int
+
+		err = tx.QueryRow(`
+			INSERT INTO entry_revision (entry_id, title, content, revision_number, creator_id, footprint)
+			SELECT entry_id, title, content,
+				(SELECT MAX(revision_number) + 1 FROM entry_revision WHERE entry_id = $1),
+				$3,
+				footprint
+			FROM entry_revision
+			WHERE id = $2
+			RETURNING id
+		`, targetID, targetRevisionId, moderatorID).Scan(&entryRevisionId)
+		if err != nil {
+			return response, err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO tags_entry_revision (entry_revision_id, tag_id)
+			SELECT $1, tag_id FROM tags_entry_revision WHERE entry_revision_id = $2
+		`, entryRevisionId, targetRevisionId)
+		if err != nil {
+			return response, err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO entry_revision_media (entry_revision_id, media_id, position)
+			SELECT $1, media_id, position FROM entry_revision_media WHERE entry_revision_id = $2
+		`, entryRevisionId, targetRevisionId)
+		if err != nil {
+			return response, err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO entry_revision_attributes (
+				entry_revision_id, permit_numbers, developer, units, square_footage,
+				parcel_id, estimated_completion, estimated_cost
+			)
+			SELECT $1, permit_numbers, developer, units, square_footage,
+				parcel_id, estimated_completion, estimated_cost
+			FROM entry_revision_attributes
+			WHERE entry_revision_id = $2
+		`, entryRevisionId, targetRevisionId)
+		if err != nil {
+			return response, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE media SET entry_id = $2 WHERE entry_id = $1
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	result, err = tx.Exec(`
+		UPDATE conversation SET entry_id = $2 WHERE entry_id = $1
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	response.MovedConversations, err = result.RowsAffected()
+	if err != nil {
+		return response, err
+	}
+
+	// A user who voted on both entries keeps the vote they cast on the target.
+	_, err = tx.Exec(`
+		DELETE FROM entry_interactions source
+		USING entry_interactions target
+		WHERE source.entry_id = $1
+		AND target.entry_id = $2
+		AND source.user_id = target.user_id
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	result, err = tx.Exec(`
+		UPDATE entry_interactions SET entry_id = $2 WHERE entry_id = $1
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	response.MovedInteractions, err = result.RowsAffected()
+	if err != nil {
+		return response, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO entry_contributors (entry_id, user_id, contribution_count, last_contributed_at)
+		SELECT $2, user_id, contribution_count, last_contributed_at
+		FROM entry_contributors
+		WHERE entry_id = $1
+		ON CONFLICT (user_id, entry_id) DO UPDATE
+		SET contribution_count = entry_contributors.contribution_count + EXCLUDED.contribution_count,
+			last_contributed_at = GREATEST(entry_contributors.last_contributed_at, EXCLUDED.last_contributed_at)
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO entry_watchers (entry_id, user_id, date_created)
+		SELECT $2, user_id, date_created FROM entry_watchers WHERE entry_id = $1
+		ON CONFLICT DO NOTHING
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE notifications SET entry_id = $2 WHERE entry_id = $1
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO entry_views_daily (entry_id, day, views)
+		SELECT $2, day, views FROM entry_views_daily WHERE entry_id = $1
+		ON CONFLICT (entry_id, day) DO UPDATE
+		SET views = entry_views_daily.views + EXCLUDED.views
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE entry
+		SET views = views + (SELECT views FROM entry WHERE id = $1)
+		WHERE id = $2
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	err = relations.MoveRelations(tx, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	// Flags would cascade away with source. A reporter with an open flag on
+	// both entries keeps the one on the target, the rest follow the content
+	// they were raised against.
+	_, err = tx.Exec(`
+		DELETE FROM flags source
+		USING flags target
+		WHERE source.target_type = 'entry' AND source.target_id = $1
+		AND target.target_type = 'entry' AND target.target_id = $2
+		AND source.status = 'open' AND target.status = 'open'
+		AND source.reporter_id = target.reporter_id
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE flags
+		SET entry_id = $2,
+			target_id = CASE WHEN target_type = 'entry' THEN $2 ELSE target_id END
+		WHERE entry_id = $1
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	// Entries that were previously merged into source now resolve to target.
+	_, err = tx.Exec(`
+		UPDATE entry_redirect SET to_entry_id = $2 WHERE to_entry_id = $1
+	`, sourceID, targetID)
+	if err != nil {
+		return response, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO entry_redirect (from_entry_id, to_entry_id, merged_by)
+		VALUES ($1, $2, $3)
+	`, sourceID, targetID, moderatorID)
+	if err != nil {
+		return response, err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM entry WHERE id = $1
+	`, sourceID)
+
+	return response, err
+}
+
+// retrieveEntryRedirect returns the entry a merged entry id now points to.
+func retrieveEntryRedirect(db *sql.DB, entryID int) (int, bool, error) {
+	var targetID int
+
+	err := db.QueryRow(`
+		SELECT to_entry_id FROM entry_redirect WHERE from_entry_id = $1
+	`, entryID).Scan(&targetID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return targetID, true, nil
+}
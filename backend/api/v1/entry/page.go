@@ -0,0 +1,90 @@
+package entry
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	pagination "backend/api/v1/pagination"
+)
+
+// DeprecationHeader marks responses to clients that didn't ask for a page.
+const DeprecationHeader = "Deprecation"
+
+// boundsSort names the order of bounds cursors so one can't be replayed
+// against the feed.
+const boundsSort = "id"
+
+// pageRequested reports whether a client asked for a page. Clients that send
+// neither a cursor nor a limit predate pagination and get the bare array they
+// always have, every entry included.
+func pageRequested(cursor string, limit int) bool {
+	return cursor != "" || limit != 0
+}
+
+// pageLimit is the number of entries to fetch, zero for no limit. The
+// unpaged path stays unbounded so older clients don't silently lose entries,
+// but it is deprecated and will go once they send a limit.
+func pageLimit(paged bool, limit int) int {
+	if !paged {
+		return 0
+	}
+
+	return pagination.Limit(limit)
+}
+
+// respondWithPage sends entries in a page envelope, or as a bare deprecated
+// array when the client didn't ask for a page. status is the code older
+// clients of the endpoint expect.
+func respondWithPage(c *gin.Context, paged bool, entries []data.Entry, next *pagination.Cursor, status int) {
+	var nextCursor *string
+	if next != nil {
+		encoded := next.Encode()
+		nextCursor = &encoded
+	}
+
+	if paged {
+		if entries == nil {
+			entries = []data.Entry{}
+		}
+
+		c.JSON(http.StatusOK, data.EntryPage{
+			Entries:    entries,
+			NextCursor: nextCursor,
+		})
+		return
+	}
+
+	c.Header(DeprecationHeader, "true")
+
+	if len(entries) == 0 {
+		messages.StatusNoContent(c, errors.New("No entries found"))
+		return
+	}
+
+	c.JSON(status, entries)
+}
+
+// respondWithBoundsEntries sends street level entries in the same shape as
+// clusters.
+func respondWithBoundsEntries(c *gin.Context, entries []data.Entry, next *pagination.Cursor) {
+	if entries == nil {
+		entries = []data.Entry{}
+	}
+
+	response := data.BoundsResponse{
+		Mode:     boundsModeEntries,
+		Clusters: []data.EntryCluster{},
+		Entries:  entries,
+	}
+
+	if next != nil {
+		encoded := next.Encode()
+		response.NextCursor = &encoded
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,133 @@
+package entry
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	data "backend/api/v1/data"
+	media "backend/api/v1/media"
+	messages "backend/api/v1/messages"
+	structs "backend/api/v1/structs"
+	utils "backend/api/v1/utils"
+)
+
+// ProposeEntryFromPhoto takes a geotagged photo, stores it as a pending upload
+// and proposes a new entry at the photo's position. Entries that already exist
+// within the duplicate radius are returned alongside so the photo can be
+// attached to one of them instead.
+func ProposeEntryFromPhoto(c *gin.Context, db *sql.DB, mediaStorage media.Storage) {
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	upload, err := media.ReadUpload(c)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	geotag, ok := media.ReadGeotag(upload.Content)
+	if !ok {
+		messages.StatusBadRequest(c, errors.New("Photo has no GPS position"))
+		return
+	}
+
+	radius, err := DuplicateRadiusForTags(db, nil)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	nearby, err := FindNearbyEntries(db, geotag.Longitude, geotag.Latitude, "", radius, "")
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	photo, err := media.StorePendingMedia(c, db, mediaStorage, userID, upload)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	address, err := reverseGeocode(geotag.Latitude, geotag.Longitude)
+	if err != nil {
+		log.Printf("Failed to reverse geocode %f,%f: %v", geotag.Latitude, geotag.Longitude, err)
+	}
+
+	proposal := data.PhotoEntryProposal{
+		Media: photo,
+		Proposal: data.CreateEntryRequest{
+			Location:  address,
+			Latitude:  geotag.Latitude,
+			Longitude: geotag.Longitude,
+			Tags:      []structs.Tag{},
+			MediaIDs:  []int{photo.ID},
+		},
+		RadiusMeters:  radius,
+		NearbyEntries: nearby,
+	}
+
+	if !geotag.CapturedAt.IsZero() {
+		proposal.CapturedAt = geotag.CapturedAt.Format(time.RFC3339)
+	}
+
+	if proposal.NearbyEntries == nil {
+		proposal.NearbyEntries = []data.DuplicateCandidate{}
+	}
+
+	c.JSON(http.StatusCreated, proposal)
+}
+
+func reverseGeocode(latitude float64, longitude float64) (string, error) {
+	url := fmt.Sprintf(
+		"%s/search/2/reverseGeocode/%f,%f.json?key=%s",
+		os.Getenv("TOM_TOM_BASE_URL"),
+		latitude,
+		longitude,
+		os.Getenv("TOM_TOM_API_KEY"),
+	)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reverse geocode returned %s", resp.Status)
+	}
+
+	var response data.TomTomReverseGeocodeResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", err
+	}
+
+	if len(response.Addresses) == 0 {
+		return "", nil
+	}
+
+	return truncateAddress(response.Addresses[0].Address.FreeformAddress), nil
+}
+
+// truncateAddress cuts an address down to what entry.address holds. It's only
+// a proposal, the user can still correct it before creating the entry.
+func truncateAddress(address string) string {
+	if utf8.RuneCountInString(address) <= data.MaxAddressLength {
+		return address
+	}
+
+	return string([]rune(address)[:data.MaxAddressLength])
+}
@@ -0,0 +1,433 @@
+package entry
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	attributes "backend/api/v1/attributes"
+	audit "backend/api/v1/audit"
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	structs "backend/api/v1/structs"
+	utils "backend/api/v1/utils"
+)
+
+type revisionSnapshot struct {
+	ID         int
+	Title      string
+	Content    string
+	Tags       []data.Tag
+	Attributes *data.EntryAttributes
+	Hidden     bool
+}
+
+func retrieveRevisionSnapshot(db *sql.DB, entryID int, revisionNumber int) (revisionSnapshot, error) {
+	var snapshot revisionSnapshot
+
+	err := db.QueryRow(`
+		SELECT er.id, er.title, er.content, er.hidden_at IS NOT NULL
+		FROM entry_revision er
+		JOIN entry e ON e.id = er.entry_id
+		WHERE er.entry_id = $1 AND er.revision_number = $2 AND e.archived_at IS NULL
+	`, entryID, revisionNumber).Scan(&snapshot.ID, &snapshot.Title, &snapshot.Content, &snapshot.Hidden)
+	if err != nil {
+		return snapshot, err
+	}
+
+	snapshot.Tags, err = retrieveTagsForEntryRevision(db, snapshot.ID)
+	if err != nil {
+		return snapshot, err
+	}
+
+	snapshot.Attributes, err = attributes.RetrieveForEntryRevision(db, snapshot.ID)
+	return snapshot, err
+}
+
+// diffTags returns the tags present in to but not in from.
+func diffTags(from []data.Tag, to []data.Tag) []data.Tag {
+	seen := make(map[data.Tag]bool, len(from))
+	for _, tag := range from {
+		seen[tag] = true
+	}
+
+	added := []data.Tag{}
+	for _, tag := range to {
+		if !seen[tag] {
+			added = append(added, tag)
+		}
+	}
+
+	return added
+}
+
+// RetrieveRevisionDiff compares two revisions of an entry, identified by
+// their revision numbers.
+func RetrieveRevisionDiff(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	visible, err := utils.EntryVisible(c, db, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !visible {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	var query data.RevisionDiffQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	from, err := retrieveRevisionSnapshot(db, entryID, query.From)
+	if err == sql.ErrNoRows {
+		messages.StatusNotFound(c, errors.New("Revision not found"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	to, err := retrieveRevisionSnapshot(db, entryID, query.To)
+	if err == sql.ErrNoRows {
+		messages.StatusNotFound(c, errors.New("Revision not found"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if from.Hidden || to.Hidden {
+		_, role, _ := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+		if !utils.IsModerator(role) {
+			messages.StatusForbidden(c, errors.New("Revision is hidden"))
+			return
+		}
+	}
+
+	diff := data.RevisionDiff{
+		EntryID:     entryID,
+		From:        query.From,
+		To:          query.To,
+		AddedTags:   diffTags(from.Tags, to.Tags),
+		RemovedTags: diffTags(to.Tags, from.Tags),
+		Attributes:  attributes.Diff(from.Attributes, to.Attributes),
+	}
+
+	if from.Title != to.Title {
+		diff.Title = &data.AttributeChange{Field: "title", From: from.Title, To: to.Title}
+	}
+	if from.Content != to.Content {
+		diff.Content = &data.AttributeChange{Field: "content", From: from.Content, To: to.Content}
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+var (
+	ErrFirstRevision     = errors.New("The first revision cannot be reverted")
+	ErrRevisionNotLatest = errors.New("Only the latest revision can be reverted")
+	ErrNothingToRestore  = errors.New("Every earlier revision is hidden")
+)
+
+// RevertRevision undoes the latest revision of an entry by appending a new
+// revision that restores the last visible one before it. It returns the id of
+// the new revision.
+func RevertRevision(tx *sql.Tx, revisionID int, moderatorID int) (int, error) {
+	var entryID, revisionNumber, latestRevisionNumber int
+
+	err := tx.QueryRow(`
+		SELECT er.entry_id,
+			er.revision_number,
+			(SELECT MAX(revision_number) FROM entry_revision WHERE entry_id = er.entry_id)
+		FROM entry_revision er
+		WHERE er.id = $1
+	`, revisionID).Scan(&entryID, &revisionNumber, &latestRevisionNumber)
+	if err != nil {
+		return 0, err
+	}
+
+	if revisionNumber == 1 {
+		return 0, ErrFirstRevision
+	}
+
+	if revisionNumber != latestRevisionNumber {
+		return 0, ErrRevisionNotLatest
+	}
+
+	var restored newRevision
+	var restoredRevisionId int
+
+	err = tx.QueryRow(`
+		SELECT id, title, content, COALESCE(ST_AsGeoJSON(footprint), '')
+		FROM entry_revision
+		WHERE entry_id = $1 AND revision_number < $2 AND hidden_at IS NULL
+		ORDER BY revision_number DESC
+		LIMIT 1
+	`, entryID, revisionNumber).Scan(
+		&restoredRevisionId,
+		&restored.Title,
+		&restored.Content,
+		&restored.Geometry,
+	)
+	if err == sql.ErrNoRows {
+		return 0, ErrNothingToRestore
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	tags, err := retrieveTagsForEntryRevision(tx, restoredRevisionId)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, tag := range tags {
+		restored.Tags = append(restored.Tags, structs.Tag(tag))
+	}
+
+	restored.Attributes, err = attributes.RetrieveForEntryRevision(tx, restoredRevisionId)
+	if err != nil {
+		return 0, err
+	}
+
+	return appendRevision(tx, entryID, revisionID, moderatorID, restored)
+}
+
+// RetrieveRevisions lists an entry's revisions, oldest first. Hidden
+// revisions keep their number but only moderators see what they said.
+func RetrieveRevisions(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	visible, err := utils.EntryVisible(c, db, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !visible {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	_, role, _ := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	moderator := utils.IsModerator(role)
+
+	rows, err := db.Query(`
+		SELECT er.id,
+			er.revision_number,
+			COALESCE(er.title, ''),
+			COALESCE(u.username, ''),
+			er.date_created,
+			er.hidden_at IS NOT NULL,
+			er.hidden_reason
+		FROM entry_revision er
+		JOIN entry e ON e.id = er.entry_id
+		LEFT JOIN users u ON u.id = er.creator_id
+		WHERE er.entry_id = $1 AND e.archived_at IS NULL
+		ORDER BY er.revision_number
+	`, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	revisions := []data.RevisionSummary{}
+
+	for rows.Next() {
+		var revision data.RevisionSummary
+
+		err := rows.Scan(
+			&revision.ID,
+			&revision.RevisionNumber,
+			&revision.Title,
+			&revision.Username,
+			&revision.DateCreated,
+			&revision.Hidden,
+			&revision.HiddenReason,
+		)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		if revision.Hidden && !moderator {
+			revision.Title = ""
+			revision.Username = ""
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if len(revisions) == 0 {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// HideRevision redacts a revision from an entry's history. The latest
+// revision is what the entry shows, so it has to be reverted first.
+func HideRevision(c *gin.Context, db *sql.DB) {
+	revisionID, err := strconv.Atoi(c.Param("revisionId"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid revision id"))
+		return
+	}
+
+	var req data.HideRevisionRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	moderatorID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var latest, hidden bool
+
+	err = tx.QueryRow(`
+		SELECT er.revision_number = (SELECT MAX(revision_number) FROM entry_revision WHERE entry_id = er.entry_id),
+			er.hidden_at IS NOT NULL
+		FROM entry_revision er
+		WHERE er.id = $1
+		FOR UPDATE
+	`, revisionID).Scan(&latest, &hidden)
+	if err == sql.ErrNoRows {
+		messages.StatusNotFound(c, errors.New("Revision not found"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if latest {
+		messages.StatusConflict(c, errors.New("Revert the latest revision before hiding it"))
+		return
+	}
+
+	if hidden {
+		messages.StatusConflict(c, errors.New("Revision is already hidden"))
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE entry_revision
+		SET hidden_at = now(), hidden_by = $2, hidden_reason = $3
+		WHERE id = $1
+	`, revisionID, moderatorID, req.Reason)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    moderatorID,
+		Action:     "revision.hide",
+		TargetType: "revision",
+		TargetID:   revisionID,
+		Details:    gin.H{"reason": req.Reason},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Revision hidden")
+}
+
+func UnhideRevision(c *gin.Context, db *sql.DB) {
+	revisionID, err := strconv.Atoi(c.Param("revisionId"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid revision id"))
+		return
+	}
+
+	moderatorID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE entry_revision
+		SET hidden_at = NULL, hidden_by = NULL, hidden_reason = NULL
+		WHERE id = $1 AND hidden_at IS NOT NULL
+	`, revisionID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if unhidden, err := result.RowsAffected(); err != nil || unhidden == 0 {
+		messages.StatusNotFound(c, errors.New("No hidden revision with that id"))
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    moderatorID,
+		Action:     "revision.unhide",
+		TargetType: "revision",
+		TargetID:   revisionID,
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Revision restored to history")
+}
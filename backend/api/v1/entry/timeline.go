@@ -0,0 +1,272 @@
+package entry
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+// progressStages lists the Progress tags in the order a project moves through
+// them. When a revision carries more than one, the furthest along wins.
+var progressStages = []string{
+	"Lot For Sale",
+	"Lot Sold",
+	"Construction Started",
+	"Construction Completed",
+}
+
+func progressRank(status string) int {
+	for i, stage := range progressStages {
+		if stage == status {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// furthestProgress picks the furthest along of several Progress statuses, or
+// returns "" when there are none.
+func furthestProgress(statuses []string) string {
+	status := ""
+
+	for _, candidate := range statuses {
+		if status == "" || progressRank(candidate) > progressRank(status) {
+			status = candidate
+		}
+	}
+
+	return status
+}
+
+type revisionProgress struct {
+	RevisionNumber int
+	DateCreated    time.Time
+	Statuses       []string
+}
+
+// buildTimeline collapses an entry's revisions, oldest first, into the stages
+// its Progress tag went through. Revisions without a Progress tag keep the
+// previous status. The last stage is measured up to now.
+func buildTimeline(revisions []revisionProgress, now time.Time) []data.TimelineStage {
+	stages := []data.TimelineStage{}
+	var startedAt []time.Time
+
+	for _, revision := range revisions {
+		status := furthestProgress(revision.Statuses)
+
+		if status == "" {
+			continue
+		}
+
+		if len(stages) > 0 && stages[len(stages)-1].Status == status {
+			continue
+		}
+
+		stages = append(stages, data.TimelineStage{
+			Status:         status,
+			RevisionNumber: revision.RevisionNumber,
+			StartedAt:      revision.DateCreated.Format(time.RFC3339),
+		})
+		startedAt = append(startedAt, revision.DateCreated)
+	}
+
+	for i := range stages {
+		end := now
+		if i+1 < len(stages) {
+			end = startedAt[i+1]
+			stages[i].EndedAt = end.Format(time.RFC3339)
+		} else {
+			stages[i].Current = true
+		}
+
+		stages[i].DurationDays = end.Sub(startedAt[i]).Hours() / 24
+	}
+
+	return stages
+}
+
+func RetrieveEntryTimeline(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	visible, err := utils.EntryVisible(c, db, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !visible {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT er.revision_number,
+			er.date_created,
+			COALESCE(t.name, '')
+		FROM entry_revision er
+		JOIN entry e ON e.id = er.entry_id
+		LEFT JOIN tags_entry_revision ter ON ter.entry_revision_id = er.id
+		LEFT JOIN tags t ON t.id = ter.tag_id AND t.classification = 'Progress'
+		WHERE er.entry_id = $1 AND e.archived_at IS NULL AND er.hidden_at IS NULL
+		ORDER BY er.revision_number
+	`, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	var revisions []revisionProgress
+
+	for rows.Next() {
+		var revisionNumber int
+		var dateCreated time.Time
+		var status string
+
+		if err := rows.Scan(&revisionNumber, &dateCreated, &status); err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		if len(revisions) == 0 || revisions[len(revisions)-1].RevisionNumber != revisionNumber {
+			revisions = append(revisions, revisionProgress{
+				RevisionNumber: revisionNumber,
+				DateCreated:    dateCreated,
+			})
+		}
+
+		if status != "" {
+			last := &revisions[len(revisions)-1]
+			last.Statuses = append(last.Statuses, status)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if len(revisions) == 0 {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	timeline := data.EntryTimeline{
+		EntryID: entryID,
+		Stages:  buildTimeline(revisions, time.Now()),
+	}
+
+	if len(timeline.Stages) > 0 {
+		timeline.CurrentStatus = timeline.Stages[len(timeline.Stages)-1].Status
+	}
+
+	c.JSON(http.StatusOK, timeline)
+}
+
+// RetrieveTimelineStats measures how long entries around a city took to get
+// from one Progress stage to another, using the first revision that reached
+// each stage.
+func RetrieveTimelineStats(c *gin.Context, db *sql.DB) {
+	var query data.TimelineStatsQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if query.From == "" {
+		query.From = "Lot Sold"
+	}
+	if query.To == "" {
+		query.To = "Construction Started"
+	}
+
+	if progressRank(query.From) == -1 || progressRank(query.To) == -1 {
+		messages.StatusBadRequest(c, errors.New("from and to must be Progress tags"))
+		return
+	}
+
+	city, err := retrieveCityByName(query.Location)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if city.Name == "" {
+		messages.StatusNotFound(c, errors.New("Unable to find city matching location."))
+		return
+	}
+
+	stats := data.TimelineStats{
+		City: city.Name,
+		From: query.From,
+		To:   query.To,
+	}
+
+	var medianDays, p25Days, p75Days sql.NullFloat64
+
+	err = db.QueryRow(`
+		WITH progress AS (
+			SELECT er.entry_id, er.date_created, t.name
+			FROM entry_revision er
+			JOIN entry e ON e.id = er.entry_id
+			JOIN tags_entry_revision ter ON ter.entry_revision_id = er.id
+			JOIN tags t ON t.id = ter.tag_id AND t.classification = 'Progress'
+			WHERE e.archived_at IS NULL
+			AND ST_DWithin(e.location, ST_MakePoint($1, $2)::geography, $3)
+		),
+		reached_from AS (
+			SELECT entry_id, MIN(date_created) AS reached_at
+			FROM progress
+			WHERE name = $4
+			GROUP BY entry_id
+		),
+		reached_to AS (
+			SELECT p.entry_id, MIN(p.date_created) AS reached_at
+			FROM progress p
+			JOIN reached_from f ON f.entry_id = p.entry_id AND p.date_created >= f.reached_at
+			WHERE p.name = $5
+			GROUP BY p.entry_id
+		),
+		durations AS (
+			SELECT EXTRACT(EPOCH FROM t.reached_at - f.reached_at) / 86400 AS days
+			FROM reached_from f
+			JOIN reached_to t ON t.entry_id = f.entry_id
+		)
+		SELECT COUNT(*),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY days),
+			percentile_cont(0.25) WITHIN GROUP (ORDER BY days),
+			percentile_cont(0.75) WITHIN GROUP (ORDER BY days)
+		FROM durations
+	`, city.Longitude, city.Latitude, utils.DistanceMeters(query.Distance, query.Unit), query.From, query.To).Scan(
+		&stats.SampleSize,
+		&medianDays,
+		&p25Days,
+		&p75Days,
+	)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if medianDays.Valid {
+		stats.MedianDays = &medianDays.Float64
+		stats.P25Days = &p25Days.Float64
+		stats.P75Days = &p75Days.Float64
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
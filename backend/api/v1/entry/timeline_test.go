@@ -0,0 +1,71 @@
+package entry
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	day := func(n int) time.Time {
+		return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, n)
+	}
+
+	revisions := []revisionProgress{
+		{RevisionNumber: 1, DateCreated: day(0), Statuses: []string{"Lot For Sale"}},
+		{RevisionNumber: 2, DateCreated: day(10)},
+		{RevisionNumber: 3, DateCreated: day(30), Statuses: []string{"Lot For Sale"}},
+		{RevisionNumber: 4, DateCreated: day(40), Statuses: []string{"Lot Sold"}},
+		{RevisionNumber: 5, DateCreated: day(100), Statuses: []string{"Lot Sold", "Construction Started"}},
+	}
+
+	stages := buildTimeline(revisions, day(130))
+
+	if len(stages) != 3 {
+		t.Fatalf("expected 3 stages, got %d: %+v", len(stages), stages)
+	}
+
+	expected := []struct {
+		status   string
+		revision int
+		days     float64
+		current  bool
+	}{
+		{"Lot For Sale", 1, 40, false},
+		{"Lot Sold", 4, 60, false},
+		{"Construction Started", 5, 30, true},
+	}
+
+	for i, want := range expected {
+		got := stages[i]
+
+		if got.Status != want.status || got.RevisionNumber != want.revision || got.Current != want.current {
+			t.Fatalf("stage %d: expected %+v, got %+v", i, want, got)
+		}
+		if math.Abs(got.DurationDays-want.days) > 1e-9 {
+			t.Fatalf("stage %d: expected %v days, got %v", i, want.days, got.DurationDays)
+		}
+	}
+
+	if stages[2].EndedAt != "" {
+		t.Fatalf("expected the current stage to have no end, got %s", stages[2].EndedAt)
+	}
+}
+
+func TestBuildTimelineWithoutProgressTags(t *testing.T) {
+	stages := buildTimeline([]revisionProgress{{RevisionNumber: 1, DateCreated: time.Now()}}, time.Now())
+
+	if len(stages) != 0 {
+		t.Fatalf("expected no stages, got %+v", stages)
+	}
+}
+
+func TestFurthestProgress(t *testing.T) {
+	if status := furthestProgress([]string{"Construction Started", "Lot Sold"}); status != "Construction Started" {
+		t.Fatalf("expected Construction Started, got %s", status)
+	}
+
+	if status := furthestProgress(nil); status != "" {
+		t.Fatalf("expected no status, got %s", status)
+	}
+}
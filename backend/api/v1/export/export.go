@@ -0,0 +1,261 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	data "backend/api/v1/data"
+)
+
+const (
+	FormatGeoJSON = "geojson"
+	FormatCSV     = "csv"
+	FormatKML     = "kml"
+)
+
+// Writer streams entries in one export format. Begin is called once before
+// the first entry and End once after the last, so nothing is held in memory
+// between entries.
+type Writer interface {
+	Begin() error
+	Write(entry data.ExportEntry) error
+	End() error
+}
+
+// NewWriter returns the writer for a format.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatGeoJSON:
+		return &geoJSONWriter{w: w}, nil
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatKML:
+		return &kmlWriter{w: w}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FormatGeoJSON:
+		return "application/geo+json"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatKML:
+		return "application/vnd.google-earth.kml+xml"
+	}
+
+	return "application/octet-stream"
+}
+
+// Filename is the download name for an export, e.g. entries.geojson.
+func Filename(format string) string {
+	return "entries." + format
+}
+
+// formatTags renders tags as "Classification: Name" joined by semicolons.
+func formatTags(tags []data.Tag) string {
+	formatted := make([]string, len(tags))
+
+	for i, tag := range tags {
+		formatted[i] = tag.Classification + ": " + tag.Name
+	}
+
+	return strings.Join(formatted, "; ")
+}
+
+type geoJSONWriter struct {
+	w       io.Writer
+	written int
+}
+
+type geoJSONFeature struct {
+	Type       string           `json:"type"`
+	ID         int              `json:"id"`
+	Geometry   json.RawMessage  `json:"geometry"`
+	Properties data.ExportEntry `json:"properties"`
+}
+
+func (g *geoJSONWriter) Begin() error {
+	_, err := io.WriteString(g.w, `{"type":"FeatureCollection","features":[`)
+	return err
+}
+
+// Write uses the footprint as the geometry when the entry has one and its
+// point otherwise. The point is always in the properties.
+func (g *geoJSONWriter) Write(entry data.ExportEntry) error {
+	geometry := entry.Footprint
+	if len(geometry) == 0 {
+		point, err := json.Marshal(map[string]any{
+			"type":        "Point",
+			"coordinates": []float64{entry.Longitude, entry.Latitude},
+		})
+		if err != nil {
+			return err
+		}
+		geometry = point
+	}
+
+	feature, err := json.Marshal(geoJSONFeature{
+		Type:       "Feature",
+		ID:         entry.ID,
+		Geometry:   geometry,
+		Properties: entry,
+	})
+	if err != nil {
+		return err
+	}
+
+	if g.written > 0 {
+		if _, err := io.WriteString(g.w, ","); err != nil {
+			return err
+		}
+	}
+	g.written++
+
+	_, err = g.w.Write(feature)
+	return err
+}
+
+func (g *geoJSONWriter) End() error {
+	_, err := io.WriteString(g.w, "]}\n")
+	return err
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+var csvHeader = []string{
+	"id",
+	"title",
+	"address",
+	"latitude",
+	"longitude",
+	"content",
+	"tags",
+	"upvotes",
+	"downvotes",
+	"revision_number",
+	"revision_date_created",
+	"date_created",
+	"username",
+	"footprint",
+}
+
+func (c *csvWriter) Begin() error {
+	return c.w.Write(csvHeader)
+}
+
+func (c *csvWriter) Write(entry data.ExportEntry) error {
+	return c.w.Write([]string{
+		strconv.Itoa(entry.ID),
+		csvText(entry.Title),
+		csvText(entry.Address),
+		strconv.FormatFloat(entry.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(entry.Longitude, 'f', -1, 64),
+		csvText(entry.Content),
+		csvText(formatTags(entry.Tags)),
+		strconv.Itoa(entry.Upvotes),
+		strconv.Itoa(entry.Downvotes),
+		strconv.Itoa(entry.RevisionNumber),
+		entry.RevisionDateCreated,
+		entry.DateCreated,
+		csvText(entry.Username),
+		string(entry.Footprint),
+	})
+}
+
+// csvText keeps user text from running as a formula when the export is
+// opened in a spreadsheet. Cells that would start one are prefixed with a
+// quote, which spreadsheets read as "this is text".
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+func (c *csvWriter) End() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type kmlWriter struct {
+	w io.Writer
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlExtendedData struct {
+	Data []kmlData `xml:"Data"`
+}
+
+type kmlPlacemark struct {
+	XMLName      xml.Name        `xml:"Placemark"`
+	ID           string          `xml:"id,attr"`
+	Name         string          `xml:"name"`
+	Address      string          `xml:"address"`
+	Description  string          `xml:"description"`
+	ExtendedData kmlExtendedData `xml:"ExtendedData"`
+	Geometry     string          `xml:",innerxml"`
+}
+
+func (k *kmlWriter) Begin() error {
+	_, err := io.WriteString(k.w, xml.Header+
+		`<kml xmlns="http://www.opengis.net/kml/2.2"><Document><name>Entries</name>`)
+	return err
+}
+
+// Write places the entry at its point and, when it has a footprint, adds the
+// polygons in a MultiGeometry. FootprintKML comes from PostGIS ST_AsKML.
+func (k *kmlWriter) Write(entry data.ExportEntry) error {
+	point := fmt.Sprintf(
+		"<Point><coordinates>%s,%s</coordinates></Point>",
+		strconv.FormatFloat(entry.Longitude, 'f', -1, 64),
+		strconv.FormatFloat(entry.Latitude, 'f', -1, 64),
+	)
+
+	geometry := point
+	if entry.FootprintKML != "" {
+		geometry = "<MultiGeometry>" + point + entry.FootprintKML + "</MultiGeometry>"
+	}
+
+	placemark, err := xml.Marshal(kmlPlacemark{
+		ID:          "entry-" + strconv.Itoa(entry.ID),
+		Name:        entry.Title,
+		Address:     entry.Address,
+		Description: entry.Content,
+		ExtendedData: kmlExtendedData{Data: []kmlData{
+			{Name: "tags", Value: formatTags(entry.Tags)},
+			{Name: "upvotes", Value: strconv.Itoa(entry.Upvotes)},
+			{Name: "downvotes", Value: strconv.Itoa(entry.Downvotes)},
+			{Name: "revision_number", Value: strconv.Itoa(entry.RevisionNumber)},
+			{Name: "revision_date_created", Value: entry.RevisionDateCreated},
+			{Name: "date_created", Value: entry.DateCreated},
+			{Name: "username", Value: entry.Username},
+		}},
+		Geometry: geometry,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = k.w.Write(placemark)
+	return err
+}
+
+func (k *kmlWriter) End() error {
+	_, err := io.WriteString(k.w, "</Document></kml>\n")
+	return err
+}
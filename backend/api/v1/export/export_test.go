@@ -0,0 +1,155 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	data "backend/api/v1/data"
+)
+
+var entries = []data.ExportEntry{
+	{
+		ID:        1,
+		Title:     "Tower, Phase 2",
+		Address:   "1 Main St",
+		Content:   "Twelve storeys <and> retail",
+		Longitude: -79.38,
+		Latitude:  43.65,
+		Tags:      []data.Tag{{Name: "Residential", Classification: "Zoning"}},
+		Upvotes:   3,
+	},
+	{
+		ID:           2,
+		Title:        "Lot",
+		Longitude:    1,
+		Latitude:     1,
+		Footprint:    json.RawMessage(`{"type":"MultiPolygon","coordinates":[[[[0,0],[2,0],[2,2],[0,0]]]]}`),
+		FootprintKML: "<MultiGeometry><Polygon/></MultiGeometry>",
+	},
+}
+
+func write(t *testing.T, format string) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+
+	writer, err := NewWriter(format, &buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := writer.Write(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.End(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestGeoJSONWriter(t *testing.T) {
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry   struct{ Type string } `json:"geometry"`
+			Properties data.ExportEntry      `json:"properties"`
+		} `json:"features"`
+	}
+
+	if err := json.Unmarshal(write(t, FormatGeoJSON), &collection); err != nil {
+		t.Fatal(err)
+	}
+
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 2 {
+		t.Fatalf("unexpected collection %+v", collection)
+	}
+	if collection.Features[0].Geometry.Type != "Point" || collection.Features[1].Geometry.Type != "MultiPolygon" {
+		t.Errorf("got geometries %+v", collection.Features)
+	}
+	if collection.Features[0].Properties.Upvotes != 3 {
+		t.Errorf("got properties %+v", collection.Features[0].Properties)
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	records, err := csv.NewReader(bytes.NewReader(write(t, FormatCSV))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 3 || len(records[1]) != len(csvHeader) {
+		t.Fatalf("got %d records", len(records))
+	}
+	if records[1][1] != "Tower, Phase 2" || records[1][6] != "Zoning: Residential" {
+		t.Errorf("got row %q", records[1])
+	}
+}
+
+func TestCSVWriterEscapesFormulas(t *testing.T) {
+	var buffer bytes.Buffer
+
+	writer, err := NewWriter(FormatCSV, &buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writer.Write(data.ExportEntry{
+		ID:        3,
+		Title:     "=HYPERLINK(\"http://example.com\")",
+		Address:   "@SUM(A1)",
+		Content:   "-2+3",
+		Username:  "+cmd",
+		Longitude: -79.38,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.End(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := records[0]
+	for _, column := range []int{1, 2, 5, 12} {
+		if row[column][0] != '\'' {
+			t.Errorf("column %s was not escaped: %q", csvHeader[column], row[column])
+		}
+	}
+	if row[4] != "-79.38" {
+		t.Errorf("numbers should be written as is, got longitude %q", row[4])
+	}
+}
+
+func TestKMLWriter(t *testing.T) {
+	var document struct {
+		Placemarks []struct {
+			Name        string `xml:"name"`
+			Description string `xml:"description"`
+			Point       string `xml:"Point>coordinates"`
+		} `xml:"Document>Placemark"`
+	}
+
+	if err := xml.Unmarshal(write(t, FormatKML), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Placemarks) != 2 {
+		t.Fatalf("got %d placemarks", len(document.Placemarks))
+	}
+	if document.Placemarks[0].Description != "Twelve storeys <and> retail" || document.Placemarks[0].Point != "-79.38,43.65" {
+		t.Errorf("got placemark %+v", document.Placemarks[0])
+	}
+}
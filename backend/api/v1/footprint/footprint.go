@@ -0,0 +1,116 @@
+package footprint
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// MaxAreaSquareMeters caps a footprint at roughly a large city block
+// development; anything bigger is almost certainly a mistake.
+const MaxAreaSquareMeters = 2000000
+
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    json.RawMessage `json:"geometry"`
+}
+
+// IsNull reports whether raw is an explicit JSON null, which clears a
+// footprint, as opposed to an absent field, which keeps the current one.
+func IsNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// Parse extracts a Polygon or MultiPolygon geometry from raw GeoJSON, which
+// may also be a Feature wrapping one. It returns the geometry as GeoJSON.
+func Parse(raw json.RawMessage) (string, error) {
+	var object geoJSON
+
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return "", errors.New("Footprint must be GeoJSON")
+	}
+
+	if object.Type == "Feature" {
+		if len(object.Geometry) == 0 || IsNull(object.Geometry) {
+			return "", errors.New("Footprint feature has no geometry")
+		}
+
+		return Parse(object.Geometry)
+	}
+
+	if object.Type != "Polygon" && object.Type != "MultiPolygon" {
+		return "", fmt.Errorf("Footprint must be a Polygon or MultiPolygon, got %q", object.Type)
+	}
+
+	if len(object.Coordinates) == 0 {
+		return "", errors.New("Footprint has no coordinates")
+	}
+
+	geometry, err := json.Marshal(struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}{object.Type, object.Coordinates})
+	if err != nil {
+		return "", err
+	}
+
+	return string(geometry), nil
+}
+
+// Validate has PostGIS check that a parsed footprint is a valid geometry and
+// stays under the area cap.
+func Validate(db queryer, geometry string) error {
+	var valid bool
+	var reason string
+	var area float64
+
+	err := db.QueryRow(`
+		SELECT ST_IsValid(g), ST_IsValidReason(g), ST_Area(g::geography)
+		FROM (SELECT ST_SetSRID(ST_GeomFromGeoJSON($1), 4326) AS g) footprint
+	`, geometry).Scan(&valid, &reason, &area)
+	if err != nil {
+		return errors.New("Footprint could not be read as a geometry")
+	}
+
+	if !valid {
+		return fmt.Errorf("Footprint is not a valid polygon: %s", reason)
+	}
+
+	if area > MaxAreaSquareMeters {
+		return fmt.Errorf("Footprint covers %.0f square meters, the limit is %d", area, MaxAreaSquareMeters)
+	}
+
+	return nil
+}
+
+// Apply stores geometry on a revision and makes it the entry's current
+// footprint. An empty geometry clears it.
+func Apply(tx execer, entryID int, entryRevisionId int, geometry string) error {
+	_, err := tx.Exec(`
+		UPDATE entry_revision
+		SET footprint = ST_Multi(ST_SetSRID(ST_GeomFromGeoJSON(NULLIF($2, '')), 4326))::geography
+		WHERE id = $1
+	`, entryRevisionId, geometry)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE entry
+		SET footprint = (SELECT footprint FROM entry_revision WHERE id = $2)
+		WHERE id = $1
+	`, entryID, entryRevisionId)
+
+	return err
+}
@@ -0,0 +1,49 @@
+package footprint
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const square = `{"type":"Polygon","coordinates":[[[-81.38,28.54],[-81.37,28.54],[-81.37,28.55],[-81.38,28.54]]]}`
+
+func TestParseAcceptsPolygonsAndFeatures(t *testing.T) {
+	for _, raw := range []string{
+		square,
+		`{"type":"Feature","properties":{"name":"lot"},"geometry":` + square + `}`,
+		`{"type":"MultiPolygon","coordinates":[[[[-81.38,28.54],[-81.37,28.54],[-81.37,28.55],[-81.38,28.54]]]]}`,
+	} {
+		geometry, err := Parse(json.RawMessage(raw))
+		if err != nil {
+			t.Fatalf("expected %s to parse, got %v", raw, err)
+		}
+
+		var object geoJSON
+		if err := json.Unmarshal([]byte(geometry), &object); err != nil || object.Type == "Feature" {
+			t.Fatalf("expected a bare geometry, got %s", geometry)
+		}
+	}
+}
+
+func TestParseRejectsOtherGeometries(t *testing.T) {
+	for _, raw := range []string{
+		`{"type":"Point","coordinates":[-81.38,28.54]}`,
+		`{"type":"LineString","coordinates":[[-81.38,28.54],[-81.37,28.54]]}`,
+		`{"type":"Feature","geometry":null}`,
+		`{"type":"Polygon"}`,
+		`"not geojson"`,
+	} {
+		if _, err := Parse(json.RawMessage(raw)); err == nil {
+			t.Fatalf("expected %s to be rejected", raw)
+		}
+	}
+}
+
+func TestIsNull(t *testing.T) {
+	if !IsNull(json.RawMessage(" null ")) {
+		t.Fatalf("expected null to clear the footprint")
+	}
+	if IsNull(nil) || IsNull(json.RawMessage(square)) {
+		t.Fatalf("expected only an explicit null to clear the footprint")
+	}
+}
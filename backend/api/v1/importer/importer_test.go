@@ -0,0 +1,96 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+const csvMapping = `
+title: [name, phase]
+address: address
+latitude: lat
+longitude: lon
+description: notes
+permit_number: permit
+zoning:
+  column: zone
+  values:
+    R1: Residential
+  default: Mixed Use
+`
+
+func TestParseMappingRequiresFields(t *testing.T) {
+	if _, err := ParseMapping([]byte("title: name"), FormatCSV); err == nil {
+		t.Fatal("expected an error for a mapping without address and description")
+	}
+
+	if _, err := ParseMapping([]byte(csvMapping), ""); err == nil {
+		t.Fatal("expected an error for a mapping without a format")
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	mapping, err := ParseMapping([]byte(csvMapping), FormatFromFilename("permits.CSV"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := "\ufeffname,phase,address,lat,lon,notes,permit,zone\n" +
+		"Tower,Phase 2,1 Main St,43.65,-79.38,Twelve storeys,BP-1,R1\n" +
+		"Plaza,,2 Main St,,,Retail,BP-2,C9\n" +
+		"Annex,,\"Unit 1200, 300 The Boulevard of Remarkably Long Street Names, East Wing\",43.6,-79.4,Offices,BP-3,R1\n"
+
+	records, err := Read(strings.NewReader(source), mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+
+	tower := records[0]
+	if tower.Error != "" || tower.Title != "Tower Phase 2" || tower.PermitNumber != "BP-1" {
+		t.Errorf("unexpected record %+v", tower)
+	}
+	if tower.Latitude != 43.65 || tower.Longitude != -79.38 {
+		t.Errorf("got coordinates %v, %v", tower.Latitude, tower.Longitude)
+	}
+	if len(tower.Tags) != 1 || tower.Tags[0].Name != "Residential" {
+		t.Errorf("got tags %+v", tower.Tags)
+	}
+
+	if records[1].Line != 3 || records[1].Error != "no coordinates" {
+		t.Errorf("got line %d error %q", records[1].Line, records[1].Error)
+	}
+
+	if records[2].Error != "address is too long" {
+		t.Errorf("got error %q for a long address", records[2].Error)
+	}
+}
+
+func TestReadGeoJSONPolygon(t *testing.T) {
+	mapping, err := ParseMapping([]byte("title: name\naddress: address\ndescription: notes\n"), FormatGeoJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := `{"type": "FeatureCollection", "features": [{
+		"type": "Feature",
+		"properties": {"name": "Lot", "address": "3 Main St", "notes": "Parking"},
+		"geometry": {"type": "Polygon", "coordinates": [[[0, 0], [2, 0], [2, 2], [0, 2], [0, 0]]]}
+	}]}`
+
+	records, err := Read(strings.NewReader(source), mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lot := records[0]
+	if lot.Error != "" || lot.Footprint == "" {
+		t.Fatalf("unexpected record %+v", lot)
+	}
+	if lot.Latitude != 1 || lot.Longitude != 1 {
+		t.Errorf("got coordinates %v, %v, want 1, 1", lot.Latitude, lot.Longitude)
+	}
+}
@@ -0,0 +1,133 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatGeoJSON = "geojson"
+)
+
+// Columns names one or more source columns (CSV) or properties (GeoJSON). In
+// the mapping file it is either a single name or a list of names whose
+// non-empty values are joined.
+type Columns []string
+
+func (c *Columns) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*c = Columns{node.Value}
+		return nil
+	case yaml.SequenceNode:
+		var names []string
+		if err := node.Decode(&names); err != nil {
+			return err
+		}
+		*c = names
+		return nil
+	}
+
+	return fmt.Errorf("line %d: expected a column name or a list of column names", node.Line)
+}
+
+func (c Columns) value(row map[string]string, separator string) string {
+	var values []string
+
+	for _, column := range c {
+		if value := strings.TrimSpace(row[column]); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return strings.Join(values, separator)
+}
+
+// TagMapping turns a source column into a tag of one classification. Values
+// translates source codes into tag names; when it is empty the source value is
+// used as is, otherwise unknown codes fall back to Default or produce no tag.
+type TagMapping struct {
+	Column  string            `yaml:"column"`
+	Values  map[string]string `yaml:"values"`
+	Default string            `yaml:"default"`
+}
+
+func (t TagMapping) value(row map[string]string) string {
+	if t.Column == "" {
+		return t.Default
+	}
+
+	raw := strings.TrimSpace(row[t.Column])
+
+	if len(t.Values) == 0 {
+		if raw == "" {
+			return t.Default
+		}
+		return raw
+	}
+
+	if name, ok := t.Values[raw]; ok {
+		return name
+	}
+
+	return t.Default
+}
+
+type Mapping struct {
+	Format       string     `yaml:"format"`
+	Title        Columns    `yaml:"title"`
+	Address      Columns    `yaml:"address"`
+	Latitude     string     `yaml:"latitude"`
+	Longitude    string     `yaml:"longitude"`
+	Description  Columns    `yaml:"description"`
+	PermitNumber string     `yaml:"permit_number"`
+	Zoning       TagMapping `yaml:"zoning"`
+	Progress     TagMapping `yaml:"progress"`
+}
+
+// ParseMapping reads a YAML mapping file. format is used when the mapping
+// does not name one itself, e.g. when it was inferred from a file extension.
+func ParseMapping(content []byte, format string) (Mapping, error) {
+	var mapping Mapping
+
+	if err := yaml.Unmarshal(content, &mapping); err != nil {
+		return mapping, fmt.Errorf("invalid mapping: %w", err)
+	}
+
+	if mapping.Format == "" {
+		mapping.Format = format
+	}
+	mapping.Format = strings.ToLower(mapping.Format)
+
+	if mapping.Format != FormatCSV && mapping.Format != FormatGeoJSON {
+		return mapping, errors.New("mapping format must be csv or geojson")
+	}
+
+	if len(mapping.Title) == 0 || len(mapping.Address) == 0 || len(mapping.Description) == 0 {
+		return mapping, errors.New("mapping must map title, address and description")
+	}
+
+	if mapping.Format == FormatCSV && (mapping.Latitude == "" || mapping.Longitude == "") {
+		return mapping, errors.New("csv mappings must map latitude and longitude")
+	}
+
+	return mapping, nil
+}
+
+// FormatFromFilename infers the source format from a file extension.
+func FormatFromFilename(name string) string {
+	name = strings.ToLower(name)
+
+	switch {
+	case strings.HasSuffix(name, ".csv"):
+		return FormatCSV
+	case strings.HasSuffix(name, ".geojson"), strings.HasSuffix(name, ".json"):
+		return FormatGeoJSON
+	}
+
+	return ""
+}
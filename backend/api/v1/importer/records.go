@@ -0,0 +1,240 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	data "backend/api/v1/data"
+	structs "backend/api/v1/structs"
+)
+
+// Record is one source row translated through a mapping. Rows that could not
+// be translated carry an Error and are reported instead of imported.
+type Record struct {
+	Line         int
+	Title        string
+	Address      string
+	Latitude     float64
+	Longitude    float64
+	Description  string
+	PermitNumber string
+	Tags         []structs.Tag
+	Footprint    string
+	Error        string
+}
+
+// Read translates every row of a CSV or GeoJSON source.
+func Read(source io.Reader, mapping Mapping) ([]Record, error) {
+	switch mapping.Format {
+	case FormatCSV:
+		return readCSV(source, mapping)
+	case FormatGeoJSON:
+		return readGeoJSON(source, mapping)
+	}
+
+	return nil, fmt.Errorf("unsupported format %q", mapping.Format)
+}
+
+func readCSV(source io.Reader, mapping Mapping) ([]Record, error) {
+	reader := csv.NewReader(source)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+
+	var records []Record
+
+	for line := 2; ; line++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		row := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(fields) {
+				row[column] = fields[i]
+			}
+		}
+
+		records = append(records, translate(line, row, nil, mapping))
+	}
+
+	return records, nil
+}
+
+type feature struct {
+	Type       string         `json:"type"`
+	Properties map[string]any `json:"properties"`
+	Geometry   *geometry      `json:"geometry"`
+}
+
+type geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+func readGeoJSON(source io.Reader, mapping Mapping) ([]Record, error) {
+	decoder := json.NewDecoder(source)
+	decoder.UseNumber()
+
+	var collection struct {
+		Type     string    `json:"type"`
+		Features []feature `json:"features"`
+	}
+
+	if err := decoder.Decode(&collection); err != nil {
+		return nil, fmt.Errorf("invalid geojson: %w", err)
+	}
+
+	if collection.Type != "FeatureCollection" {
+		return nil, errors.New("geojson source must be a FeatureCollection")
+	}
+
+	records := make([]Record, 0, len(collection.Features))
+
+	for i, feature := range collection.Features {
+		row := make(map[string]string, len(feature.Properties))
+		for key, value := range feature.Properties {
+			if value != nil {
+				row[key] = fmt.Sprint(value)
+			}
+		}
+
+		records = append(records, translate(i+1, row, feature.Geometry, mapping))
+	}
+
+	return records, nil
+}
+
+func translate(line int, row map[string]string, shape *geometry, mapping Mapping) Record {
+	record := Record{
+		Line:         line,
+		Title:        mapping.Title.value(row, " "),
+		Address:      mapping.Address.value(row, ", "),
+		Description:  mapping.Description.value(row, "\n\n"),
+		PermitNumber: strings.TrimSpace(row[mapping.PermitNumber]),
+	}
+
+	if zoning := mapping.Zoning.value(row); zoning != "" {
+		record.Tags = append(record.Tags, structs.Tag{Name: zoning, Classification: "Zoning"})
+	}
+	if progress := mapping.Progress.value(row); progress != "" {
+		record.Tags = append(record.Tags, structs.Tag{Name: progress, Classification: "Progress"})
+	}
+
+	located := false
+
+	if shape != nil {
+		var err error
+
+		located, err = record.locate(shape)
+		if err != nil {
+			record.Error = err.Error()
+			return record
+		}
+	}
+
+	if mapping.Latitude != "" && mapping.Longitude != "" && row[mapping.Latitude] != "" {
+		latitude, latErr := strconv.ParseFloat(strings.TrimSpace(row[mapping.Latitude]), 64)
+		longitude, lonErr := strconv.ParseFloat(strings.TrimSpace(row[mapping.Longitude]), 64)
+		if latErr != nil || lonErr != nil {
+			record.Error = "coordinates are not numbers"
+			return record
+		}
+
+		record.Latitude, record.Longitude = latitude, longitude
+		located = true
+	}
+
+	switch {
+	case !located:
+		record.Error = "no coordinates"
+	case record.Latitude < -90 || record.Latitude > 90 || record.Longitude < -180 || record.Longitude > 180:
+		record.Error = "coordinates are out of range"
+	case record.Title == "":
+		record.Error = "no title"
+	case record.Address == "":
+		record.Error = "no address"
+	case utf8.RuneCountInString(record.Address) > data.MaxAddressLength:
+		record.Error = "address is too long"
+	case record.Description == "":
+		record.Error = "no description"
+	}
+
+	return record
+}
+
+// locate takes a feature's position from its geometry. Points are used as is;
+// polygons become the footprint and are placed at the mean of their outer
+// ring.
+func (r *Record) locate(shape *geometry) (bool, error) {
+	switch shape.Type {
+	case "Point":
+		var point []float64
+		if err := json.Unmarshal(shape.Coordinates, &point); err != nil || len(point) < 2 {
+			return false, errors.New("invalid point geometry")
+		}
+
+		r.Longitude, r.Latitude = point[0], point[1]
+		return true, nil
+
+	case "Polygon", "MultiPolygon":
+		var ring [][]float64
+
+		if shape.Type == "Polygon" {
+			var polygon [][][]float64
+			if err := json.Unmarshal(shape.Coordinates, &polygon); err != nil || len(polygon) == 0 {
+				return false, errors.New("invalid polygon geometry")
+			}
+			ring = polygon[0]
+		} else {
+			var polygons [][][][]float64
+			if err := json.Unmarshal(shape.Coordinates, &polygons); err != nil || len(polygons) == 0 || len(polygons[0]) == 0 {
+				return false, errors.New("invalid multipolygon geometry")
+			}
+			ring = polygons[0][0]
+		}
+
+		// the closing vertex repeats the first one
+		if len(ring) > 1 {
+			ring = ring[:len(ring)-1]
+		}
+		if len(ring) == 0 {
+			return false, errors.New("polygon has no vertices")
+		}
+
+		for _, vertex := range ring {
+			if len(vertex) < 2 {
+				return false, errors.New("invalid polygon vertex")
+			}
+			r.Longitude += vertex[0] / float64(len(ring))
+			r.Latitude += vertex[1] / float64(len(ring))
+		}
+
+		footprint, err := json.Marshal(shape)
+		if err != nil {
+			return false, err
+		}
+		r.Footprint = string(footprint)
+
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,100 @@
+package markdown
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// MaxSourceLength caps the Markdown accepted for a single entry or comment.
+const MaxSourceLength = 20000
+
+var allowedSchemes = []string{"http", "https", "mailto"}
+
+// AllowedElements is the full set of HTML elements rendered content may
+// contain. Everything else Markdown can produce is stripped to its text.
+var AllowedElements = []string{"p", "br", "a", "em", "strong", "ul", "ol", "li", "blockquote"}
+
+var renderer = goldmark.New(
+	goldmark.WithParserOptions(
+		parser.WithASTTransformers(util.Prioritized(linkNormalizer{}, 100)),
+	),
+)
+
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	policy := bluemonday.NewPolicy()
+
+	policy.AllowElements(AllowedElements...)
+	policy.AllowAttrs("href").OnElements("a")
+	policy.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+
+	policy.AllowURLSchemes(allowedSchemes...)
+	policy.RequireParseableURLs(true)
+	policy.AllowRelativeURLs(false)
+	policy.RequireNoFollowOnLinks(true)
+	policy.RequireNoReferrerOnLinks(true)
+
+	return policy
+}
+
+// linkNormalizer rewrites link destinations into a canonical form and drops
+// the ones the sanitizer would reject anyway, so the link text survives.
+type linkNormalizer struct{}
+
+func (linkNormalizer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if link, ok := node.(*ast.Link); ok && entering {
+			link.Destination = []byte(normalizeURL(string(link.Destination)))
+			link.Title = nil
+		}
+
+		return ast.WalkContinue, nil
+	})
+}
+
+// normalizeURL lowercases the scheme and host of an absolute link and
+// re-encodes it. Links with a disallowed or missing scheme become empty.
+func normalizeURL(raw string) string {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return ""
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	allowed := false
+	for _, candidate := range allowedSchemes {
+		if scheme == candidate {
+			allowed = true
+		}
+	}
+
+	if !allowed || (scheme != "mailto" && parsed.Host == "") {
+		return ""
+	}
+
+	parsed.Scheme = scheme
+	parsed.Host = strings.ToLower(parsed.Host)
+
+	return parsed.String()
+}
+
+// Render converts Markdown source into sanitized HTML. Raw HTML in the source
+// is never passed through.
+func Render(source string) string {
+	var buf bytes.Buffer
+
+	if err := renderer.Convert([]byte(source), &buf); err != nil {
+		return policy.Sanitize(source)
+	}
+
+	return strings.TrimSpace(policy.Sanitize(buf.String()))
+}
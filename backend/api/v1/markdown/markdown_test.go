@@ -0,0 +1,112 @@
+package markdown
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var tagPattern = regexp.MustCompile(`<\s*/?\s*([a-zA-Z0-9]+)`)
+
+func assertAllowlisted(t *testing.T, rendered string) {
+	t.Helper()
+
+	for _, match := range tagPattern.FindAllStringSubmatch(rendered, -1) {
+		if !slices.Contains(AllowedElements, strings.ToLower(match[1])) {
+			t.Fatalf("unexpected <%s> in %q", match[1], rendered)
+		}
+	}
+}
+
+func TestRenderAllowedFormatting(t *testing.T) {
+	cases := map[string]string{
+		"emphasis": "*new* **tower**",
+		"lists":    "- one\n- two\n\n3. three\n4. four",
+		"quotes":   "> quoted from the permit",
+		"links":    "[permit](https://example.com/permits?id=1)",
+	}
+
+	expected := map[string][]string{
+		"emphasis": {"<em>new</em>", "<strong>tower</strong>"},
+		"lists":    {"<ul>", "<li>one</li>", `<ol start="3">`},
+		"quotes":   {"<blockquote>"},
+		"links":    {`href="https://example.com/permits?id=1"`, `rel="nofollow noreferrer"`},
+	}
+
+	for name, source := range cases {
+		rendered := Render(source)
+
+		assertAllowlisted(t, rendered)
+
+		for _, fragment := range expected[name] {
+			if !strings.Contains(rendered, fragment) {
+				t.Fatalf("%s: expected %q in %q", name, fragment, rendered)
+			}
+		}
+	}
+}
+
+func TestRenderStripsEverythingElse(t *testing.T) {
+	sources := []string{
+		"<script>alert(1)</script>",
+		"<b onclick=\"alert(1)\">bold</b>",
+		"<iframe src=\"https://example.com\"></iframe>",
+		"# Heading",
+		"![photo](https://example.com/a.png)",
+		"```\ncode\n```",
+		"`inline`",
+		"---",
+		"| a | b |\n|---|---|\n| 1 | 2 |",
+	}
+
+	for _, source := range sources {
+		rendered := Render(source)
+
+		assertAllowlisted(t, rendered)
+
+		for _, forbidden := range []string{"script", "onclick", "iframe", "<img", "<h1", "<code", "<pre", "<hr"} {
+			if strings.Contains(rendered, forbidden) {
+				t.Fatalf("expected %q to be stripped from %q", forbidden, rendered)
+			}
+		}
+	}
+}
+
+func TestRenderRejectsUnsafeLinks(t *testing.T) {
+	sources := []string{
+		"[click](javascript:alert(1))",
+		"[click](JaVaScRiPt:alert(1))",
+		"[click](data:text/html;base64,PHNjcmlwdD4=)",
+		"[click](/relative/path)",
+		"[click](//example.com)",
+		"<javascript:alert(1)>",
+	}
+
+	for _, source := range sources {
+		rendered := Render(source)
+
+		if strings.Contains(rendered, "href") {
+			t.Fatalf("expected no link in %q", rendered)
+		}
+		if strings.HasPrefix(source, "[click]") && !strings.Contains(rendered, "click") {
+			t.Fatalf("expected link text to survive in %q", rendered)
+		}
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	cases := map[string]string{
+		"HTTPS://Example.COM/Path":          "https://example.com/Path",
+		" https://example.com/a b ":         "https://example.com/a%20b",
+		"mailto:planning@example.com":       "mailto:planning@example.com",
+		"ftp://example.com/file":            "",
+		"javascript:alert(document.cookie)": "",
+	}
+
+	for raw, want := range cases {
+		if got := normalizeURL(raw); got != want {
+			t.Fatalf("normalizeURL(%q): expected %q, got %q", raw, want, got)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"golang.org/x/image/draw"
+)
+
+const thumbnailMaxDimension = 320
+
+// maxImagePixels caps the decoded size of an image. A small compressed file
+// can declare enormous dimensions, and decoding allocates all of them (twice,
+// once orientation is applied).
+const maxImagePixels = 50_000_000
+
+var ErrImageTooLarge = fmt.Errorf("Image is larger than %d megapixels", maxImagePixels/1_000_000)
+
+// checkImageSize reads only the image header and rejects images too large to
+// decode safely.
+func checkImageSize(content []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	if config.Width <= 0 || config.Height <= 0 {
+		return errors.New("Image has no pixels")
+	}
+
+	if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return ErrImageTooLarge
+	}
+
+	return nil
+}
+
+type processedImage struct {
+	Body      []byte
+	Thumbnail []byte
+	Width     int
+	Height    int
+}
+
+// processImage decodes an uploaded image and encodes it again. Only pixels
+// survive the round trip, so EXIF (GPS position, camera serials) and any other
+// embedded metadata is stripped. The EXIF orientation is applied to the pixels
+// first so photos don't come out sideways once the tag is gone.
+func processImage(content []byte, mimeType string) (processedImage, error) {
+	var processed processedImage
+
+	if err := checkImageSize(content); err != nil {
+		return processed, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return processed, err
+	}
+
+	if mimeType == "image/jpeg" {
+		img = applyOrientation(img, readOrientation(content))
+	}
+
+	var body bytes.Buffer
+
+	if mimeType == "image/png" {
+		err = png.Encode(&body, img)
+	} else {
+		err = jpeg.Encode(&body, img, &jpeg.Options{Quality: 90})
+	}
+	if err != nil {
+		return processed, err
+	}
+
+	var thumbnail bytes.Buffer
+
+	if err := jpeg.Encode(&thumbnail, resizeToFit(img, thumbnailMaxDimension), &jpeg.Options{Quality: 80}); err != nil {
+		return processed, err
+	}
+
+	processed.Body = body.Bytes()
+	processed.Thumbnail = thumbnail.Bytes()
+	processed.Width = img.Bounds().Dx()
+	processed.Height = img.Bounds().Dy()
+
+	return processed, nil
+}
+
+type Geotag struct {
+	Latitude   float64
+	Longitude  float64
+	CapturedAt time.Time
+}
+
+// ReadGeotag returns the GPS position and capture time from a photo's EXIF.
+// It has to run on the original upload, processImage strips both.
+func ReadGeotag(content []byte) (Geotag, bool) {
+	var geotag Geotag
+
+	metadata, err := exif.Decode(bytes.NewReader(content))
+	if err != nil {
+		return geotag, false
+	}
+
+	geotag.Latitude, geotag.Longitude, err = metadata.LatLong()
+	if err != nil {
+		return geotag, false
+	}
+
+	if geotag.Latitude == 0 && geotag.Longitude == 0 {
+		return geotag, false
+	}
+
+	if capturedAt, err := metadata.DateTime(); err == nil {
+		geotag.CapturedAt = capturedAt
+	}
+
+	return geotag, true
+}
+
+func readOrientation(content []byte) int {
+	metadata, err := exif.Decode(bytes.NewReader(content))
+	if err != nil {
+		return 1
+	}
+
+	tag, err := metadata.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+
+	orientation, err := tag.Int(0)
+	if err != nil {
+		return 1
+	}
+
+	return orientation
+}
+
+// applyOrientation turns img upright according to an EXIF orientation value
+// (1-8). Values 5-8 swap width and height.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	outWidth, outHeight := width, height
+	if orientation >= 5 {
+		outWidth, outHeight = height, width
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, outWidth, outHeight))
+
+	for y := 0; y < outHeight; y++ {
+		for x := 0; x < outWidth; x++ {
+			var srcX, srcY int
+
+			switch orientation {
+			case 2:
+				srcX, srcY = width-1-x, y
+			case 3:
+				srcX, srcY = width-1-x, height-1-y
+			case 4:
+				srcX, srcY = x, height-1-y
+			case 5:
+				srcX, srcY = y, x
+			case 6:
+				srcX, srcY = y, height-1-x
+			case 7:
+				srcX, srcY = width-1-y, height-1-x
+			case 8:
+				srcX, srcY = width-1-y, x
+			}
+
+			out.Set(x, y, img.At(bounds.Min.X+srcX, bounds.Min.Y+srcY))
+		}
+	}
+
+	return out
+}
+
+func resizeToFit(img image.Image, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width <= maxDimension && height <= maxDimension {
+		return img
+	}
+
+	if width >= height {
+		height = max(1, height*maxDimension/width)
+		width = maxDimension
+	} else {
+		width = max(1, width*maxDimension/height)
+		height = maxDimension
+	}
+
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Over, nil)
+
+	return resized
+}
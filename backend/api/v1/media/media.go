@@ -0,0 +1,639 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	audit "backend/api/v1/audit"
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+const maxUploadBytes = 15 << 20
+
+// allowedMimeTypes maps the sniffed content type of an upload to the file
+// extension it is stored under. Anything else is rejected.
+var allowedMimeTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"application/pdf": ".pdf",
+}
+
+func sniffMimeType(content []byte) string {
+	mimeType := http.DetectContentType(content)
+
+	if i := strings.Index(mimeType, ";"); i != -1 {
+		mimeType = mimeType[:i]
+	}
+
+	return mimeType
+}
+
+func randomKey() (string, error) {
+	buf := make([]byte, 16)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+var ErrMediaNotFound = errors.New("Media not found or already attached")
+var ErrNotLatestRevision = errors.New("Media can only be added to the latest revision")
+var ErrEntryLocked = errors.New("Entry is locked, only moderators can add media")
+
+type Upload struct {
+	Content   []byte
+	MimeType  string
+	Extension string
+	Filename  string
+}
+
+// ReadUpload reads the "file" form field. The content type is sniffed from
+// the bytes themselves, whatever the client claims it is.
+func ReadUpload(c *gin.Context) (Upload, error) {
+	var upload Upload
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return upload, err
+	}
+
+	if fileHeader.Size > maxUploadBytes {
+		return upload, fmt.Errorf("File is larger than %d MB", maxUploadBytes>>20)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return upload, err
+	}
+	defer file.Close()
+
+	upload.Content, err = io.ReadAll(io.LimitReader(file, maxUploadBytes+1))
+	if err != nil {
+		return upload, err
+	}
+
+	if len(upload.Content) > maxUploadBytes {
+		return upload, fmt.Errorf("File is larger than %d MB", maxUploadBytes>>20)
+	}
+
+	upload.MimeType = sniffMimeType(upload.Content)
+
+	extension, ok := allowedMimeTypes[upload.MimeType]
+	if !ok {
+		return upload, fmt.Errorf("Unsupported file type %s", upload.MimeType)
+	}
+
+	if strings.HasPrefix(upload.MimeType, "image/") {
+		if err := checkImageSize(upload.Content); err != nil {
+			return upload, err
+		}
+	}
+
+	upload.Extension = extension
+	upload.Filename = path.Base(fileHeader.Filename)
+
+	return upload, nil
+}
+
+func UploadEntryMedia(c *gin.Context, db *sql.DB, storage Storage) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	userID, role, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	visible, err := utils.EntryVisible(c, db, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !visible {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	entryRevisionId, locked, err := latestEntryRevision(db, entryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			messages.StatusNotFound(c, errors.New("Entry revision not found"))
+			return
+		}
+
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	// earlier revisions are history, media only goes on the latest
+	if revisionParam := c.PostForm("revision_id"); revisionParam != "" && revisionParam != strconv.Itoa(entryRevisionId) {
+		messages.StatusBadRequest(c, ErrNotLatestRevision)
+		return
+	}
+
+	if locked && !utils.IsModerator(role) {
+		messages.StatusForbidden(c, ErrEntryLocked)
+		return
+	}
+
+	if pendingMediaID := c.PostForm("media_id"); pendingMediaID != "" {
+		attachPendingMedia(c, db, entryID, entryRevisionId, userID, pendingMediaID)
+		return
+	}
+
+	upload, err := ReadUpload(c)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	media, err := storeMedia(
+		c,
+		db,
+		storage,
+		fmt.Sprintf("entries/%d", entryID),
+		sql.NullInt64{Int64: int64(entryID), Valid: true},
+		entryRevisionId,
+		userID,
+		upload,
+	)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, media)
+}
+
+func attachPendingMedia(c *gin.Context, db *sql.DB, entryID int, entryRevisionId int, userID int, pendingMediaID string) {
+	mediaID, err := strconv.Atoi(pendingMediaID)
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid media id"))
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = AttachPendingMedia(tx, entryID, entryRevisionId, userID, []int{mediaID})
+	if err != nil {
+		if err == ErrMediaNotFound {
+			messages.StatusNotFound(c, err)
+			return
+		}
+
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "media.attach",
+		TargetType: "media",
+		TargetID:   mediaID,
+		After:      gin.H{"entry_id": entryID, "revision_id": entryRevisionId},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Media attached successfully!")
+}
+
+// StorePendingMedia stores an upload that isn't attached to an entry yet. It
+// can be attached later by its uploader with AttachPendingMedia, otherwise it
+// is purged with the orphaned media.
+func StorePendingMedia(c *gin.Context, db *sql.DB, storage Storage, userID int, upload Upload) (data.Media, error) {
+	return storeMedia(c, db, storage, "pending", sql.NullInt64{}, 0, userID, upload)
+}
+
+// AttachPendingMedia appends pending uploads owned by userID to the end of a
+// revision's gallery, in the order given.
+func AttachPendingMedia(tx *sql.Tx, entryID int, entryRevisionId int, userID int, mediaIDs []int) error {
+	for _, mediaID := range mediaIDs {
+		result, err := tx.Exec(`
+			UPDATE media
+			SET entry_id = $1
+			WHERE id = $2 AND entry_id IS NULL AND uploader_id = $3
+		`, entryID, mediaID, userID)
+		if err != nil {
+			return err
+		}
+
+		attached, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if attached == 0 {
+			return ErrMediaNotFound
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO entry_revision_media (entry_revision_id, media_id, position)
+			SELECT $1, $2, COALESCE(MAX(position), 0) + 1
+			FROM entry_revision_media
+			WHERE entry_revision_id = $1
+		`, entryRevisionId, mediaID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storeMedia writes an upload (and its thumbnail, for images) to storage and
+// records it, at the end of a revision's gallery when entryRevisionId is set.
+// Stored files are removed again if the database insert fails.
+func storeMedia(
+	c *gin.Context,
+	db *sql.DB,
+	storage Storage,
+	keyPrefix string,
+	entryID sql.NullInt64,
+	entryRevisionId int,
+	userID int,
+	upload Upload,
+) (data.Media, error) {
+	ctx := c.Request.Context()
+
+	media := data.Media{
+		MimeType:         upload.MimeType,
+		OriginalFilename: upload.Filename,
+	}
+
+	name, err := randomKey()
+	if err != nil {
+		return media, err
+	}
+
+	content := upload.Content
+	storageKey := keyPrefix + "/" + name + upload.Extension
+	var thumbnailKey string
+	var width, height sql.NullInt64
+
+	if strings.HasPrefix(upload.MimeType, "image/") {
+		processed, err := processImage(content, upload.MimeType)
+		if err != nil {
+			return media, err
+		}
+
+		content = processed.Body
+		width = sql.NullInt64{Int64: int64(processed.Width), Valid: true}
+		height = sql.NullInt64{Int64: int64(processed.Height), Valid: true}
+		thumbnailKey = keyPrefix + "/" + name + "-thumb.jpg"
+
+		err = storage.Put(ctx, thumbnailKey, "image/jpeg", bytes.NewReader(processed.Thumbnail), int64(len(processed.Thumbnail)))
+		if err != nil {
+			return media, err
+		}
+	}
+
+	err = storage.Put(ctx, storageKey, upload.MimeType, bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		if thumbnailKey != "" {
+			storage.Delete(ctx, thumbnailKey)
+		}
+		return media, err
+	}
+
+	media.SizeBytes = len(content)
+	media.Width = int(width.Int64)
+	media.Height = int(height.Int64)
+	media.URL = storage.URL(storageKey)
+	if thumbnailKey != "" {
+		media.ThumbnailURL = storage.URL(thumbnailKey)
+	}
+
+	err = insertMedia(c, db, &media, entryID, entryRevisionId, userID, storageKey, thumbnailKey, width, height)
+	if err != nil {
+		storage.Delete(ctx, storageKey)
+		if thumbnailKey != "" {
+			storage.Delete(ctx, thumbnailKey)
+		}
+		return media, err
+	}
+
+	return media, nil
+}
+
+func insertMedia(
+	c *gin.Context,
+	db *sql.DB,
+	media *data.Media,
+	entryID sql.NullInt64,
+	entryRevisionId int,
+	userID int,
+	storageKey string,
+	thumbnailKey string,
+	width sql.NullInt64,
+	height sql.NullInt64,
+) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO media (entry_id, uploader_id, storage_key, thumbnail_key, mime_type, size_bytes, width, height, original_filename)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9)
+		RETURNING id
+	`, entryID, userID, storageKey, thumbnailKey, media.MimeType, media.SizeBytes, width, height, media.OriginalFilename).Scan(&media.ID)
+	if err != nil {
+		return err
+	}
+
+	if entryRevisionId != 0 {
+		err = tx.QueryRow(`
+			INSERT INTO entry_revision_media (entry_revision_id, media_id, position)
+			SELECT $1, $2, COALESCE(MAX(position), 0) + 1
+			FROM entry_revision_media
+			WHERE entry_revision_id = $1
+			RETURNING position
+		`, entryRevisionId, media.ID).Scan(&media.Position)
+		if err != nil {
+			return err
+		}
+	}
+
+	after := gin.H{
+		"mime_type":  media.MimeType,
+		"size_bytes": media.SizeBytes,
+	}
+	if entryID.Valid {
+		after["entry_id"] = entryID.Int64
+		after["revision_id"] = entryRevisionId
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "media.upload",
+		TargetType: "media",
+		TargetID:   media.ID,
+		After:      after,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// latestEntryRevision returns the latest revision of an entry, the only one
+// media can be added to, and whether the entry is locked.
+func latestEntryRevision(db *sql.DB, entryID int) (int, bool, error) {
+	var entryRevisionId int
+	var locked bool
+
+	err := db.QueryRow(`
+		SELECT er.id, e.locked_at IS NOT NULL
+		FROM entry_revision er
+		JOIN entry e ON e.id = er.entry_id
+		WHERE er.entry_id = $1 AND e.archived_at IS NULL
+		ORDER BY er.revision_number DESC
+		LIMIT 1
+	`, entryID).Scan(&entryRevisionId, &locked)
+
+	return entryRevisionId, locked, err
+}
+
+// resolveEntryRevision returns the requested revision of an entry, or its
+// latest revision when revisionParam is empty. Hidden revisions are only
+// resolved for moderators.
+func resolveEntryRevision(db *sql.DB, entryID int, revisionParam string, moderator bool) (int, error) {
+	var entryRevisionId int
+
+	if revisionParam == "" {
+		entryRevisionId, _, err := latestEntryRevision(db, entryID)
+		return entryRevisionId, err
+	}
+
+	requestedId, err := strconv.Atoi(revisionParam)
+	if err != nil {
+		return 0, errors.New("Invalid revision id")
+	}
+
+	err = db.QueryRow(`
+		SELECT er.id
+		FROM entry_revision er
+		JOIN entry e ON e.id = er.entry_id
+		WHERE er.id = $1
+			AND er.entry_id = $2
+			AND e.archived_at IS NULL
+			AND (er.hidden_at IS NULL OR $3)
+	`, requestedId, entryID, moderator).Scan(&entryRevisionId)
+
+	return entryRevisionId, err
+}
+
+// RetrieveMediaForEntryRevision returns the gallery of a revision in order.
+func RetrieveMediaForEntryRevision(db *sql.DB, storage Storage, entryRevisionId int) ([]data.Media, error) {
+	rows, err := db.Query(`
+		SELECT m.id,
+			m.storage_key,
+			COALESCE(m.thumbnail_key, ''),
+			m.mime_type,
+			m.size_bytes,
+			COALESCE(m.width, 0),
+			COALESCE(m.height, 0),
+			COALESCE(m.original_filename, ''),
+			erm.position
+		FROM entry_revision_media erm
+		JOIN media m ON m.id = erm.media_id
+		WHERE erm.entry_revision_id = $1
+		ORDER BY erm.position
+	`, entryRevisionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gallery []data.Media
+
+	for rows.Next() {
+		var media data.Media
+		var storageKey, thumbnailKey string
+
+		err := rows.Scan(
+			&media.ID,
+			&storageKey,
+			&thumbnailKey,
+			&media.MimeType,
+			&media.SizeBytes,
+			&media.Width,
+			&media.Height,
+			&media.OriginalFilename,
+			&media.Position,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		media.URL = storage.URL(storageKey)
+		if thumbnailKey != "" {
+			media.ThumbnailURL = storage.URL(thumbnailKey)
+		}
+
+		gallery = append(gallery, media)
+	}
+
+	return gallery, rows.Err()
+}
+
+func RetrieveEntryMedia(c *gin.Context, db *sql.DB, storage Storage) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	visible, err := utils.EntryVisible(c, db, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !visible {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	_, role, _ := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+
+	entryRevisionId, err := resolveEntryRevision(db, entryID, c.Query("revision_id"), utils.IsModerator(role))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			messages.StatusNotFound(c, errors.New("Entry revision not found"))
+			return
+		}
+
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	gallery, err := RetrieveMediaForEntryRevision(db, storage, entryRevisionId)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if gallery == nil {
+		gallery = []data.Media{}
+	}
+
+	c.JSON(http.StatusOK, gallery)
+}
+
+func ServeMedia(c *gin.Context, storage Storage) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	file, err := storage.Get(c.Request.Context(), key)
+	if err != nil {
+		messages.StatusNotFound(c, errors.New("Media not found"))
+		return
+	}
+	defer file.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.DataFromReader(http.StatusOK, -1, contentType, file, nil)
+}
+
+// PurgeOrphanedMedia deletes the files and rows of media whose entry has been
+// purged, and of pending uploads that were never attached within a day.
+func PurgeOrphanedMedia(db *sql.DB, storage Storage) error {
+	rows, err := db.Query(`
+		SELECT id, storage_key, COALESCE(thumbnail_key, '')
+		FROM media
+		WHERE entry_id IS NULL
+		AND date_created < now() - interval '1 day'
+	`)
+	if err != nil {
+		return err
+	}
+
+	type orphan struct {
+		id           int
+		storageKey   string
+		thumbnailKey string
+	}
+
+	var orphans []orphan
+
+	for rows.Next() {
+		var o orphan
+
+		if err := rows.Scan(&o.id, &o.storageKey, &o.thumbnailKey); err != nil {
+			rows.Close()
+			return err
+		}
+
+		orphans = append(orphans, o)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	for _, o := range orphans {
+		if err := storage.Delete(ctx, o.storageKey); err != nil {
+			log.Printf("Failed to delete media %s: %v", o.storageKey, err)
+			continue
+		}
+
+		if o.thumbnailKey != "" {
+			if err := storage.Delete(ctx, o.thumbnailKey); err != nil {
+				log.Printf("Failed to delete media %s: %v", o.thumbnailKey, err)
+			}
+		}
+
+		if _, err := db.Exec(`DELETE FROM media WHERE id = $1`, o.id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func encodeTestJPEG(t *testing.T, width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("failed to encode test image: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// withEXIF inserts an APP1 EXIF segment holding tiff right after the JPEG SOI
+// marker.
+func withEXIF(content []byte, tiff []byte) []byte {
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(payload) + 2
+
+	segment := append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, payload...)
+
+	out := append([]byte{}, content[:2]...)
+	out = append(out, segment...)
+	return append(out, content[2:]...)
+}
+
+// gpsTIFF builds a little-endian TIFF with a capture time in IFD0 and a GPS
+// IFD placing the photo at 28°32'24"N 81°22'48"W.
+func gpsTIFF() []byte {
+	le := binary.LittleEndian
+	buf := make([]byte, 160)
+
+	copy(buf, "II*\x00")
+	le.PutUint32(buf[4:], 8)
+
+	entry := func(offset int, tag uint16, kind uint16, count uint32, value uint32) {
+		le.PutUint16(buf[offset:], tag)
+		le.PutUint16(buf[offset+2:], kind)
+		le.PutUint32(buf[offset+4:], count)
+		le.PutUint32(buf[offset+8:], value)
+	}
+	rational := func(offset int, values ...uint32) {
+		for i, value := range values {
+			le.PutUint32(buf[offset+i*8:], value)
+			le.PutUint32(buf[offset+i*8+4:], 1)
+		}
+	}
+
+	// IFD0: DateTime and a pointer to the GPS IFD
+	le.PutUint16(buf[8:], 2)
+	entry(10, 0x0132, 2, 20, 140)
+	entry(22, 0x8825, 4, 1, 38)
+
+	// GPS IFD
+	le.PutUint16(buf[38:], 4)
+	entry(40, 0x0001, 2, 2, uint32('N'))
+	entry(52, 0x0002, 5, 3, 92)
+	entry(64, 0x0003, 2, 2, uint32('W'))
+	entry(76, 0x0004, 5, 3, 116)
+
+	rational(92, 28, 32, 24)
+	rational(116, 81, 22, 48)
+	copy(buf[140:], "2025:03:14 09:30:00\x00")
+
+	return buf
+}
+
+func TestReadGeotag(t *testing.T) {
+	geotag, ok := ReadGeotag(withEXIF(encodeTestJPEG(t, 8, 8), gpsTIFF()))
+
+	if !ok {
+		t.Fatalf("expected a geotag")
+	}
+	if math.Abs(geotag.Latitude-28.54) > 1e-6 || math.Abs(geotag.Longitude+81.38) > 1e-6 {
+		t.Fatalf("expected 28.54,-81.38, got %v,%v", geotag.Latitude, geotag.Longitude)
+	}
+	if geotag.CapturedAt.Year() != 2025 || geotag.CapturedAt.Month() != 3 || geotag.CapturedAt.Day() != 14 {
+		t.Fatalf("expected capture date 2025-03-14, got %v", geotag.CapturedAt)
+	}
+
+	if _, ok := ReadGeotag(encodeTestJPEG(t, 8, 8)); ok {
+		t.Fatalf("expected no geotag on a photo without EXIF")
+	}
+}
+
+func TestSniffMimeTypeIgnoresDeclaredType(t *testing.T) {
+	if mimeType := sniffMimeType(encodeTestJPEG(t, 4, 4)); mimeType != "image/jpeg" {
+		t.Fatalf("expected image/jpeg, got %s", mimeType)
+	}
+
+	if mimeType := sniffMimeType([]byte("<html><script>alert(1)</script></html>")); mimeType != "text/html" {
+		t.Fatalf("expected text/html, got %s", mimeType)
+	}
+
+	if _, ok := allowedMimeTypes[sniffMimeType([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"))]; ok {
+		t.Fatalf("expected svg uploads to be rejected")
+	}
+}
+
+func TestProcessImageStripsEXIF(t *testing.T) {
+	content := withEXIF(encodeTestJPEG(t, 8, 8), gpsTIFF())
+
+	if !bytes.Contains(content, []byte("Exif")) {
+		t.Fatalf("test image should carry EXIF before processing")
+	}
+
+	processed, err := processImage(content, "image/jpeg")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if bytes.Contains(processed.Body, []byte("Exif")) {
+		t.Fatalf("expected EXIF to be stripped from the processed image")
+	}
+	if _, ok := ReadGeotag(processed.Body); ok {
+		t.Fatalf("expected GPS position to be stripped from the processed image")
+	}
+	if len(processed.Thumbnail) == 0 {
+		t.Fatalf("expected a thumbnail")
+	}
+}
+
+func TestApplyOrientationRotates(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+
+	rotated := applyOrientation(img, 6)
+
+	if rotated.Bounds().Dx() != 2 || rotated.Bounds().Dy() != 3 {
+		t.Fatalf("expected 2x3 image, got %v", rotated.Bounds())
+	}
+
+	if r, _, _, _ := rotated.At(1, 0).RGBA(); r == 0 {
+		t.Fatalf("expected top-left pixel to move to the top-right corner")
+	}
+}
+
+func TestResizeToFitKeepsAspectRatio(t *testing.T) {
+	resized := resizeToFit(image.NewRGBA(image.Rect(0, 0, 1280, 640)), thumbnailMaxDimension)
+
+	if resized.Bounds().Dx() != thumbnailMaxDimension || resized.Bounds().Dy() != thumbnailMaxDimension/2 {
+		t.Fatalf("expected %dx%d, got %v", thumbnailMaxDimension, thumbnailMaxDimension/2, resized.Bounds())
+	}
+}
+
+func TestProcessImageRejectsHugeDimensions(t *testing.T) {
+	var small bytes.Buffer
+	if err := png.Encode(&small, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+
+	// rewrite the IHDR chunk to claim 100000x100000 pixels
+	content := small.Bytes()
+	binary.BigEndian.PutUint32(content[16:], 100000)
+	binary.BigEndian.PutUint32(content[20:], 100000)
+	binary.BigEndian.PutUint32(content[29:], crc32.ChecksumIEEE(content[12:29]))
+
+	if _, err := processImage(content, "image/png"); err != ErrImageTooLarge {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Storage is where uploaded files live. Keys are slash separated paths such as
+// "entries/12/3f9c.jpg".
+type Storage interface {
+	Put(ctx context.Context, key string, contentType string, body io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// NewStorageFromEnv returns local filesystem storage unless MEDIA_STORAGE is
+// set to "s3", in which case an S3-compatible bucket is used.
+func NewStorageFromEnv() (Storage, error) {
+	if os.Getenv("MEDIA_STORAGE") == "s3" {
+		return NewS3Storage(
+			os.Getenv("S3_ENDPOINT"),
+			os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+			os.Getenv("S3_USE_SSL") != "false",
+			os.Getenv("S3_PUBLIC_URL"),
+		)
+	}
+
+	root := os.Getenv("MEDIA_ROOT")
+	if root == "" {
+		root = "/app/media"
+	}
+
+	return NewLocalStorage(root, "/media")
+}
+
+type LocalStorage struct {
+	Root    string
+	BaseURL string
+}
+
+func NewLocalStorage(root string, baseURL string) (*LocalStorage, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStorage{Root: root, BaseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" {
+		return "", errors.New("invalid media key")
+	}
+
+	return filepath.Join(s.Root, cleaned), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, contentType string, body io.Reader, size int64) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+
+	return file.Close()
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(path)
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.BaseURL + "/" + key
+}
+
+type S3Storage struct {
+	client    *minio.Client
+	bucket    string
+	publicURL string
+}
+
+func NewS3Storage(
+	endpoint string,
+	bucket string,
+	accessKey string,
+	secretKey string,
+	useSSL bool,
+	publicURL string,
+) (*S3Storage, error) {
+	if endpoint == "" || bucket == "" {
+		return nil, errors.New("S3_ENDPOINT and S3_BUCKET are required for s3 media storage")
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if publicURL == "" {
+		scheme := "https://"
+		if !useSSL {
+			scheme = "http://"
+		}
+		publicURL = scheme + endpoint + "/" + bucket
+	}
+
+	return &S3Storage{
+		client:    client,
+		bucket:    bucket,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+	}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, contentType string, body io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, body, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+
+	return err
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Storage) URL(key string) string {
+	return s.publicURL + "/" + key
+}
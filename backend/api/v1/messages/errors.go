@@ -35,3 +35,15 @@ func StatusBadRequest(c *gin.Context, err error) {
 		"error": err.Error(),
 	})
 }
+
+func StatusForbidden(c *gin.Context, err error) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error": err.Error(),
+	})
+}
+
+func StatusNotFound(c *gin.Context, err error) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,242 @@
+package moderation
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	audit "backend/api/v1/audit"
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+const (
+	TargetEntry    = "entry"
+	TargetRevision = "revision"
+	TargetComment  = "comment"
+)
+
+const defaultHideThreshold = 3
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// HideThreshold is how many different users have to flag a piece of content
+// before it is hidden pending review, FLAG_HIDE_THRESHOLD or 3 by default.
+func HideThreshold() int {
+	threshold, err := strconv.Atoi(os.Getenv("FLAG_HIDE_THRESHOLD"))
+	if err != nil || threshold < 1 {
+		return defaultHideThreshold
+	}
+
+	return threshold
+}
+
+// retrieveTarget returns the entry a flag target belongs to and the user who
+// wrote it.
+func retrieveTarget(db queryRower, targetType string, targetID int) (int, int, error) {
+	var entryID, authorID int
+	var err error
+
+	switch targetType {
+	case TargetEntry:
+		err = db.QueryRow(`
+			SELECT id, creator_id FROM entry WHERE id = $1 AND archived_at IS NULL
+		`, targetID).Scan(&entryID, &authorID)
+	case TargetRevision:
+		err = db.QueryRow(`
+			SELECT er.entry_id, er.creator_id
+			FROM entry_revision er
+			JOIN entry e ON e.id = er.entry_id
+			WHERE er.id = $1 AND e.archived_at IS NULL
+		`, targetID).Scan(&entryID, &authorID)
+	case TargetComment:
+		err = db.QueryRow(`
+			SELECT entry_id, user_id FROM conversation WHERE id = $1
+		`, targetID).Scan(&entryID, &authorID)
+	default:
+		err = fmt.Errorf("unknown flag target %q", targetType)
+	}
+
+	return entryID, authorID, err
+}
+
+// hide hides flagged content. A flagged revision hides its whole entry, the
+// revision itself can be reverted instead. moderatorID 0 marks the content as
+// hidden automatically.
+func hide(tx execer, targetType string, targetID int, entryID int, moderatorID int, reason string) error {
+	var hiddenBy any
+	if moderatorID != 0 {
+		hiddenBy = moderatorID
+	}
+
+	if targetType == TargetComment {
+		_, err := tx.Exec(`
+			UPDATE conversation
+			SET hidden_at = now(), hidden_by = $2, hidden_reason = $3
+			WHERE id = $1 AND hidden_at IS NULL
+		`, targetID, hiddenBy, reason)
+		return err
+	}
+
+	_, err := tx.Exec(`
+		UPDATE entry
+		SET hidden_at = now(), hidden_by = $2, hidden_reason = $3
+		WHERE id = $1 AND hidden_at IS NULL
+	`, entryID, hiddenBy, reason)
+	return err
+}
+
+// unhideAutomatic shows content again if it was hidden by the flag threshold
+// rather than by a moderator.
+func unhideAutomatic(tx execer, targetType string, targetID int, entryID int) error {
+	if targetType == TargetComment {
+		_, err := tx.Exec(`
+			UPDATE conversation
+			SET hidden_at = NULL, hidden_reason = NULL
+			WHERE id = $1 AND hidden_at IS NOT NULL AND hidden_by IS NULL
+		`, targetID)
+		return err
+	}
+
+	_, err := tx.Exec(`
+		UPDATE entry
+		SET hidden_at = NULL, hidden_reason = NULL
+		WHERE id = $1 AND hidden_at IS NOT NULL AND hidden_by IS NULL
+	`, entryID)
+	return err
+}
+
+// unhide shows an entry or comment again however it was hidden, reporting
+// whether it was hidden at all.
+func unhide(tx execer, targetType string, targetID int) (bool, error) {
+	query := `
+		UPDATE entry
+		SET hidden_at = NULL, hidden_by = NULL, hidden_reason = NULL
+		WHERE id = $1 AND hidden_at IS NOT NULL
+	`
+	if targetType == TargetComment {
+		query = `
+			UPDATE conversation
+			SET hidden_at = NULL, hidden_by = NULL, hidden_reason = NULL
+			WHERE id = $1 AND hidden_at IS NOT NULL
+		`
+	}
+
+	result, err := tx.Exec(query, targetID)
+	if err != nil {
+		return false, err
+	}
+
+	unhidden, err := result.RowsAffected()
+	return unhidden > 0, err
+}
+
+// FlagContent reports an entry, a revision or a comment. Once enough
+// different users have flagged the same content it is hidden until a
+// moderator resolves the flags.
+func FlagContent(c *gin.Context, db *sql.DB) {
+	var req data.FlagRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	entryID, _, err := retrieveTarget(db, req.TargetType, req.TargetID)
+	if err == sql.ErrNoRows {
+		messages.StatusNotFound(c, errors.New("Flagged content not found"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var flagID int
+
+	err = tx.QueryRow(`
+		INSERT INTO flags (target_type, target_id, entry_id, reporter_id, reason, details)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		RETURNING id
+	`, req.TargetType, req.TargetID, entryID, userID, req.Reason, req.Details).Scan(&flagID)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		messages.StatusConflict(c, errors.New("You have already flagged this"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	var reporters int
+
+	err = tx.QueryRow(`
+		SELECT COUNT(DISTINCT reporter_id)
+		FROM flags
+		WHERE target_type = $1 AND target_id = $2 AND status = 'open'
+	`, req.TargetType, req.TargetID).Scan(&reporters)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	threshold := HideThreshold()
+	hidden := reporters >= threshold
+
+	if hidden {
+		reason := fmt.Sprintf("Automatically hidden after %d flags", threshold)
+		if err := hide(tx, req.TargetType, req.TargetID, entryID, 0, reason); err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "flag.create",
+		TargetType: req.TargetType,
+		TargetID:   req.TargetID,
+		Details: gin.H{
+			"flag_id":     flagID,
+			"reason":      req.Reason,
+			"reporters":   reporters,
+			"auto_hidden": hidden,
+		},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusCreated(c, "Thanks, a moderator will review it")
+}
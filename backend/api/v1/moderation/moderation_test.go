@@ -0,0 +1,61 @@
+package moderation
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+
+	data "backend/api/v1/data"
+)
+
+func TestHideThreshold(t *testing.T) {
+	tests := map[string]int{
+		"":    defaultHideThreshold,
+		"5":   5,
+		"0":   defaultHideThreshold,
+		"abc": defaultHideThreshold,
+	}
+
+	for value, want := range tests {
+		t.Setenv("FLAG_HIDE_THRESHOLD", value)
+
+		if got := HideThreshold(); got != want {
+			t.Errorf("FLAG_HIDE_THRESHOLD=%q gave %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestResolutionAllowed(t *testing.T) {
+	if !resolutionAllowed(TargetRevision, ResolutionRevert) {
+		t.Error("revisions should be revertable")
+	}
+
+	if resolutionAllowed(TargetComment, ResolutionRevert) || resolutionAllowed(TargetEntry, ResolutionRevert) {
+		t.Error("only revisions should be revertable")
+	}
+
+	for _, target := range []string{TargetEntry, TargetRevision, TargetComment} {
+		if !resolutionAllowed(target, ResolutionHide) || !resolutionAllowed(target, ResolutionSuspend) {
+			t.Errorf("%s should allow hide and suspend", target)
+		}
+	}
+}
+
+func TestResolveFlagsRequestRequiresSuspendDays(t *testing.T) {
+	tests := map[string]bool{
+		`{"resolution": "suspend", "reason": "spam"}`:                     false,
+		`{"resolution": "suspend", "reason": "spam", "suspend_days": 0}`:  true,
+		`{"resolution": "suspend", "reason": "spam", "suspend_days": 7}`:  true,
+		`{"resolution": "suspend", "reason": "spam", "suspend_days": -1}`: false,
+		`{"resolution": "dismiss", "reason": "fine"}`:                     true,
+	}
+
+	for body, valid := range tests {
+		var req data.ResolveFlagsRequest
+
+		err := binding.JSON.BindBody([]byte(body), &req)
+		if (err == nil) != valid {
+			t.Errorf("%s: got %v", body, err)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package moderation
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	audit "backend/api/v1/audit"
+	data "backend/api/v1/data"
+	entry "backend/api/v1/entry"
+	messages "backend/api/v1/messages"
+	users "backend/api/v1/users"
+	utils "backend/api/v1/utils"
+)
+
+const (
+	ResolutionDismiss = "dismiss"
+	ResolutionHide    = "hide"
+	ResolutionRevert  = "revert"
+	ResolutionSuspend = "suspend"
+)
+
+// resolutionAllowed reports whether a resolution applies to a target type.
+// Only revisions can be reverted.
+func resolutionAllowed(targetType string, resolution string) bool {
+	if resolution == ResolutionRevert {
+		return targetType == TargetRevision
+	}
+
+	return true
+}
+
+func queueTarget(c *gin.Context) (string, int, error) {
+	targetType := c.Param("targetType")
+	if targetType != TargetEntry && targetType != TargetRevision && targetType != TargetComment {
+		return "", 0, errors.New("Invalid target type")
+	}
+
+	targetID, err := strconv.Atoi(c.Param("targetId"))
+	if err != nil {
+		return "", 0, errors.New("Invalid target id")
+	}
+
+	return targetType, targetID, nil
+}
+
+// RetrieveQueue lists flagged content with open flags, most flagged first.
+func RetrieveQueue(c *gin.Context, db *sql.DB) {
+	var query data.ModerationQueueQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if query.Limit == 0 {
+		query.Limit = 50
+	}
+
+	moderatorID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT f.target_type,
+			f.target_id,
+			MIN(f.entry_id),
+			COUNT(*),
+			array_agg(DISTINCT f.reason),
+			array_remove(array_agg(f.details ORDER BY f.date_created), NULL),
+			MIN(f.date_created),
+			MAX(f.date_created),
+			MAX(u.username),
+			MAX(f.claimed_at),
+			bool_or(CASE f.target_type
+				WHEN 'comment' THEN conv.hidden_at IS NOT NULL
+				ELSE e.hidden_at IS NOT NULL
+			END)
+		FROM flags f
+		JOIN entry e ON e.id = f.entry_id
+		LEFT JOIN conversation conv ON f.target_type = 'comment' AND conv.id = f.target_id
+		LEFT JOIN users u ON u.id = f.claimed_by
+		WHERE f.status = 'open'
+		AND ($1 = '' OR f.target_type = $1)
+		GROUP BY f.target_type, f.target_id
+		HAVING ($2 = '' OR bool_or(f.reason = $2))
+		AND ($3 = '' OR ($3 = 'mine' AND bool_or(f.claimed_by = $4)) OR ($3 = 'unclaimed' AND bool_and(f.claimed_by IS NULL)))
+		ORDER BY COUNT(*) DESC, MIN(f.date_created)
+		LIMIT $5 OFFSET $6
+	`, query.TargetType, query.Reason, query.Claimed, moderatorID, query.Limit, query.Offset)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	queue := []data.ModerationQueueItem{}
+
+	for rows.Next() {
+		var item data.ModerationQueueItem
+
+		err := rows.Scan(
+			&item.TargetType,
+			&item.TargetID,
+			&item.EntryID,
+			&item.FlagCount,
+			pq.Array(&item.Reasons),
+			pq.Array(&item.Details),
+			&item.FirstFlaggedAt,
+			&item.LastFlaggedAt,
+			&item.ClaimedBy,
+			&item.ClaimedAt,
+			&item.Hidden,
+		)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		queue = append(queue, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, queue)
+}
+
+// lockOpenFlags locks the open flags on a target and returns who claimed
+// them, or 0 when nobody has.
+func lockOpenFlags(tx *sql.Tx, targetType string, targetID int) (int, int, error) {
+	rows, err := tx.Query(`
+		SELECT COALESCE(claimed_by, 0)
+		FROM flags
+		WHERE target_type = $1 AND target_id = $2 AND status = 'open'
+		FOR UPDATE
+	`, targetType, targetID)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	var count, claimedBy int
+
+	for rows.Next() {
+		var flagClaimedBy int
+
+		if err := rows.Scan(&flagClaimedBy); err != nil {
+			return 0, 0, err
+		}
+
+		count++
+		if flagClaimedBy != 0 {
+			claimedBy = flagClaimedBy
+		}
+	}
+
+	return count, claimedBy, rows.Err()
+}
+
+// ClaimTarget assigns the open flags on a target to the calling moderator so
+// two moderators don't work the same report.
+func ClaimTarget(c *gin.Context, db *sql.DB) {
+	targetType, targetID, err := queueTarget(c)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	moderatorID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	count, claimedBy, err := lockOpenFlags(tx, targetType, targetID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if count == 0 {
+		messages.StatusNotFound(c, errors.New("No open flags for this content"))
+		return
+	}
+
+	if claimedBy != 0 && claimedBy != moderatorID {
+		messages.StatusConflict(c, errors.New("Another moderator has claimed this"))
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE flags
+		SET claimed_by = $3, claimed_at = now()
+		WHERE target_type = $1 AND target_id = $2 AND status = 'open'
+	`, targetType, targetID, moderatorID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    moderatorID,
+		Action:     "flags.claim",
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    gin.H{"flags": count},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Claimed")
+}
+
+// ResolveTarget closes every open flag on a target. Dismissing shows content
+// that the threshold hid again; hiding, reverting and suspending the author
+// act on the content as well.
+func ResolveTarget(c *gin.Context, db *sql.DB) {
+	targetType, targetID, err := queueTarget(c)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	var req data.ResolveFlagsRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if !resolutionAllowed(targetType, req.Resolution) {
+		messages.StatusBadRequest(c, errors.New("Only revisions can be reverted"))
+		return
+	}
+
+	moderatorID, moderatorRole, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	count, claimedBy, err := lockOpenFlags(tx, targetType, targetID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if count == 0 {
+		messages.StatusNotFound(c, errors.New("No open flags for this content"))
+		return
+	}
+
+	if claimedBy != 0 && claimedBy != moderatorID {
+		messages.StatusConflict(c, errors.New("Another moderator has claimed this"))
+		return
+	}
+
+	entryID, authorID, err := retrieveTarget(tx, targetType, targetID)
+	if err == sql.ErrNoRows {
+		messages.StatusNotFound(c, errors.New("Flagged content not found"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if req.Resolution == ResolutionSuspend {
+		switch err := users.CheckSuspendable(tx, authorID, moderatorID, moderatorRole); err {
+		case nil:
+		case users.ErrSuspendSelf:
+			messages.StatusBadRequest(c, err)
+			return
+		case users.ErrSuspendModerator:
+			messages.StatusForbidden(c, err)
+			return
+		case sql.ErrNoRows:
+			messages.StatusNotFound(c, errors.New("Author not found"))
+			return
+		default:
+			messages.InternalServerError(c, err)
+			return
+		}
+	}
+
+	details := gin.H{
+		"target_type": targetType,
+		"target_id":   targetID,
+		"resolution":  req.Resolution,
+		"reason":      req.Reason,
+		"flags":       count,
+	}
+
+	switch req.Resolution {
+	case ResolutionDismiss:
+		err = unhideAutomatic(tx, targetType, targetID, entryID)
+
+	case ResolutionHide:
+		err = hide(tx, targetType, targetID, entryID, moderatorID, req.Reason)
+
+	case ResolutionRevert:
+		var revisionID int
+
+		revisionID, err = entry.RevertRevision(tx, targetID, moderatorID)
+		if errors.Is(err, entry.ErrFirstRevision) ||
+			errors.Is(err, entry.ErrRevisionNotLatest) ||
+			errors.Is(err, entry.ErrNothingToRestore) {
+			messages.StatusConflict(c, err)
+			return
+		}
+		details["revision_id"] = revisionID
+
+	case ResolutionSuspend:
+		err = users.Suspend(tx, authorID, moderatorID, req.Reason, *req.SuspendDays)
+		details["user_id"] = authorID
+		details["suspend_days"] = *req.SuspendDays
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	// the flags are dealt with, so the threshold no longer applies. Only
+	// hide keeps content hidden.
+	if req.Resolution == ResolutionRevert || req.Resolution == ResolutionSuspend {
+		if err := unhideAutomatic(tx, targetType, targetID, entryID); err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE flags
+		SET status = 'resolved',
+			resolution = $3,
+			resolution_reason = $4,
+			resolved_by = $5,
+			resolved_at = now()
+		WHERE target_type = $1 AND target_id = $2 AND status = 'open'
+	`, targetType, targetID, req.Resolution, req.Reason, moderatorID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    moderatorID,
+		Action:     "flags." + req.Resolution,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Flags resolved")
+}
+
+// UnhideTarget shows a hidden entry or comment again, whether it was hidden
+// by a moderator or by the flag threshold.
+func UnhideTarget(c *gin.Context, db *sql.DB) {
+	targetType, targetID, err := queueTarget(c)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if targetType == TargetRevision {
+		messages.StatusBadRequest(c, errors.New("A flagged revision hides its entry, unhide the entry instead"))
+		return
+	}
+
+	moderatorID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	unhidden, err := unhide(tx, targetType, targetID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !unhidden {
+		messages.StatusNotFound(c, errors.New("No hidden content with that id"))
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    moderatorID,
+		Action:     targetType + ".unhide",
+		TargetType: targetType,
+		TargetID:   targetID,
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Content shown again")
+}
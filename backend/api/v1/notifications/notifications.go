@@ -0,0 +1,152 @@
+package notifications
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+const (
+	TypeRevision = "revision"
+	TypeComment  = "comment"
+	TypeProgress = "progress"
+)
+
+// Notify creates a notification for everyone watching an entry except the
+// user who caused it.
+func Notify(tx execer, entryID int, actorID int, notificationType string, details any) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO notifications (user_id, entry_id, actor_id, type, details)
+		SELECT user_id, entry_id, $2, $3, $4
+		FROM entry_watchers
+		WHERE entry_id = $1 AND user_id <> $2
+	`, entryID, actorID, notificationType, detailsJSON)
+
+	return err
+}
+
+func RetrieveNotifications(c *gin.Context, db *sql.DB) {
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	var query data.NotificationsQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if query.Limit == 0 {
+		query.Limit = 50
+	}
+
+	rows, err := db.Query(`
+		SELECT n.id,
+			n.entry_id,
+			COALESCE(er.title, ''),
+			COALESCE(u.username, ''),
+			n.type,
+			COALESCE(n.details, 'null'),
+			n.read_at IS NOT NULL,
+			n.date_created
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.actor_id
+		LEFT JOIN (
+			SELECT DISTINCT ON (entry_id) entry_id, title
+			FROM entry_revision
+			ORDER BY entry_id, revision_number DESC
+		) er ON er.entry_id = n.entry_id
+		WHERE n.user_id = $1
+		AND ($2 = false OR n.read_at IS NULL)
+		ORDER BY n.date_created DESC, n.id DESC
+		LIMIT $3
+	`, userID, query.Unread, query.Limit)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	notifications := []data.Notification{}
+
+	for rows.Next() {
+		var notification data.Notification
+		var details []byte
+
+		err := rows.Scan(
+			&notification.ID,
+			&notification.EntryID,
+			&notification.EntryTitle,
+			&notification.ActorUsername,
+			&notification.Type,
+			&details,
+			&notification.Read,
+			&notification.DateCreated,
+		)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		notification.Details = json.RawMessage(details)
+		notifications = append(notifications, notification)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
+
+// MarkNotificationsRead marks the listed notifications as read, or all of
+// them when no ids are given.
+func MarkNotificationsRead(c *gin.Context, db *sql.DB) {
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	var req data.MarkNotificationsReadRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	var ids any
+	if len(req.IDs) > 0 {
+		ids = pq.Array(req.IDs)
+	}
+
+	_, err = db.Exec(`
+		UPDATE notifications
+		SET read_at = now()
+		WHERE user_id = $1
+		AND read_at IS NULL
+		AND ($2::int[] IS NULL OR id = ANY($2))
+	`, userID, ids)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Notifications marked as read")
+}
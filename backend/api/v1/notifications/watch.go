@@ -0,0 +1,196 @@
+package notifications
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	audit "backend/api/v1/audit"
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// Watch subscribes a user to an entry. Watching twice is a no-op.
+func Watch(tx execer, entryID int, userID int) error {
+	_, err := tx.Exec(`
+		INSERT INTO entry_watchers (entry_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, entryID, userID)
+
+	return err
+}
+
+func WatchEntry(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	var exists bool
+
+	err = db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM entry WHERE id = $1 AND archived_at IS NULL)
+	`, entryID).Scan(&exists)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !exists {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := Watch(tx, entryID, userID); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "entry.watch",
+		TargetType: "entry",
+		TargetID:   entryID,
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Watching entry")
+}
+
+func UnwatchEntry(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM entry_watchers WHERE entry_id = $1 AND user_id = $2
+	`, entryID, userID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "entry.unwatch",
+		TargetType: "entry",
+		TargetID:   entryID,
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Stopped watching entry")
+}
+
+func RetrieveWatchlist(c *gin.Context, db *sql.DB) {
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT e.id,
+			COALESCE(er.title, ''),
+			e.address,
+			w.date_created,
+			(
+				SELECT COUNT(*) FROM notifications n
+				WHERE n.user_id = w.user_id AND n.entry_id = e.id AND n.read_at IS NULL
+			)
+		FROM entry_watchers w
+		JOIN entry e ON e.id = w.entry_id
+		JOIN (
+			SELECT DISTINCT ON (entry_id) entry_id, title
+			FROM entry_revision
+			ORDER BY entry_id, revision_number DESC
+		) er ON er.entry_id = e.id
+		WHERE w.user_id = $1 AND e.archived_at IS NULL
+		ORDER BY w.date_created DESC
+	`, userID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	watchlist := []data.WatchedEntry{}
+
+	for rows.Next() {
+		var watched data.WatchedEntry
+
+		err := rows.Scan(
+			&watched.EntryID,
+			&watched.Title,
+			&watched.Address,
+			&watched.WatchingSince,
+			&watched.UnreadNotifications,
+		)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		watchlist = append(watchlist, watched)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, watchlist)
+}
@@ -0,0 +1,96 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// Cursor marks where a page ended: the sort key and id of its last row, and
+// for listings ranked against the clock, the time the first page was read.
+// Clients only ever see it encoded and hand it back unchanged.
+type Cursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k,omitempty"`
+	ID   int    `json:"id"`
+	At   string `json:"at,omitempty"`
+}
+
+func (cursor Cursor) Encode() string {
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// Decode reads a cursor from a previous page. An empty string is the first
+// page and decodes to nil. A cursor from a different sort order is rejected,
+// its key means nothing under this one.
+func Decode(encoded string, sort string) (*Cursor, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if cursor.Sort != sort || cursor.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// Limit caps a requested page size, falling back to DefaultLimit when none
+// was asked for.
+func Limit(requested int) int {
+	if requested <= 0 {
+		return DefaultLimit
+	}
+
+	return min(requested, MaxLimit)
+}
+
+// IDArg returns the cursor's id for a query argument, or nil on the first
+// page.
+func (cursor *Cursor) IDArg() any {
+	if cursor == nil {
+		return nil
+	}
+
+	return cursor.ID
+}
+
+// LimitArg returns limit+1 for a query's LIMIT, one extra row so Trim can tell
+// whether another page follows. A limit of zero is no limit at all, and
+// becomes NULL.
+func LimitArg(limit int) any {
+	if limit <= 0 {
+		return nil
+	}
+
+	return limit + 1
+}
+
+// Trim cuts rows fetched with limit+1 back to limit and reports whether
+// there is another page after them. Rows fetched without a limit are all
+// there is.
+func Trim[T any](rows []T, limit int) ([]T, bool) {
+	if limit <= 0 || len(rows) <= limit {
+		return rows, false
+	}
+
+	return rows[:limit], true
+}
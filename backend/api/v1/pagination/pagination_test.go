@@ -0,0 +1,86 @@
+package pagination
+
+import "testing"
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := Cursor{Sort: "new", Key: "2026-01-02T03:04:05.123456Z", ID: 42}
+
+	decoded, err := Decode(cursor.Encode(), "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *decoded != cursor {
+		t.Errorf("got %+v, want %+v", *decoded, cursor)
+	}
+}
+
+func TestDecodeRejectsBadCursors(t *testing.T) {
+	tests := map[string]string{
+		"not base64":  "!!!",
+		"not json":    "bm90IGpzb24",
+		"other sort":  Cursor{Sort: "top", Key: "3", ID: 1}.Encode(),
+		"missing id":  Cursor{Sort: "new", Key: "2026-01-02"}.Encode(),
+		"negative id": Cursor{Sort: "new", ID: -4}.Encode(),
+	}
+
+	for name, encoded := range tests {
+		if _, err := Decode(encoded, "new"); err != ErrInvalidCursor {
+			t.Errorf("%s: got %v, want ErrInvalidCursor", name, err)
+		}
+	}
+}
+
+func TestDecodeFirstPage(t *testing.T) {
+	cursor, err := Decode("", "new")
+	if err != nil || cursor != nil {
+		t.Errorf("got %v, %v, want nil, nil", cursor, err)
+	}
+
+	if cursor.IDArg() != nil {
+		t.Error("the first page should have no query arguments")
+	}
+}
+
+func TestLimit(t *testing.T) {
+	tests := map[int]int{
+		0:            DefaultLimit,
+		-5:           DefaultLimit,
+		10:           10,
+		MaxLimit:     MaxLimit,
+		MaxLimit + 1: MaxLimit,
+		100000:       MaxLimit,
+	}
+
+	for requested, want := range tests {
+		if got := Limit(requested); got != want {
+			t.Errorf("Limit(%d) = %d, want %d", requested, got, want)
+		}
+	}
+}
+
+func TestTrim(t *testing.T) {
+	rows, more := Trim([]int{1, 2, 3}, 2)
+	if len(rows) != 2 || !more {
+		t.Errorf("got %v, %v, want two rows and more", rows, more)
+	}
+
+	rows, more = Trim([]int{1, 2}, 2)
+	if len(rows) != 2 || more {
+		t.Errorf("got %v, %v, want two rows and no more", rows, more)
+	}
+
+	rows, more = Trim([]int{1, 2, 3}, 0)
+	if len(rows) != 3 || more {
+		t.Errorf("got %v, %v, want every row when unlimited", rows, more)
+	}
+}
+
+func TestLimitArg(t *testing.T) {
+	if got := LimitArg(10); got != 11 {
+		t.Errorf("LimitArg(10) = %v, want 11", got)
+	}
+	if got := LimitArg(0); got != nil {
+		t.Errorf("LimitArg(0) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,221 @@
+package relations
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+const (
+	defaultGraphDepth = 5
+	maxGraphNodes     = 500
+)
+
+// expand returns the entries one step beyond the frontier that have not been
+// visited yet, in the order their edges were listed.
+func expand(frontier map[int]bool, edges []data.RelationGraphEdge, visited map[int]int) []int {
+	var next []int
+
+	for _, edge := range edges {
+		for _, pair := range [][2]int{
+			{edge.FromEntryID, edge.ToEntryID},
+			{edge.ToEntryID, edge.FromEntryID},
+		} {
+			if !frontier[pair[0]] {
+				continue
+			}
+			if _, seen := visited[pair[1]]; seen {
+				continue
+			}
+			if !slices.Contains(next, pair[1]) {
+				next = append(next, pair[1])
+			}
+		}
+	}
+
+	return next
+}
+
+// RetrieveRelationGraph walks approved relations outward from an entry, one
+// level per query, and returns every linked entry with its distance from the
+// start. The walk stops at depth (5 by default, 10 at most) or after
+// maxGraphNodes entries, in which case the graph is marked as truncated.
+func RetrieveRelationGraph(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	var query data.RelationGraphQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if query.Depth == 0 {
+		query.Depth = defaultGraphDepth
+	}
+
+	var types any
+	if len(query.Types) > 0 {
+		types = pq.Array(query.Types)
+	}
+
+	visible, err := utils.EntryVisible(c, db, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !visible {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	graph := data.RelationGraph{
+		EntryID: entryID,
+		Nodes:   []data.RelationGraphNode{},
+		Edges:   []data.RelationGraphEdge{},
+	}
+
+	visited := map[int]int{entryID: 0}
+	frontier := []int{entryID}
+	seenEdges := map[int]bool{}
+
+	for depth := 1; len(frontier) > 0; depth++ {
+		edges, err := retrieveEdges(db, frontier, types)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		for _, edge := range edges {
+			if !seenEdges[edge.ID] {
+				seenEdges[edge.ID] = true
+				graph.Edges = append(graph.Edges, edge)
+			}
+		}
+
+		if depth > query.Depth {
+			break
+		}
+
+		inFrontier := make(map[int]bool, len(frontier))
+		for _, id := range frontier {
+			inFrontier[id] = true
+		}
+
+		frontier = expand(inFrontier, edges, visited)
+
+		if len(visited)+len(frontier) > maxGraphNodes {
+			frontier = frontier[:maxGraphNodes-len(visited)]
+			graph.Truncated = true
+		}
+
+		for _, id := range frontier {
+			visited[id] = depth
+		}
+
+		if graph.Truncated {
+			break
+		}
+	}
+
+	// Edges found at the last level can lead past the walk, keep only those
+	// between returned entries.
+	edges := graph.Edges[:0]
+	for _, edge := range graph.Edges {
+		_, fromVisited := visited[edge.FromEntryID]
+		_, toVisited := visited[edge.ToEntryID]
+		if fromVisited && toVisited {
+			edges = append(edges, edge)
+		}
+	}
+	graph.Edges = edges
+
+	ids := make([]int, 0, len(visited))
+	for id := range visited {
+		ids = append(ids, id)
+	}
+
+	rows, err := db.Query(`
+		SELECT e.id, COALESCE(er.title, ''), e.address
+		FROM entry e
+		LEFT JOIN LATERAL (
+			SELECT title FROM entry_revision
+			WHERE entry_id = e.id
+			ORDER BY revision_number DESC
+			LIMIT 1
+		) er ON true
+		WHERE e.id = ANY($1)
+		ORDER BY e.id
+	`, pq.Array(ids))
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var node data.RelationGraphNode
+
+		if err := rows.Scan(&node.EntryID, &node.Title, &node.Address); err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		node.Depth = visited[node.EntryID]
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, graph)
+}
+
+// retrieveEdges returns the approved relations touching any of the entries,
+// skipping relations to archived or hidden entries.
+func retrieveEdges(db queryer, entryIDs []int, types any) ([]data.RelationGraphEdge, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.from_entry_id, r.to_entry_id, r.type
+		FROM entry_relations r
+		JOIN entry f ON f.id = r.from_entry_id AND f.archived_at IS NULL AND f.hidden_at IS NULL
+		JOIN entry t ON t.id = r.to_entry_id AND t.archived_at IS NULL AND t.hidden_at IS NULL
+		WHERE r.status = 'approved'
+		AND (r.from_entry_id = ANY($1) OR r.to_entry_id = ANY($1))
+		AND ($2::text[] IS NULL OR r.type = ANY($2))
+		ORDER BY r.id
+	`, pq.Array(entryIDs), types)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edges []data.RelationGraphEdge
+
+	for rows.Next() {
+		var edge data.RelationGraphEdge
+
+		if err := rows.Scan(&edge.ID, &edge.FromEntryID, &edge.ToEntryID, &edge.Type); err != nil {
+			return nil, err
+		}
+
+		edges = append(edges, edge)
+	}
+
+	return edges, rows.Err()
+}
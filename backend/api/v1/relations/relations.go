@@ -0,0 +1,758 @@
+package relations
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	audit "backend/api/v1/audit"
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+const (
+	TypePhaseOf       = "phase_of"
+	TypeReplaces      = "replaces"
+	TypeSameDeveloper = "same_developer"
+	TypeAdjacentTo    = "adjacent_to"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+	StatusRemoved  = "removed"
+)
+
+const (
+	ActionProposed = "proposed"
+	ActionApproved = "approved"
+	ActionRejected = "rejected"
+	ActionRemoved  = "removed"
+	ActionReverted = "reverted"
+)
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// IsSymmetric reports whether a relation type reads the same from both
+// entries.
+func IsSymmetric(relationType string) bool {
+	return relationType == TypeSameDeveloper || relationType == TypeAdjacentTo
+}
+
+// Normalize orders the entries of a symmetric relation so each pair is
+// stored once. Directed relations are returned as given.
+func Normalize(fromEntryID int, toEntryID int, relationType string) (int, int) {
+	if IsSymmetric(relationType) && fromEntryID > toEntryID {
+		return toEntryID, fromEntryID
+	}
+
+	return fromEntryID, toEntryID
+}
+
+var labels = map[string][2]string{
+	TypePhaseOf:       {"Phase of", "Has phase"},
+	TypeReplaces:      {"Replaces", "Replaced by"},
+	TypeSameDeveloper: {"Same developer as", "Same developer as"},
+	TypeAdjacentTo:    {"Adjacent to", "Adjacent to"},
+}
+
+// Label describes a relation from one of its entries. outgoing is true for
+// the entry the relation starts from.
+func Label(relationType string, outgoing bool) string {
+	label, ok := labels[relationType]
+	if !ok {
+		return relationType
+	}
+
+	if outgoing {
+		return label[0]
+	}
+
+	return label[1]
+}
+
+func isActive(status string) bool {
+	return status == StatusPending || status == StatusApproved
+}
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+func recordHistory(
+	tx execer,
+	relationID int,
+	action string,
+	statusFrom *string,
+	statusTo string,
+	actorID int,
+	revertsID *int,
+) error {
+	_, err := tx.Exec(`
+		INSERT INTO entry_relation_history (relation_id, action, status_from, status_to, actor_id, reverts_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, relationID, action, statusFrom, statusTo, actorID, revertsID)
+
+	return err
+}
+
+// AddRelation links two entries. Relations from trusted users and moderators
+// are approved right away, everyone else's wait for a moderator.
+func AddRelation(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	var req data.AddRelationRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	if req.ToEntryID == entryID {
+		messages.StatusBadRequest(c, errors.New("An entry cannot be related to itself"))
+		return
+	}
+
+	userID, role, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	var found int
+
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM entry WHERE id IN ($1, $2) AND archived_at IS NULL
+	`, entryID, req.ToEntryID).Scan(&found)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if found != 2 {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	status := StatusPending
+	if utils.IsTrusted(role) {
+		status = StatusApproved
+	}
+
+	fromEntryID, toEntryID := Normalize(entryID, req.ToEntryID, req.Type)
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var relationID int
+
+	err = tx.QueryRow(`
+		INSERT INTO entry_relations (from_entry_id, to_entry_id, type, status, proposed_by, reviewed_by, date_reviewed)
+		VALUES ($1, $2, $3, $4, $5,
+			CASE WHEN $4 = 'approved' THEN $5::int END,
+			CASE WHEN $4 = 'approved' THEN now() END)
+		RETURNING id
+	`, fromEntryID, toEntryID, req.Type, status, userID).Scan(&relationID)
+	if isUniqueViolation(err) {
+		messages.StatusConflict(c, errors.New("These entries are already related that way"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := recordHistory(tx, relationID, ActionProposed, nil, status, userID, nil); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "relation.add",
+		TargetType: "relation",
+		TargetID:   relationID,
+		After: gin.H{
+			"from_entry_id": fromEntryID,
+			"to_entry_id":   toEntryID,
+			"type":          req.Type,
+			"status":        status,
+		},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":     relationID,
+		"status": status,
+	})
+}
+
+// RemoveRelation takes a relation down. Trusted users can remove any active
+// relation, anyone else can only withdraw their own pending proposal.
+func RemoveRelation(c *gin.Context, db *sql.DB) {
+	relationID, err := strconv.Atoi(c.Param("relationId"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid relation id"))
+		return
+	}
+
+	userID, role, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	var proposedBy sql.NullInt64
+
+	err = tx.QueryRow(`
+		SELECT status, proposed_by FROM entry_relations WHERE id = $1 FOR UPDATE
+	`, relationID).Scan(&status, &proposedBy)
+	if err == sql.ErrNoRows {
+		messages.StatusNotFound(c, errors.New("Relation not found"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !isActive(status) {
+		messages.StatusConflict(c, errors.New("Relation is already "+status))
+		return
+	}
+
+	ownProposal := status == StatusPending && int(proposedBy.Int64) == userID
+	if !ownProposal && !utils.IsTrusted(role) {
+		messages.StatusForbidden(c, errors.New("Only trusted users can remove relations"))
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE entry_relations SET status = 'removed' WHERE id = $1
+	`, relationID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := recordHistory(tx, relationID, ActionRemoved, &status, StatusRemoved, userID, nil); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "relation.remove",
+		TargetType: "relation",
+		TargetID:   relationID,
+		Before:     gin.H{"status": status},
+		After:      gin.H{"status": StatusRemoved},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Relation removed")
+}
+
+// ReviewRelation approves or rejects a pending relation.
+func ReviewRelation(c *gin.Context, db *sql.DB, approve bool) {
+	relationID, err := strconv.Atoi(c.Param("relationId"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid relation id"))
+		return
+	}
+
+	moderatorID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	action, newStatus := ActionRejected, StatusRejected
+	if approve {
+		action, newStatus = ActionApproved, StatusApproved
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+
+	err = tx.QueryRow(`
+		SELECT status FROM entry_relations WHERE id = $1 FOR UPDATE
+	`, relationID).Scan(&status)
+	if err == sql.ErrNoRows {
+		messages.StatusNotFound(c, errors.New("Relation not found"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if status != StatusPending {
+		messages.StatusConflict(c, errors.New("Relation is not pending"))
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE entry_relations
+		SET status = $2, reviewed_by = $3, date_reviewed = now()
+		WHERE id = $1
+	`, relationID, newStatus, moderatorID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := recordHistory(tx, relationID, action, &status, newStatus, moderatorID, nil); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    moderatorID,
+		Action:     "relation." + action,
+		TargetType: "relation",
+		TargetID:   relationID,
+		Before:     gin.H{"status": status},
+		After:      gin.H{"status": newStatus},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Relation "+newStatus)
+}
+
+// RevertRelationChange puts a relation back to the status it had before a
+// history event. It refuses when the relation has changed again since.
+func RevertRelationChange(c *gin.Context, db *sql.DB) {
+	historyID, err := strconv.Atoi(c.Param("historyId"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid history id"))
+		return
+	}
+
+	moderatorID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var relationID int
+	var statusFrom sql.NullString
+	var statusTo string
+	var currentStatus string
+
+	err = tx.QueryRow(`
+		SELECT h.relation_id, h.status_from, h.status_to, r.status
+		FROM entry_relation_history h
+		JOIN entry_relations r ON r.id = h.relation_id
+		WHERE h.id = $1
+		FOR UPDATE OF r
+	`, historyID).Scan(&relationID, &statusFrom, &statusTo, &currentStatus)
+	if err == sql.ErrNoRows {
+		messages.StatusNotFound(c, errors.New("History event not found"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if currentStatus != statusTo {
+		messages.StatusConflict(c, errors.New("Relation has changed since this event"))
+		return
+	}
+
+	// Reverting a proposal takes the relation down.
+	restored := StatusRemoved
+	if statusFrom.Valid {
+		restored = statusFrom.String
+	}
+
+	_, err = tx.Exec(`
+		UPDATE entry_relations
+		SET status = $2, reviewed_by = $3, date_reviewed = now()
+		WHERE id = $1
+	`, relationID, restored, moderatorID)
+	if isUniqueViolation(err) {
+		messages.StatusConflict(c, errors.New("An equivalent relation is active again"))
+		return
+	}
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := recordHistory(tx, relationID, ActionReverted, &currentStatus, restored, moderatorID, &historyID); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    moderatorID,
+		Action:     "relation.revert",
+		TargetType: "relation",
+		TargetID:   relationID,
+		Before:     gin.H{"status": currentStatus},
+		After:      gin.H{"status": restored},
+		Details:    gin.H{"history_id": historyID},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Relation change reverted")
+}
+
+// RetrieveForEntry returns the approved relations of an entry to entries that
+// are not archived.
+func RetrieveForEntry(db queryer, entryID int) ([]data.EntryRelation, error) {
+	rows, err := db.Query(`
+		SELECT r.id,
+			r.type,
+			r.from_entry_id = $1 AS outgoing,
+			other.id,
+			COALESCE(er.title, ''),
+			r.status,
+			COALESCE(u.username, ''),
+			r.date_created
+		FROM entry_relations r
+		JOIN entry other ON other.id = CASE WHEN r.from_entry_id = $1 THEN r.to_entry_id ELSE r.from_entry_id END
+		LEFT JOIN users u ON u.id = r.proposed_by
+		LEFT JOIN LATERAL (
+			SELECT title FROM entry_revision
+			WHERE entry_id = other.id
+			ORDER BY revision_number DESC
+			LIMIT 1
+		) er ON true
+		WHERE $1 IN (r.from_entry_id, r.to_entry_id)
+		AND r.status = 'approved'
+		AND other.archived_at IS NULL
+		AND other.hidden_at IS NULL
+		ORDER BY r.type, other.id
+	`, entryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var relations []data.EntryRelation
+
+	for rows.Next() {
+		var relation data.EntryRelation
+		var outgoing bool
+
+		err := rows.Scan(
+			&relation.ID,
+			&relation.Type,
+			&outgoing,
+			&relation.EntryID,
+			&relation.Title,
+			&relation.Status,
+			&relation.ProposedBy,
+			&relation.DateCreated,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		relation.Label = Label(relation.Type, outgoing)
+		relations = append(relations, relation)
+	}
+
+	return relations, rows.Err()
+}
+
+func RetrieveEntryRelations(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	visible, err := utils.EntryVisible(c, db, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !visible {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	relations, err := RetrieveForEntry(db, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if relations == nil {
+		relations = []data.EntryRelation{}
+	}
+
+	c.JSON(http.StatusOK, relations)
+}
+
+func RetrievePendingRelations(c *gin.Context, db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT r.id,
+			r.type,
+			r.from_entry_id,
+			COALESCE(fr.title, ''),
+			r.to_entry_id,
+			COALESCE(tr.title, ''),
+			COALESCE(u.username, ''),
+			r.date_created
+		FROM entry_relations r
+		LEFT JOIN users u ON u.id = r.proposed_by
+		LEFT JOIN LATERAL (
+			SELECT title FROM entry_revision
+			WHERE entry_id = r.from_entry_id
+			ORDER BY revision_number DESC
+			LIMIT 1
+		) fr ON true
+		LEFT JOIN LATERAL (
+			SELECT title FROM entry_revision
+			WHERE entry_id = r.to_entry_id
+			ORDER BY revision_number DESC
+			LIMIT 1
+		) tr ON true
+		WHERE r.status = 'pending'
+		ORDER BY r.date_created, r.id
+	`)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	pending := []data.PendingRelation{}
+
+	for rows.Next() {
+		var relation data.PendingRelation
+
+		err := rows.Scan(
+			&relation.ID,
+			&relation.Type,
+			&relation.FromEntryID,
+			&relation.FromTitle,
+			&relation.ToEntryID,
+			&relation.ToTitle,
+			&relation.ProposedBy,
+			&relation.DateCreated,
+		)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		pending = append(pending, relation)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pending)
+}
+
+// RetrieveRelationHistory lists every change to the relations of an entry,
+// newest first.
+func RetrieveRelationHistory(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	visible, err := utils.EntryVisible(c, db, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if !visible {
+		messages.StatusNotFound(c, errors.New("Entry not found"))
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT h.id,
+			h.relation_id,
+			r.type,
+			r.from_entry_id,
+			r.to_entry_id,
+			h.action,
+			h.status_from,
+			h.status_to,
+			COALESCE(u.username, ''),
+			h.reverts_id,
+			h.date_created
+		FROM entry_relation_history h
+		JOIN entry_relations r ON r.id = h.relation_id
+		LEFT JOIN users u ON u.id = h.actor_id
+		WHERE $1 IN (r.from_entry_id, r.to_entry_id)
+		ORDER BY h.date_created DESC, h.id DESC
+	`, entryID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	history := []data.RelationHistoryEvent{}
+
+	for rows.Next() {
+		var event data.RelationHistoryEvent
+
+		err := rows.Scan(
+			&event.ID,
+			&event.RelationID,
+			&event.Type,
+			&event.FromEntryID,
+			&event.ToEntryID,
+			&event.Action,
+			&event.StatusFrom,
+			&event.StatusTo,
+			&event.Actor,
+			&event.RevertsID,
+			&event.DateCreated,
+		)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		history = append(history, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// MoveRelations re-points the relations of a merged entry at the entry it
+// was merged into. Relations between the two entries and relations the
+// target already has are dropped instead.
+func MoveRelations(tx execer, sourceID int, targetID int) error {
+	const moved = `
+		WITH moved AS (
+			SELECT id, type, status,
+				CASE WHEN from_entry_id = $1 THEN $2 ELSE from_entry_id END AS from_entry_id,
+				CASE WHEN to_entry_id = $1 THEN $2 ELSE to_entry_id END AS to_entry_id
+			FROM entry_relations
+			WHERE $1 IN (from_entry_id, to_entry_id)
+		),
+		normalized AS (
+			SELECT id, type, status,
+				CASE WHEN type IN ('same_developer', 'adjacent_to')
+					THEN LEAST(from_entry_id, to_entry_id) ELSE from_entry_id END AS from_entry_id,
+				CASE WHEN type IN ('same_developer', 'adjacent_to')
+					THEN GREATEST(from_entry_id, to_entry_id) ELSE to_entry_id END AS to_entry_id
+			FROM moved
+		)
+	`
+
+	_, err := tx.Exec(moved+`
+		DELETE FROM entry_relations r
+		USING normalized n
+		WHERE r.id = n.id
+		AND (
+			n.from_entry_id = n.to_entry_id
+			OR (n.status IN ('pending', 'approved') AND EXISTS (
+				SELECT 1 FROM entry_relations existing
+				WHERE existing.from_entry_id = n.from_entry_id
+				AND existing.to_entry_id = n.to_entry_id
+				AND existing.type = n.type
+				AND existing.status IN ('pending', 'approved')
+			))
+		)
+	`, sourceID, targetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(moved+`
+		UPDATE entry_relations r
+		SET from_entry_id = n.from_entry_id, to_entry_id = n.to_entry_id
+		FROM normalized n
+		WHERE r.id = n.id
+	`, sourceID, targetID)
+
+	return err
+}
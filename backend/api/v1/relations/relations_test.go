@@ -0,0 +1,61 @@
+package relations
+
+import (
+	"slices"
+	"testing"
+
+	data "backend/api/v1/data"
+)
+
+func TestNormalize(t *testing.T) {
+	if from, to := Normalize(9, 4, TypeAdjacentTo); from != 4 || to != 9 {
+		t.Errorf("symmetric relation normalized to %d, %d", from, to)
+	}
+
+	if from, to := Normalize(9, 4, TypePhaseOf); from != 9 || to != 4 {
+		t.Errorf("directed relation normalized to %d, %d", from, to)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	tests := []struct {
+		relationType string
+		outgoing     bool
+		want         string
+	}{
+		{TypePhaseOf, true, "Phase of"},
+		{TypePhaseOf, false, "Has phase"},
+		{TypeReplaces, false, "Replaced by"},
+		{TypeSameDeveloper, false, "Same developer as"},
+	}
+
+	for _, test := range tests {
+		if got := Label(test.relationType, test.outgoing); got != test.want {
+			t.Errorf("Label(%q, %v) = %q, want %q", test.relationType, test.outgoing, got, test.want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	edges := []data.RelationGraphEdge{
+		{ID: 1, FromEntryID: 1, ToEntryID: 2},
+		{ID: 2, FromEntryID: 3, ToEntryID: 1},
+		{ID: 3, FromEntryID: 2, ToEntryID: 3},
+		{ID: 4, FromEntryID: 4, ToEntryID: 5},
+	}
+
+	visited := map[int]int{1: 0}
+
+	next := expand(map[int]bool{1: true}, edges, visited)
+	if !slices.Equal(next, []int{2, 3}) {
+		t.Fatalf("got %v, want [2 3]", next)
+	}
+
+	for _, id := range next {
+		visited[id] = 1
+	}
+
+	if next := expand(map[int]bool{2: true, 3: true}, edges, visited); len(next) != 0 {
+		t.Errorf("got %v, want nothing new", next)
+	}
+}
@@ -0,0 +1,174 @@
+package search
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	pagination "backend/api/v1/pagination"
+)
+
+// SearchDiscussions finds comments matching q, best matches first. Hidden
+// comments and comments on hidden or archived entries are left out.
+func SearchDiscussions(c *gin.Context, db *sql.DB) {
+	var query data.DiscussionSearchQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	for _, date := range []*string{query.After, query.Before} {
+		if date == nil {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, *date); err != nil {
+			messages.StatusBadRequest(c, errors.New("Dates must be YYYY-MM-DD"))
+			return
+		}
+	}
+
+	sort := searchCursorSort("discussions", query.Q)
+
+	cursor, cursorRank, err := decodeRankCursor(query.Cursor, sort)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	limit := pagination.Limit(query.Limit)
+
+	rows, err := db.Query(`
+		WITH ranked AS (
+			SELECT conv.id, ts_rank_cd(conv.search_document, q)::float8 AS rank
+			FROM conversation conv
+			JOIN entry e ON e.id = conv.entry_id
+			JOIN users u ON u.id = conv.user_id,
+			websearch_to_tsquery('english', $1) q
+			WHERE conv.search_document @@ q
+			AND conv.hidden_at IS NULL
+			AND e.archived_at IS NULL
+			AND e.hidden_at IS NULL
+			AND ($2::text IS NULL OR conv.type = $2)
+			AND ($3::int IS NULL OR conv.entry_id = $3)
+			AND ($4::text IS NULL OR lower(u.username) = lower($4))
+			AND ($5::date IS NULL OR conv.date_created >= $5::date)
+			AND ($6::date IS NULL OR conv.date_created < $6::date + 1)
+		),
+		page AS (
+			SELECT id, rank
+			FROM ranked
+			WHERE $7::float8 IS NULL OR (rank, id) < ($7::float8, $8::int)
+			ORDER BY rank DESC, id DESC
+			LIMIT $9
+		),
+		thread AS (
+			SELECT p.id AS comment_id, conv.parent_id AS ancestor_id, 1 AS depth
+			FROM page p
+			JOIN conversation conv ON conv.id = p.id
+			WHERE conv.parent_id IS NOT NULL
+			UNION ALL
+			SELECT t.comment_id, conv.parent_id, t.depth + 1
+			FROM thread t
+			JOIN conversation conv ON conv.id = t.ancestor_id
+			WHERE conv.parent_id IS NOT NULL AND t.depth < 100
+		)
+		SELECT conv.id,
+			conv.entry_id,
+			er.title,
+			conv.parent_id,
+			COALESCE((
+				SELECT array_agg(t.ancestor_id ORDER BY t.depth DESC)
+				FROM thread t
+				WHERE t.comment_id = conv.id
+			), '{}'),
+			conv.type,
+			u.username,
+			ts_headline('english', conv.context, q, $10),
+			p.rank,
+			conv.date_created
+		FROM page p
+		JOIN conversation conv ON conv.id = p.id
+		JOIN users u ON u.id = conv.user_id
+		JOIN LATERAL (
+			SELECT title
+			FROM entry_revision
+			WHERE entry_id = conv.entry_id
+			ORDER BY revision_number DESC
+			LIMIT 1
+		) er ON true
+		CROSS JOIN websearch_to_tsquery('english', $1) q
+		ORDER BY p.rank DESC, p.id DESC
+	`,
+		query.Q,
+		query.Type,
+		query.EntryID,
+		query.Author,
+		query.After,
+		query.Before,
+		cursorRank,
+		cursor.IDArg(),
+		limit+1,
+		headlineOptions(15, 35, 2),
+	)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	results := []data.DiscussionSearchResult{}
+
+	for rows.Next() {
+		var result data.DiscussionSearchResult
+		var threadPath []int64
+
+		err := rows.Scan(
+			&result.ID,
+			&result.EntryID,
+			&result.EntryTitle,
+			&result.ParentID,
+			pq.Array(&threadPath),
+			&result.Type,
+			&result.Username,
+			&result.Snippet,
+			&result.Rank,
+			&result.DateCreated,
+		)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		result.ThreadPath = make([]int, len(threadPath))
+		for i, id := range threadPath {
+			result.ThreadPath[i] = int(id)
+		}
+
+		result.Snippet = Highlight(result.Snippet)
+
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	results, more := pagination.Trim(results, limit)
+
+	page := data.DiscussionSearchPage{Results: results}
+
+	if more {
+		last := results[len(results)-1]
+		page.NextCursor = nextRankCursor(sort, last.Rank, last.ID)
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,297 @@
+package search
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	pagination "backend/api/v1/pagination"
+	utils "backend/api/v1/utils"
+)
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// ts_headline marks matches with these private use characters rather than
+// HTML, so the text around them can be escaped before they become <mark>.
+const (
+	startMark = "\ue000"
+	stopMark  = "\ue001"
+)
+
+// headlineOptions are ts_headline options for a snippet of about maxWords
+// words from up to maxFragments places in the text. Zero fragments
+// highlights the whole text.
+func headlineOptions(minWords int, maxWords int, maxFragments int) string {
+	return fmt.Sprintf(
+		"StartSel=\"%s\", StopSel=\"%s\", MinWords=%d, MaxWords=%d, MaxFragments=%d, FragmentDelimiter=\" … \"",
+		startMark, stopMark, minWords, maxWords, maxFragments,
+	)
+}
+
+// Highlight turns a ts_headline made with headlineOptions into HTML, escaped
+// except for the <mark> around matched words.
+func Highlight(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, startMark, "<mark>")
+	return strings.ReplaceAll(escaped, stopMark, "</mark>")
+}
+
+// IndexEntry rebuilds an entry's search document from its latest revision.
+// Call it whenever a revision is added.
+func IndexEntry(tx execer, entryID int) error {
+	_, err := tx.Exec(`
+		UPDATE entry SET search_document = entry_search_document(id) WHERE id = $1
+	`, entryID)
+
+	return err
+}
+
+// searchArea is the optional bounds or radius of a search, as query
+// arguments that are all nil when it isn't set.
+type searchArea struct {
+	West, South, East, North      any
+	Longitude, Latitude, Distance any
+}
+
+func newSearchArea(query data.EntrySearchQuery) (searchArea, error) {
+	var area searchArea
+
+	bounds := []*float64{query.West, query.South, query.East, query.North}
+	radius := []*float64{query.Longitude, query.Latitude, query.Distance}
+
+	hasBounds, err := allOrNone(bounds, "west, south, east and north")
+	if err != nil {
+		return area, err
+	}
+
+	hasRadius, err := allOrNone(radius, "longitude, latitude and distance")
+	if err != nil {
+		return area, err
+	}
+
+	if hasBounds && hasRadius {
+		return area, errors.New("Search either within bounds or within a distance, not both")
+	}
+
+	if hasBounds {
+		area.West, area.South, area.East, area.North = *query.West, *query.South, *query.East, *query.North
+	}
+	if hasRadius {
+		area.Longitude, area.Latitude = *query.Longitude, *query.Latitude
+		area.Distance = utils.DistanceMeters(*query.Distance, query.Unit)
+	}
+
+	return area, nil
+}
+
+func allOrNone(values []*float64, names string) (bool, error) {
+	set := 0
+	for _, value := range values {
+		if value != nil {
+			set++
+		}
+	}
+
+	if set != 0 && set != len(values) {
+		return false, fmt.Errorf("Give all of %s, or none", names)
+	}
+
+	return set != 0, nil
+}
+
+// searchCursorSort ties a cursor to what was searched and how, ranks from
+// one search mean nothing in another.
+func searchCursorSort(kind string, q string) string {
+	return kind + ":" + q
+}
+
+// decodeRankCursor reads the cursor of a search page, returning it with its
+// rank as a query argument, nil on the first page.
+func decodeRankCursor(encoded string, sort string) (*pagination.Cursor, any, error) {
+	cursor, err := pagination.Decode(encoded, sort)
+	if err != nil || cursor == nil {
+		return nil, nil, err
+	}
+
+	rank, err := strconv.ParseFloat(cursor.Key, 64)
+	if err != nil {
+		return nil, nil, pagination.ErrInvalidCursor
+	}
+
+	return cursor, rank, nil
+}
+
+func nextRankCursor(sort string, rank float64, id int) *string {
+	next := pagination.Cursor{
+		Sort: sort,
+		Key:  strconv.FormatFloat(rank, 'g', -1, 64),
+		ID:   id,
+	}.Encode()
+
+	return &next
+}
+
+// SearchEntries finds entries whose latest revision, tags or address match
+// q, best matches first.
+func SearchEntries(c *gin.Context, db *sql.DB) {
+	var query data.EntrySearchQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	area, err := newSearchArea(query)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	sort := searchCursorSort("entries", query.Q)
+
+	cursor, cursorRank, err := decodeRankCursor(query.Cursor, sort)
+	if err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	limit := pagination.Limit(query.Limit)
+
+	// Rank every match, but only build headlines for the page.
+	rows, err := db.Query(`
+		WITH ranked AS (
+			SELECT e.id, ts_rank_cd(e.search_document, q)::float8 AS rank
+			FROM entry e, websearch_to_tsquery('english', $1) q
+			WHERE e.search_document @@ q
+			AND e.archived_at IS NULL
+			AND e.hidden_at IS NULL
+			AND ($2::float8 IS NULL OR ST_Intersects(
+				COALESCE(e.footprint, e.location)::geometry,
+				ST_MakeEnvelope($2, $3, $4, $5, 4326)
+			))
+			AND ($6::float8 IS NULL OR ST_DWithin(
+				COALESCE(e.footprint, e.location),
+				ST_MakePoint($6, $7)::geography,
+				$8
+			))
+		),
+		page AS (
+			SELECT id, rank
+			FROM ranked
+			WHERE $9::float8 IS NULL OR (rank, id) < ($9::float8, $10::int)
+			ORDER BY rank DESC, id DESC
+			LIMIT $11
+		)
+		SELECT e.id,
+			er.title,
+			e.address,
+			ts_headline('english', er.title, q, $12),
+			ts_headline('english', er.content, q, $13),
+			p.rank,
+			e.date_created,
+			u.username,
+			ST_X(e.location::geometry),
+			ST_Y(e.location::geometry),
+			(
+				SELECT json_agg(json_build_object('name', t.name, 'classification', t.classification))
+				FROM tags_entry_revision ter
+				JOIN tags t ON t.id = ter.tag_id
+				WHERE ter.entry_revision_id = er.id
+			)
+		FROM page p
+		JOIN entry e ON e.id = p.id
+		JOIN users u ON u.id = e.creator_id
+		JOIN LATERAL (
+			SELECT id, title, content
+			FROM entry_revision
+			WHERE entry_id = e.id
+			ORDER BY revision_number DESC
+			LIMIT 1
+		) er ON true
+		CROSS JOIN websearch_to_tsquery('english', $1) q
+		ORDER BY p.rank DESC, p.id DESC
+	`,
+		query.Q,
+		area.West,
+		area.South,
+		area.East,
+		area.North,
+		area.Longitude,
+		area.Latitude,
+		area.Distance,
+		cursorRank,
+		cursor.IDArg(),
+		limit+1,
+		headlineOptions(1, 50, 0),
+		headlineOptions(15, 35, 2),
+	)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	results := []data.EntrySearchResult{}
+
+	for rows.Next() {
+		var result data.EntrySearchResult
+		var tags []byte
+
+		err := rows.Scan(
+			&result.ID,
+			&result.Title,
+			&result.Address,
+			&result.TitleHighlight,
+			&result.Snippet,
+			&result.Rank,
+			&result.DateCreated,
+			&result.Username,
+			&result.Longitude,
+			&result.Latitude,
+			&tags,
+		)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		if tags != nil {
+			if err := json.Unmarshal(tags, &result.Tags); err != nil {
+				messages.InternalServerError(c, err)
+				return
+			}
+		}
+
+		result.TitleHighlight = Highlight(result.TitleHighlight)
+		result.Snippet = Highlight(result.Snippet)
+
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	results, more := pagination.Trim(results, limit)
+
+	page := data.EntrySearchPage{Results: results}
+
+	if more {
+		last := results[len(results)-1]
+		page.NextCursor = nextRankCursor(sort, last.Rank, last.ID)
+	}
+
+	c.JSON(http.StatusOK, page)
+}
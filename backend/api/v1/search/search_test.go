@@ -0,0 +1,99 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	data "backend/api/v1/data"
+	pagination "backend/api/v1/pagination"
+	utils "backend/api/v1/utils"
+)
+
+func TestHighlightEscapesAroundMarks(t *testing.T) {
+	headline := "Tower <b>&</b> " + startMark + "Park" + stopMark + " on " + startMark + "Main" + stopMark
+
+	want := "Tower &lt;b&gt;&amp;&lt;/b&gt; <mark>Park</mark> on <mark>Main</mark>"
+	if got := Highlight(headline); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHeadlineOptionsQuoteMarks(t *testing.T) {
+	options := headlineOptions(15, 35, 2)
+
+	for _, option := range []string{`StartSel="` + startMark + `"`, `StopSel="` + stopMark + `"`, "MaxFragments=2"} {
+		if !strings.Contains(options, option) {
+			t.Errorf("%q is missing %q", options, option)
+		}
+	}
+}
+
+func TestNewSearchArea(t *testing.T) {
+	one, two := 1.0, 2.0
+
+	area, err := newSearchArea(data.EntrySearchQuery{West: &one, South: &one, East: &two, North: &two})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if area.West != 1.0 || area.North != 2.0 || area.Longitude != nil {
+		t.Errorf("bounds: got %+v", area)
+	}
+
+	area, err = newSearchArea(data.EntrySearchQuery{Longitude: &one, Latitude: &two, Distance: &one})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if area.Latitude != 2.0 || area.West != nil || area.Distance != utils.MetersPerMile {
+		t.Errorf("radius: got %+v", area)
+	}
+
+	area, err = newSearchArea(data.EntrySearchQuery{Longitude: &one, Latitude: &two, Distance: &one, Unit: "km"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if area.Distance != float64(utils.MetersPerKilometer) {
+		t.Errorf("radius in km: got %+v", area)
+	}
+
+	invalid := map[string]data.EntrySearchQuery{
+		"partial bounds": {West: &one, South: &one},
+		"partial radius": {Longitude: &one, Latitude: &one},
+		"both": {
+			West: &one, South: &one, East: &two, North: &two,
+			Longitude: &one, Latitude: &one, Distance: &one,
+		},
+	}
+
+	for name, query := range invalid {
+		if _, err := newSearchArea(query); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestRankCursorRoundTrip(t *testing.T) {
+	sort := searchCursorSort("discussions", "traffic study")
+
+	next := nextRankCursor(sort, 0.1, 42)
+
+	cursor, rank, err := decodeRankCursor(*next, sort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rank != 0.1 || cursor.ID != 42 {
+		t.Errorf("got rank %v and id %d", rank, cursor.ID)
+	}
+
+	for _, other := range []string{
+		searchCursorSort("entries", "traffic study"),
+		searchCursorSort("discussions", "parking study"),
+	} {
+		if _, _, err := decodeRankCursor(*next, other); err != pagination.ErrInvalidCursor {
+			t.Errorf("%s: got %v, want ErrInvalidCursor", other, err)
+		}
+	}
+
+	if cursor, rank, err := decodeRankCursor("", sort); cursor != nil || rank != nil || err != nil {
+		t.Errorf("first page: got %v, %v, %v", cursor, rank, err)
+	}
+}
@@ -0,0 +1,36 @@
+package users
+
+import (
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+// ShowGravatar opts the signed in user into a Gravatar avatar wherever they
+// are credited as a contributor. The avatar URL holds a hash of their email
+// address, which is why it's off until they turn it on.
+func ShowGravatar(c *gin.Context, db *sql.DB) {
+	setShowGravatar(c, db, true, "Gravatar shown")
+}
+
+func HideGravatar(c *gin.Context, db *sql.DB) {
+	setShowGravatar(c, db, false, "Gravatar hidden")
+}
+
+func setShowGravatar(c *gin.Context, db *sql.DB, show bool, message string) {
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	if _, err := db.Exec(`UPDATE users SET show_gravatar = $2 WHERE id = $1`, userID, show); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, message)
+}
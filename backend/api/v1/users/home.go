@@ -0,0 +1,155 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	audit "backend/api/v1/audit"
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+// RetrieveHomeLocation returns the home location a user saved, or nil.
+func RetrieveHomeLocation(db queryRower, userID int) (*data.HomeLocation, error) {
+	var home data.HomeLocation
+	var latitude, longitude sql.NullFloat64
+
+	err := db.QueryRow(`
+		SELECT ST_Y(home_location::geometry), ST_X(home_location::geometry)
+		FROM users
+		WHERE id = $1
+	`, userID).Scan(&latitude, &longitude)
+	if err != nil {
+		return nil, err
+	}
+
+	if !latitude.Valid || !longitude.Valid {
+		return nil, nil
+	}
+
+	home.Latitude = latitude.Float64
+	home.Longitude = longitude.Float64
+
+	return &home, nil
+}
+
+// GetHomeLocation returns the signed in user's home location. It is only
+// ever shown to them.
+func GetHomeLocation(c *gin.Context, db *sql.DB) {
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	home, err := RetrieveHomeLocation(db, userID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if home == nil {
+		messages.StatusNotFound(c, errors.New("No home location saved"))
+		return
+	}
+
+	c.JSON(http.StatusOK, home)
+}
+
+// SetHomeLocation saves where the signed in user's feed centers on with
+// near=home. The audit log only notes that it changed, the location itself
+// stays private.
+func SetHomeLocation(c *gin.Context, db *sql.DB) {
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	var req data.SetHomeLocationRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET home_location = ST_SetSRID(ST_MakePoint($2, $3), 4326)
+		WHERE id = $1
+	`, userID, *req.Longitude, *req.Latitude)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "user.home_location.set",
+		TargetType: "user",
+		TargetID:   userID,
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, data.HomeLocation{
+		Latitude:  *req.Latitude,
+		Longitude: *req.Longitude,
+	})
+}
+
+func ClearHomeLocation(c *gin.Context, db *sql.DB) {
+	userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET home_location = NULL WHERE id = $1`, userID); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "user.home_location.clear",
+		TargetType: "user",
+		TargetID:   userID,
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Home location cleared")
+}
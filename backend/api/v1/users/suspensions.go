@@ -0,0 +1,303 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	audit "backend/api/v1/audit"
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+var ErrSuspendSelf = errors.New("You cannot suspend yourself")
+var ErrSuspendModerator = errors.New("Only admins can suspend moderators")
+
+// CheckSuspendable returns an error when the moderator may not suspend the
+// user: nobody suspends themselves, and only admins suspend moderators and
+// other admins. sql.ErrNoRows means the user doesn't exist.
+func CheckSuspendable(db queryRower, userID int, moderatorID int, moderatorRole string) error {
+	if userID == moderatorID {
+		return ErrSuspendSelf
+	}
+
+	var role string
+
+	err := db.QueryRow(`
+		SELECT role FROM users WHERE id = $1
+	`, userID).Scan(&role)
+	if err != nil {
+		return err
+	}
+
+	if utils.IsModerator(role) && !utils.IsAdmin(moderatorRole) {
+		return ErrSuspendModerator
+	}
+
+	return nil
+}
+
+// Suspend suspends a user for a number of days, or bans them permanently
+// when days is 0.
+func Suspend(tx execer, userID int, moderatorID int, reason string, days int) error {
+	var endsAt any
+	if days > 0 {
+		endsAt = days
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO user_suspensions (user_id, reason, suspended_by, ends_at)
+		VALUES ($1, $2, $3, now() + make_interval(days => $4::int))
+	`, userID, reason, moderatorID, endsAt)
+
+	return err
+}
+
+// RetrieveActiveSuspension returns the suspension currently keeping a user
+// out, preferring a permanent ban over the one that ends last, or nil.
+func RetrieveActiveSuspension(db queryRower, userID int) (*data.Suspension, error) {
+	var suspension data.Suspension
+
+	err := db.QueryRow(`
+		SELECT s.id, s.user_id, s.reason, COALESCE(u.username, ''), s.ends_at, s.ends_at IS NULL, s.date_created
+		FROM user_suspensions s
+		LEFT JOIN users u ON u.id = s.suspended_by
+		WHERE s.user_id = $1
+		AND s.lifted_at IS NULL
+		AND (s.ends_at IS NULL OR s.ends_at > now())
+		ORDER BY s.ends_at IS NULL DESC, s.ends_at DESC
+		LIMIT 1
+	`, userID).Scan(
+		&suspension.ID,
+		&suspension.UserID,
+		&suspension.Reason,
+		&suspension.SuspendedBy,
+		&suspension.EndsAt,
+		&suspension.Permanent,
+		&suspension.DateCreated,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &suspension, nil
+}
+
+// StatusSuspended tells a suspended user why they are locked out and until
+// when.
+func StatusSuspended(c *gin.Context, suspension *data.Suspension) {
+	message := "Your account is suspended"
+	if suspension.Permanent {
+		message = "Your account is banned"
+	}
+
+	c.JSON(http.StatusForbidden, data.SuspendedResponse{
+		Error:     message,
+		Reason:    suspension.Reason,
+		EndsAt:    suspension.EndsAt,
+		Permanent: suspension.Permanent,
+	})
+}
+
+// SuspendUser suspends or bans a user. Only admins can suspend moderators and
+// other admins.
+func SuspendUser(c *gin.Context, db *sql.DB) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid user id"))
+		return
+	}
+
+	var req data.SuspendUserRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		messages.StatusBadRequest(c, err)
+		return
+	}
+
+	moderatorID, moderatorRole, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	switch err := CheckSuspendable(db, userID, moderatorID, moderatorRole); err {
+	case nil:
+	case ErrSuspendSelf:
+		messages.StatusBadRequest(c, err)
+		return
+	case ErrSuspendModerator:
+		messages.StatusForbidden(c, err)
+		return
+	case sql.ErrNoRows:
+		messages.StatusNotFound(c, errors.New("User not found"))
+		return
+	default:
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := Suspend(tx, userID, moderatorID, req.Reason, *req.Days); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    moderatorID,
+		Action:     "user.suspend",
+		TargetType: "user",
+		TargetID:   userID,
+		Details: gin.H{
+			"reason": req.Reason,
+			"days":   *req.Days,
+		},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "User suspended")
+}
+
+// LiftSuspension ends every suspension in force for a user.
+func LiftSuspension(c *gin.Context, db *sql.DB) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid user id"))
+		return
+	}
+
+	moderatorID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE user_suspensions
+		SET lifted_at = now(), lifted_by = $2
+		WHERE user_id = $1
+		AND lifted_at IS NULL
+		AND (ends_at IS NULL OR ends_at > now())
+	`, userID, moderatorID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	lifted, err := result.RowsAffected()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if lifted == 0 {
+		messages.StatusNotFound(c, errors.New("User is not suspended"))
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    moderatorID,
+		Action:     "user.unsuspend",
+		TargetType: "user",
+		TargetID:   userID,
+		Details:    gin.H{"lifted": lifted},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	messages.StatusOk(c, "Suspension lifted")
+}
+
+func RetrieveUserSuspensions(c *gin.Context, db *sql.DB) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid user id"))
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT s.id, s.user_id, s.reason, COALESCE(u.username, ''), s.ends_at, s.ends_at IS NULL, s.lifted_at, s.date_created
+		FROM user_suspensions s
+		LEFT JOIN users u ON u.id = s.suspended_by
+		WHERE s.user_id = $1
+		ORDER BY s.date_created DESC, s.id DESC
+	`, userID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	suspensions := []data.Suspension{}
+
+	for rows.Next() {
+		var suspension data.Suspension
+
+		err := rows.Scan(
+			&suspension.ID,
+			&suspension.UserID,
+			&suspension.Reason,
+			&suspension.SuspendedBy,
+			&suspension.EndsAt,
+			&suspension.Permanent,
+			&suspension.LiftedAt,
+			&suspension.DateCreated,
+		)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		suspensions = append(suspensions, suspension)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, suspensions)
+}
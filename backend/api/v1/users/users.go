@@ -10,6 +10,7 @@ import (
 
 	"github.com/lib/pq"
 
+	audit "backend/api/v1/audit"
 	data "backend/api/v1/data"
 	messages "backend/api/v1/messages"
 	utils "backend/api/v1/utils"
@@ -29,16 +30,45 @@ func CreateUser(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	_, err = db.Exec(`
+	tx, err := db.Begin()
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var userID int
+
+	err = tx.QueryRow(`
 		INSERT INTO users (username, first_name, last_name, password, email, phone_number)
 		VALUES ($1, $2, $3, $4, $5, $6)
-	`, payload.Username, payload.FirstName, payload.LastName, hashedPassword, payload.Email, payload.PhoneNumber)
+		RETURNING id
+	`, payload.Username, payload.FirstName, payload.LastName, hashedPassword, payload.Email, payload.PhoneNumber).Scan(&userID)
 	if err != nil {
 		if err, ok := err.(*pq.Error); ok && err.Code == "23505" {
 			messages.StatusConflict(c, err)
+			return
 		}
 
 		messages.InternalServerError(c, err)
+		return
+	}
+
+	err = audit.Record(tx, c, audit.Event{
+		ActorID:    userID,
+		Action:     "user.create",
+		TargetType: "user",
+		TargetID:   userID,
+		After:      gin.H{"username": payload.Username},
+	})
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		messages.InternalServerError(c, err)
+		return
 	}
 
 	accessToken, accessTokenExpDate, err := utils.GenerateAccessToken(payload.Username)
@@ -72,11 +102,12 @@ func LoginUser(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	var userID int
 	var hashedPassword string
 
 	err := db.QueryRow(`
-		SELECT password FROM users WHERE username = $1
-	`, payload.Username).Scan(&hashedPassword)
+		SELECT id, password FROM users WHERE username = $1
+	`, payload.Username).Scan(&userID, &hashedPassword)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			messages.StatusUnauthorized(c, err)
@@ -92,6 +123,17 @@ func LoginUser(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	suspension, err := RetrieveActiveSuspension(db, userID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if suspension != nil {
+		StatusSuspended(c, suspension)
+		return
+	}
+
 	accessToken, accessTokenExpDate, err := utils.GenerateAccessToken(payload.Username)
 	if err != nil {
 		messages.InternalServerError(c, err)
@@ -114,7 +156,7 @@ func LoginUser(c *gin.Context, db *sql.DB) {
 	messages.StatusOk(c, "User successfully logged in")
 }
 
-func RefreshToken(c *gin.Context) {
+func RefreshToken(c *gin.Context, db *sql.DB) {
 	refreshToken, err := c.Cookie("refresh_token")
 	if err != nil {
 		messages.StatusUnauthorized(c, err)
@@ -141,6 +183,27 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
+	var userID int
+
+	err = db.QueryRow(`
+		SELECT id FROM users WHERE username = $1
+	`, username).Scan(&userID)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	suspension, err := RetrieveActiveSuspension(db, userID)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if suspension != nil {
+		StatusSuspended(c, suspension)
+		return
+	}
+
 	newAccessToken, expirationDate, err := utils.GenerateAccessToken(username)
 	if err != nil {
 		messages.InternalServerError(c, err)
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"strings"
 	"time"
+	"unicode"
 
 	structs "backend/api/v1/structs"
 
@@ -15,6 +17,18 @@ import (
 
 var JwtSecret = []byte(os.Getenv("JWT_SECRET"))
 
+const (
+	RoleUser      = "user"
+	RoleTrusted   = "trusted"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+const (
+	MetersPerMile      = 1609.34
+	MetersPerKilometer = 1000
+)
+
 func GenerateAccessToken(username string) (string, int64, error) {
 	expirationTime := time.Now().Add(8 * 60 * time.Minute).Unix()
 	fmt.Println("Expiration Time:", expirationTime)
@@ -72,6 +86,69 @@ func VerifyTokenAndReturnUsername(token string) (string, error) {
 	return ParseTokenAndReturnUsername(token)
 }
 
+func IsTrusted(role string) bool {
+	return role == RoleTrusted || IsModerator(role)
+}
+
+func IsModerator(role string) bool {
+	return role == RoleModerator || role == RoleAdmin
+}
+
+func IsAdmin(role string) bool {
+	return role == RoleAdmin
+}
+
+func RetrieveUserIdAndRoleFromCookie(c *gin.Context, db *sql.DB) (int, string, error) {
+	cookie, err := c.Cookie("access_token")
+	if err != nil {
+		return 0, "", err
+	}
+
+	username, err := ParseTokenAndReturnUsername(cookie)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var userID int
+	var role string
+
+	err = db.QueryRow(`
+		SELECT id, role FROM users WHERE username = $1
+	`, username).Scan(&userID, &role)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return userID, role, nil
+}
+
+// EntryVisible reports whether the signed in user can read an entry. Archived
+// entries are gone for everyone, hidden ones for all but moderators.
+func EntryVisible(c *gin.Context, db *sql.DB, entryID int) (bool, error) {
+	_, role, _ := RetrieveUserIdAndRoleFromCookie(c, db)
+
+	var visible bool
+
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM entry
+			WHERE id = $1 AND archived_at IS NULL AND (hidden_at IS NULL OR $2)
+		)
+	`, entryID, IsModerator(role)).Scan(&visible)
+
+	return visible, err
+}
+
+// DistanceMeters converts a distance in miles, or kilometers when unit is km,
+// to meters.
+func DistanceMeters(distance float64, unit string) float64 {
+	if unit == "km" {
+		return distance * MetersPerKilometer
+	}
+
+	return distance * MetersPerMile
+}
+
 func InsertTagAndEntryRevisionAssociation(tx *sql.Tx, entryRevisionId int, tags []structs.Tag) error {
 	for _, tag := range tags {
 		var tagID int
@@ -210,3 +287,40 @@ func SetAuthCookie(
 		true,
 	)
 }
+
+// TextSimilarity returns the Jaccard similarity of the character trigrams of
+// two strings, between 0 and 1. Case and punctuation are ignored.
+func TextSimilarity(a string, b string) float64 {
+	trigramsA := trigrams(a)
+	trigramsB := trigrams(b)
+
+	if len(trigramsA) == 0 || len(trigramsB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for trigram := range trigramsA {
+		if _, ok := trigramsB[trigram]; ok {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(trigramsA)+len(trigramsB)-shared)
+}
+
+func trigrams(text string) map[string]struct{} {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	set := make(map[string]struct{})
+
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+
+	return set
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"math"
 	"strings"
 	"testing"
 
@@ -42,3 +43,20 @@ func TestParseTokenWithInvalidToken(t *testing.T) {
 		t.Fatalf("expected empty username, got %s", username)
 	}
 }
+
+func TestTextSimilarity(t *testing.T) {
+	if similarity := TextSimilarity("Maple Street Townhomes", "maple street townhomes!"); math.Abs(similarity-1) > 1e-9 {
+		t.Fatalf("expected identical text to have similarity 1, got %v", similarity)
+	}
+
+	related := TextSimilarity("Maple Street Townhomes", "Townhomes on Maple St")
+	unrelated := TextSimilarity("Maple Street Townhomes", "Downtown parking garage")
+
+	if related <= unrelated {
+		t.Fatalf("expected related titles to score higher, got %v <= %v", related, unrelated)
+	}
+
+	if similarity := TextSimilarity("", "anything"); similarity != 0 {
+		t.Fatalf("expected empty text to have similarity 0, got %v", similarity)
+	}
+}
@@ -0,0 +1,253 @@
+package views
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	data "backend/api/v1/data"
+	messages "backend/api/v1/messages"
+	utils "backend/api/v1/utils"
+)
+
+type viewKey struct {
+	EntryID   int
+	ViewerKey string
+	Day       string
+}
+
+const (
+	// FlushAt is how many views the buffer holds before it asks to be
+	// flushed early.
+	FlushAt = 10000
+
+	// MaxPending caps the buffer. Anonymous viewer keys come from the user
+	// agent, so a client can make up as many as it likes; past the cap new
+	// views are dropped until the next flush.
+	MaxPending = 4 * FlushAt
+)
+
+// Tracker buffers view events in memory so that opening an entry doesn't take
+// a row lock on it. Events are de-duplicated per viewer per day both in the
+// buffer and, on flush, against entry_view_events.
+type Tracker struct {
+	mu      sync.Mutex
+	pending map[viewKey]struct{}
+	full    chan struct{}
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		pending: make(map[viewKey]struct{}),
+		full:    make(chan struct{}, 1),
+	}
+}
+
+func (t *Tracker) Record(entryID int, viewerKey string, at time.Time) {
+	key := viewKey{
+		EntryID:   entryID,
+		ViewerKey: viewerKey,
+		Day:       at.UTC().Format("2006-01-02"),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.add(key)
+
+	if len(t.pending) >= FlushAt {
+		select {
+		case t.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// add buffers a view unless the buffer is at MaxPending. t.mu must be held.
+func (t *Tracker) add(key viewKey) {
+	if len(t.pending) >= MaxPending {
+		return
+	}
+
+	t.pending[key] = struct{}{}
+}
+
+// Full receives when the buffer reaches FlushAt, so it can be flushed before
+// the next tick.
+func (t *Tracker) Full() <-chan struct{} {
+	return t.full
+}
+
+func (t *Tracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.pending)
+}
+
+func (t *Tracker) drain() []viewKey {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := make([]viewKey, 0, len(t.pending))
+	for key := range t.pending {
+		keys = append(keys, key)
+	}
+
+	t.pending = make(map[viewKey]struct{})
+
+	return keys
+}
+
+// Flush writes the buffered views to Postgres. Views that were already
+// recorded for the same viewer on the same day are dropped, the rest are added
+// to entry.views and entry_views_daily. On failure the batch is put back into
+// the buffer so it is retried on the next flush.
+func (t *Tracker) Flush(db *sql.DB) error {
+	keys := t.drain()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	entryIDs := make([]int64, len(keys))
+	viewerKeys := make([]string, len(keys))
+	days := make([]string, len(keys))
+
+	for i, key := range keys {
+		entryIDs[i] = int64(key.EntryID)
+		viewerKeys[i] = key.ViewerKey
+		days[i] = key.Day
+	}
+
+	_, err := db.Exec(`
+		WITH inserted AS (
+			INSERT INTO entry_view_events (entry_id, viewer_key, day)
+			SELECT v.entry_id, v.viewer_key, v.day
+			FROM unnest($1::int[], $2::text[], $3::date[]) AS v(entry_id, viewer_key, day)
+			JOIN entry e ON e.id = v.entry_id
+			ON CONFLICT DO NOTHING
+			RETURNING entry_id, day
+		),
+		daily AS (
+			INSERT INTO entry_views_daily (entry_id, day, views)
+			SELECT entry_id, day, COUNT(*) FROM inserted GROUP BY entry_id, day
+			ON CONFLICT (entry_id, day) DO UPDATE
+			SET views = entry_views_daily.views + EXCLUDED.views
+		)
+		UPDATE entry
+		SET views = entry.views + i.views
+		FROM (
+			SELECT entry_id, COUNT(*) AS views FROM inserted GROUP BY entry_id
+		) i
+		WHERE entry.id = i.entry_id
+	`, pq.Array(entryIDs), pq.Array(viewerKeys), pq.Array(days))
+	if err != nil {
+		t.mu.Lock()
+		for _, key := range keys {
+			t.add(key)
+		}
+		t.mu.Unlock()
+
+		return err
+	}
+
+	_, err = db.Exec(`
+		DELETE FROM entry_view_events WHERE day < current_date - 1
+	`)
+
+	return err
+}
+
+// ViewerKey identifies who opened an entry. Signed in users are keyed by id,
+// anonymous visitors by a hash of their IP address and user agent so the raw
+// values are never stored.
+func ViewerKey(c *gin.Context, db *sql.DB) string {
+	if userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db); err == nil {
+		return "user:" + strconv.Itoa(userID)
+	}
+
+	fingerprint := sha256.Sum256([]byte(c.ClientIP() + "|" + c.Request.UserAgent()))
+
+	return "anon:" + hex.EncodeToString(fingerprint[:16])
+}
+
+func RetrieveEntryViews(c *gin.Context, db *sql.DB) {
+	entryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		messages.StatusBadRequest(c, errors.New("Invalid entry id"))
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		messages.StatusBadRequest(c, errors.New("days must be between 1 and 365"))
+		return
+	}
+
+	userID, role, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+	if err != nil {
+		messages.StatusUnauthorized(c, err)
+		return
+	}
+
+	var creatorID sql.NullInt64
+	var response data.EntryViewsResponse
+
+	err = db.QueryRow(`
+		SELECT id, creator_id, views FROM entry WHERE id = $1
+	`, entryID).Scan(&response.EntryID, &creatorID, &response.TotalViews)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			messages.StatusNotFound(c, errors.New("Entry not found"))
+			return
+		}
+
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	if int(creatorID.Int64) != userID && !utils.IsModerator(role) {
+		messages.StatusForbidden(c, errors.New("Only the creator can see view statistics for this entry"))
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT to_char(d.day, 'YYYY-MM-DD'), COALESCE(v.views, 0)
+		FROM generate_series(current_date - ($2::int - 1), current_date, interval '1 day') AS d(day)
+		LEFT JOIN entry_views_daily v ON v.entry_id = $1 AND v.day = d.day::date
+		ORDER BY d.day
+	`, entryID, days)
+	if err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	response.Daily = []data.DailyViews{}
+
+	for rows.Next() {
+		var daily data.DailyViews
+
+		if err := rows.Scan(&daily.Day, &daily.Views); err != nil {
+			messages.InternalServerError(c, err)
+			return
+		}
+
+		response.Daily = append(response.Daily, daily)
+	}
+
+	if err := rows.Err(); err != nil {
+		messages.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,60 @@
+package views
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRecordDeduplicatesPerViewerPerDay(t *testing.T) {
+	tracker := NewTracker()
+	morning := time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	tracker.Record(1, "user:7", morning)
+	tracker.Record(1, "user:7", morning.Add(6*time.Hour))
+
+	if tracker.Pending() != 1 {
+		t.Fatalf("expected 1 pending view, got %d", tracker.Pending())
+	}
+
+	tracker.Record(1, "user:7", morning.Add(24*time.Hour))
+	tracker.Record(1, "anon:abc", morning)
+	tracker.Record(2, "user:7", morning)
+
+	if tracker.Pending() != 4 {
+		t.Fatalf("expected 4 pending views, got %d", tracker.Pending())
+	}
+}
+
+func TestDrainEmptiesBuffer(t *testing.T) {
+	tracker := NewTracker()
+	tracker.Record(1, "user:7", time.Now())
+
+	keys := tracker.drain()
+
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 drained view, got %d", len(keys))
+	}
+	if tracker.Pending() != 0 {
+		t.Fatalf("expected empty buffer after drain, got %d", tracker.Pending())
+	}
+}
+
+func TestRecordCapsBuffer(t *testing.T) {
+	tracker := NewTracker()
+	day := time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)
+
+	for i := range MaxPending + 10 {
+		tracker.Record(1, "anon:"+strconv.Itoa(i), day)
+	}
+
+	if tracker.Pending() != MaxPending {
+		t.Fatalf("expected the buffer to stop at %d, got %d", MaxPending, tracker.Pending())
+	}
+
+	select {
+	case <-tracker.Full():
+	default:
+		t.Fatal("expected a full buffer to ask for a flush")
+	}
+}
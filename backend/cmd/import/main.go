@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	_ "github.com/lib/pq"
+
+	entry "backend/api/v1/entry"
+	importer "backend/api/v1/importer"
+)
+
+// Imports entries from a CSV or GeoJSON file and prints the report as JSON.
+//
+//	go run ./cmd/import -file permits.csv -mapping permits.yaml -dry-run
+func main() {
+	file := flag.String("file", "", "CSV or GeoJSON source file")
+	mappingPath := flag.String("mapping", "", "YAML mapping file")
+	format := flag.String("format", "", "source format, inferred from the file extension by default")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing anything")
+	flag.Parse()
+
+	if *file == "" || *mappingPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *format == "" {
+		*format = importer.FormatFromFilename(*file)
+	}
+
+	mappingContent, err := os.ReadFile(*mappingPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mapping, err := importer.ParseMapping(mappingContent, *format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	source, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer source.Close()
+
+	records, err := importer.Read(source, mapping)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	systemUserID, err := entry.RetrieveSystemUserID(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report, err := entry.ImportRecords(db, nil, records, systemUserID, *dryRun)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(report); encodeErr != nil {
+		log.Fatal(encodeErr)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -11,19 +18,33 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 
+	audit "backend/api/v1/audit"
+	comments "backend/api/v1/comments"
+	contributors "backend/api/v1/contributors"
 	entry "backend/api/v1/entry"
+	media "backend/api/v1/media"
 	messages "backend/api/v1/messages"
+	moderation "backend/api/v1/moderation"
+	notifications "backend/api/v1/notifications"
+	relations "backend/api/v1/relations"
+	search "backend/api/v1/search"
 	users "backend/api/v1/users"
 	utils "backend/api/v1/utils"
+	views "backend/api/v1/views"
 )
 
 var db *sql.DB
 
+var viewTracker = views.NewTracker()
+
+var mediaStorage media.Storage
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		cookie, err := c.Cookie("access_token")
 		if err != nil {
 			messages.StatusUnauthorized(c, err)
+			c.Abort()
 			return
 		}
 
@@ -33,7 +54,28 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		if err != nil || !token.Valid {
 			log.Printf("Invalid token: %v", err)
+			messages.StatusUnauthorized(c, errors.New("Invalid token"))
+			c.Abort()
+			return
+		}
+
+		userID, _, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+		if err != nil {
 			messages.StatusUnauthorized(c, err)
+			c.Abort()
+			return
+		}
+
+		suspension, err := users.RetrieveActiveSuspension(db, userID)
+		if err != nil {
+			messages.InternalServerError(c, err)
+			c.Abort()
+			return
+		}
+
+		if suspension != nil {
+			users.StatusSuspended(c, suspension)
+			c.Abort()
 			return
 		}
 
@@ -41,22 +83,122 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+func ModeratorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, role, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+		if err != nil {
+			messages.StatusUnauthorized(c, err)
+			c.Abort()
+			return
+		}
+
+		if !utils.IsModerator(role) {
+			messages.StatusForbidden(c, errors.New("Moderator privileges required"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, role, err := utils.RetrieveUserIdAndRoleFromCookie(c, db)
+		if err != nil {
+			messages.StatusUnauthorized(c, err)
+			c.Abort()
+			return
+		}
+
+		if !utils.IsAdmin(role) {
+			messages.StatusForbidden(c, errors.New("Admin privileges required"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func purgeArchivedEntries() {
+	retentionDays, err := strconv.Atoi(os.Getenv("ARCHIVE_RETENTION_DAYS"))
+	if err != nil || retentionDays <= 0 {
+		retentionDays = 30
+	}
+
+	retention := time.Duration(retentionDays) * 24 * time.Hour
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := entry.PurgeArchivedEntries(db, retention)
+		if err != nil {
+			log.Printf("Failed to purge archived entries: %v", err)
+			continue
+		}
+
+		if purged > 0 {
+			log.Printf("Purged %d archived entries", purged)
+		}
+
+		if err := media.PurgeOrphanedMedia(db, mediaStorage); err != nil {
+			log.Printf("Failed to purge orphaned media: %v", err)
+		}
+	}
+}
+
+func flushEntryViews() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-viewTracker.Full():
+		}
+
+		if err := viewTracker.Flush(db); err != nil {
+			log.Printf("Failed to flush entry views: %v", err)
+		}
+	}
+}
+
 func handleRequests() {
 	r := gin.Default()
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", audit.RequestIDHeader},
+		ExposeHeaders:    []string{audit.RequestIDHeader, entry.DeprecationHeader},
 		AllowCredentials: true,
 	}))
 
+	r.Use(audit.RequestID())
+
 	userRoutes := r.Group("/users")
 	userRoutesPrivileged := r.Group("/users")
 	userRoutesPrivileged.Use(AuthMiddleware())
+	userModeratorRoutes := r.Group("/users")
+	userModeratorRoutes.Use(AuthMiddleware(), ModeratorMiddleware())
 	entryRoutes := r.Group("/entries")
 	entryPrivilegedRoutes := r.Group("/entries")
 	entryPrivilegedRoutes.Use(AuthMiddleware())
+	entryModeratorRoutes := r.Group("/entries")
+	entryModeratorRoutes.Use(AuthMiddleware(), ModeratorMiddleware())
+	entryAdminRoutes := r.Group("/entries")
+	entryAdminRoutes.Use(AuthMiddleware(), AdminMiddleware())
+	moderationPrivilegedRoutes := r.Group("/moderation")
+	moderationPrivilegedRoutes.Use(AuthMiddleware())
+	moderationModeratorRoutes := r.Group("/moderation")
+	moderationModeratorRoutes.Use(AuthMiddleware(), ModeratorMiddleware())
+	commentRoutes := r.Group("/comments")
+	commentPrivilegedRoutes := r.Group("/comments")
+	commentPrivilegedRoutes.Use(AuthMiddleware())
+	auditAdminRoutes := r.Group("/audit")
+	auditAdminRoutes.Use(AuthMiddleware(), AdminMiddleware())
 
 	userRoutes.POST("/create-user", func(c *gin.Context) {
 		users.CreateUser(c, db)
@@ -66,10 +208,52 @@ func handleRequests() {
 		users.LoginUser(c, db)
 	})
 
-	userRoutes.POST("/refresh-token", users.RefreshToken)
+	userRoutes.POST("/refresh-token", func(c *gin.Context) {
+		users.RefreshToken(c, db)
+	})
 
 	userRoutesPrivileged.GET("/me", users.Me)
 
+	userRoutesPrivileged.GET("/notifications", func(c *gin.Context) {
+		notifications.RetrieveNotifications(c, db)
+	})
+
+	userRoutesPrivileged.POST("/notifications/read", func(c *gin.Context) {
+		notifications.MarkNotificationsRead(c, db)
+	})
+
+	userRoutesPrivileged.GET("/home-location", func(c *gin.Context) {
+		users.GetHomeLocation(c, db)
+	})
+
+	userRoutesPrivileged.PUT("/home-location", func(c *gin.Context) {
+		users.SetHomeLocation(c, db)
+	})
+
+	userRoutesPrivileged.DELETE("/home-location", func(c *gin.Context) {
+		users.ClearHomeLocation(c, db)
+	})
+
+	userRoutesPrivileged.PUT("/gravatar", func(c *gin.Context) {
+		users.ShowGravatar(c, db)
+	})
+
+	userRoutesPrivileged.DELETE("/gravatar", func(c *gin.Context) {
+		users.HideGravatar(c, db)
+	})
+
+	userModeratorRoutes.GET("/:id/suspensions", func(c *gin.Context) {
+		users.RetrieveUserSuspensions(c, db)
+	})
+
+	userModeratorRoutes.POST("/:id/suspend", func(c *gin.Context) {
+		users.SuspendUser(c, db)
+	})
+
+	userModeratorRoutes.DELETE("/:id/suspend", func(c *gin.Context) {
+		users.LiftSuspension(c, db)
+	})
+
 	entryRoutes.POST("/retrieve-entries-within-visible-bounds", func(c *gin.Context) {
 		entry.RetrieveEntriesWithinVisibleBounds(c, db)
 	})
@@ -82,10 +266,62 @@ func handleRequests() {
 		entry.RetrieveFeed(c, db)
 	})
 
+	entryRoutes.GET("/export", func(c *gin.Context) {
+		entry.ExportEntries(c, db)
+	})
+
+	entryRoutes.GET("/timeline-stats", func(c *gin.Context) {
+		entry.RetrieveTimelineStats(c, db)
+	})
+
+	entryRoutes.GET("/search", func(c *gin.Context) {
+		search.SearchEntries(c, db)
+	})
+
+	entryRoutes.GET("/:id", func(c *gin.Context) {
+		entry.RetrieveEntry(c, db, viewTracker, mediaStorage)
+	})
+
+	entryRoutes.GET("/:id/timeline", func(c *gin.Context) {
+		entry.RetrieveEntryTimeline(c, db)
+	})
+
+	entryRoutes.GET("/:id/revisions", func(c *gin.Context) {
+		entry.RetrieveRevisions(c, db)
+	})
+
+	entryRoutes.GET("/:id/revisions/diff", func(c *gin.Context) {
+		entry.RetrieveRevisionDiff(c, db)
+	})
+
+	entryRoutes.GET("/:id/contributors", func(c *gin.Context) {
+		contributors.RetrieveEntryContributors(c, db)
+	})
+
+	entryRoutes.GET("/:id/media", func(c *gin.Context) {
+		media.RetrieveEntryMedia(c, db, mediaStorage)
+	})
+
+	entryRoutes.GET("/:id/relations", func(c *gin.Context) {
+		relations.RetrieveEntryRelations(c, db)
+	})
+
+	entryRoutes.GET("/:id/relations/graph", func(c *gin.Context) {
+		relations.RetrieveRelationGraph(c, db)
+	})
+
+	entryRoutes.GET("/:id/relations/history", func(c *gin.Context) {
+		relations.RetrieveRelationHistory(c, db)
+	})
+
 	entryPrivilegedRoutes.POST("/create-entry", func(c *gin.Context) {
 		entry.CreateEntry(c, db)
 	})
 
+	entryPrivilegedRoutes.POST("/propose-from-photo", func(c *gin.Context) {
+		entry.ProposeEntryFromPhoto(c, db, mediaStorage)
+	})
+
 	entryPrivilegedRoutes.GET("/autocomplete-address", func(c *gin.Context) {
 		entry.AutocompleteAddress(c, db)
 	})
@@ -98,7 +334,166 @@ func handleRequests() {
 		entry.EditEntry(c, db)
 	})
 
-	r.Run()
+	entryPrivilegedRoutes.POST("/:id/archive", func(c *gin.Context) {
+		entry.ArchiveEntry(c, db)
+	})
+
+	entryPrivilegedRoutes.GET("/watchlist", func(c *gin.Context) {
+		notifications.RetrieveWatchlist(c, db)
+	})
+
+	entryPrivilegedRoutes.POST("/:id/watch", func(c *gin.Context) {
+		notifications.WatchEntry(c, db)
+	})
+
+	entryPrivilegedRoutes.DELETE("/:id/watch", func(c *gin.Context) {
+		notifications.UnwatchEntry(c, db)
+	})
+
+	entryPrivilegedRoutes.POST("/:id/media", func(c *gin.Context) {
+		media.UploadEntryMedia(c, db, mediaStorage)
+	})
+
+	entryPrivilegedRoutes.POST("/:id/relations", func(c *gin.Context) {
+		relations.AddRelation(c, db)
+	})
+
+	entryPrivilegedRoutes.DELETE("/relations/:relationId", func(c *gin.Context) {
+		relations.RemoveRelation(c, db)
+	})
+
+	entryPrivilegedRoutes.GET("/:id/views", func(c *gin.Context) {
+		views.RetrieveEntryViews(c, db)
+	})
+
+	entryModeratorRoutes.POST("/:id/restore", func(c *gin.Context) {
+		entry.RestoreEntry(c, db)
+	})
+
+	entryModeratorRoutes.POST("/:id/merge", func(c *gin.Context) {
+		entry.MergeEntry(c, db)
+	})
+
+	entryModeratorRoutes.POST("/:id/lock", func(c *gin.Context) {
+		entry.LockEntry(c, db)
+	})
+
+	entryModeratorRoutes.DELETE("/:id/lock", func(c *gin.Context) {
+		entry.UnlockEntry(c, db)
+	})
+
+	entryModeratorRoutes.POST("/revisions/:revisionId/hide", func(c *gin.Context) {
+		entry.HideRevision(c, db)
+	})
+
+	entryModeratorRoutes.DELETE("/revisions/:revisionId/hide", func(c *gin.Context) {
+		entry.UnhideRevision(c, db)
+	})
+
+	entryModeratorRoutes.GET("/relations/pending", func(c *gin.Context) {
+		relations.RetrievePendingRelations(c, db)
+	})
+
+	entryModeratorRoutes.POST("/relations/:relationId/approve", func(c *gin.Context) {
+		relations.ReviewRelation(c, db, true)
+	})
+
+	entryModeratorRoutes.POST("/relations/:relationId/reject", func(c *gin.Context) {
+		relations.ReviewRelation(c, db, false)
+	})
+
+	entryModeratorRoutes.POST("/relations/history/:historyId/revert", func(c *gin.Context) {
+		relations.RevertRelationChange(c, db)
+	})
+
+	entryAdminRoutes.POST("/import", func(c *gin.Context) {
+		entry.ImportEntries(c, db)
+	})
+
+	commentRoutes.GET("/entry-comments", func(c *gin.Context) {
+		comments.GetEntryComments(c, db)
+	})
+
+	commentRoutes.GET("/replies", func(c *gin.Context) {
+		comments.GetCommentReplies(c, db)
+	})
+
+	commentRoutes.GET("/search", func(c *gin.Context) {
+		search.SearchDiscussions(c, db)
+	})
+
+	commentPrivilegedRoutes.POST("/add-comment", func(c *gin.Context) {
+		comments.AddComment(c, db)
+	})
+
+	commentPrivilegedRoutes.POST("/vote-comment", func(c *gin.Context) {
+		comments.VoteOnComment(c, db)
+	})
+
+	moderationPrivilegedRoutes.POST("/flags", func(c *gin.Context) {
+		moderation.FlagContent(c, db)
+	})
+
+	moderationModeratorRoutes.GET("/queue", func(c *gin.Context) {
+		moderation.RetrieveQueue(c, db)
+	})
+
+	moderationModeratorRoutes.POST("/queue/:targetType/:targetId/claim", func(c *gin.Context) {
+		moderation.ClaimTarget(c, db)
+	})
+
+	moderationModeratorRoutes.POST("/queue/:targetType/:targetId/resolve", func(c *gin.Context) {
+		moderation.ResolveTarget(c, db)
+	})
+
+	moderationModeratorRoutes.DELETE("/hidden/:targetType/:targetId", func(c *gin.Context) {
+		moderation.UnhideTarget(c, db)
+	})
+
+	auditAdminRoutes.GET("", func(c *gin.Context) {
+		audit.RetrieveLog(c, db)
+	})
+
+	auditAdminRoutes.GET("/verify", func(c *gin.Context) {
+		audit.VerifyLog(c, db)
+	})
+
+	r.GET("/media/*key", func(c *gin.Context) {
+		media.ServeMedia(c, mediaStorage)
+	})
+
+	srv := &http.Server{Addr: ":" + port(), Handler: r}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to serve: %v", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Failed to shut down cleanly: %v", err)
+	}
+
+	// views still in the buffer would otherwise be lost
+	if err := viewTracker.Flush(db); err != nil {
+		log.Printf("Failed to flush entry views: %v", err)
+	}
+}
+
+// port is the port gin's Run would have listened on.
+func port() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return port
+	}
+
+	return "8080"
 }
 
 func main() {
@@ -116,5 +511,13 @@ func main() {
 	}
 	defer db.Close()
 
+	mediaStorage, err = media.NewStorageFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to set up media storage: %v", err)
+	}
+
+	go purgeArchivedEntries()
+	go flushEntryViews()
+
 	handleRequests()
 }
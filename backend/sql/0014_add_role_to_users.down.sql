@@ -0,0 +1,3 @@
+--- down
+
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,5 @@
+--- up
+
+ALTER TABLE users
+ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user'
+CHECK (role IN ('user', 'trusted', 'moderator', 'admin'));
@@ -0,0 +1,13 @@
+--- down
+
+ALTER TABLE entry_contributors DROP CONSTRAINT entry_contributors_entry_id_fkey;
+
+ALTER TABLE entry_contributors
+  ADD CONSTRAINT entry_contributors_entry_id_fkey
+    FOREIGN KEY (entry_id) REFERENCES entry(id);
+
+DROP INDEX IF EXISTS entry_archived_at_idx;
+
+ALTER TABLE entry DROP COLUMN archive_reason;
+ALTER TABLE entry DROP COLUMN archived_by;
+ALTER TABLE entry DROP COLUMN archived_at;
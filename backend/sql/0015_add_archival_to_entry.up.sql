@@ -0,0 +1,14 @@
+--- up
+
+ALTER TABLE entry ADD COLUMN archived_at TIMESTAMP;
+ALTER TABLE entry ADD COLUMN archived_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE entry ADD COLUMN archive_reason TEXT;
+
+CREATE INDEX entry_archived_at_idx ON entry (archived_at);
+
+--- purging an archived entry is a hard delete, so contributors have to go with it
+ALTER TABLE entry_contributors DROP CONSTRAINT entry_contributors_entry_id_fkey;
+
+ALTER TABLE entry_contributors
+  ADD CONSTRAINT entry_contributors_entry_id_fkey
+    FOREIGN KEY (entry_id) REFERENCES entry(id) ON DELETE CASCADE;
@@ -0,0 +1,4 @@
+--- down
+
+DROP TABLE entry_views_daily;
+DROP TABLE entry_view_events;
@@ -0,0 +1,17 @@
+--- up
+
+CREATE TABLE entry_view_events (
+    entry_id INTEGER NOT NULL,
+    viewer_key VARCHAR(80) NOT NULL,
+    day DATE NOT NULL,
+    PRIMARY KEY (entry_id, viewer_key, day),
+    FOREIGN KEY (entry_id) REFERENCES entry(id) ON DELETE CASCADE
+);
+
+CREATE TABLE entry_views_daily (
+    entry_id INTEGER NOT NULL,
+    day DATE NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (entry_id, day),
+    FOREIGN KEY (entry_id) REFERENCES entry(id) ON DELETE CASCADE
+);
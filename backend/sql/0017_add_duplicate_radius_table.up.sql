@@ -0,0 +1,12 @@
+--- up
+
+CREATE TABLE duplicate_radius (
+    zoning VARCHAR(50) PRIMARY KEY,
+    radius_meters INTEGER NOT NULL CHECK (radius_meters > 0)
+);
+
+INSERT INTO duplicate_radius (zoning, radius_meters) VALUES
+    ('Single Family', 30),
+    ('Multi Family', 50),
+    ('Commercial', 75),
+    ('Industrial', 100);
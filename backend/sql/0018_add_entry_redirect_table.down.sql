@@ -0,0 +1,3 @@
+--- down
+
+DROP TABLE entry_redirect;
@@ -0,0 +1,12 @@
+--- up
+
+--- from_entry_id is deliberately not a foreign key, the merged entry is deleted
+--- but its id has to keep resolving to the entry it was folded into
+CREATE TABLE entry_redirect (
+    from_entry_id INTEGER PRIMARY KEY,
+    to_entry_id INTEGER NOT NULL,
+    merged_by INTEGER,
+    date_created TIMESTAMP DEFAULT now(),
+    FOREIGN KEY (to_entry_id) REFERENCES entry(id) ON DELETE CASCADE,
+    FOREIGN KEY (merged_by) REFERENCES users(id) ON DELETE SET NULL
+);
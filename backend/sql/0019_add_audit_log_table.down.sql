@@ -0,0 +1,3 @@
+--- down
+
+DROP TABLE audit_log;
@@ -0,0 +1,14 @@
+--- up
+
+CREATE TABLE audit_log (
+    id SERIAL PRIMARY KEY,
+    actor_id INTEGER,
+    action VARCHAR(50) NOT NULL,
+    target_type VARCHAR(30) NOT NULL,
+    target_id INTEGER NOT NULL,
+    details JSONB,
+    date_created TIMESTAMP DEFAULT now(),
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX audit_log_target_idx ON audit_log (target_type, target_id);
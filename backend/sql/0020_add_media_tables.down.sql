@@ -0,0 +1,4 @@
+--- down
+
+DROP TABLE entry_revision_media;
+DROP TABLE media;
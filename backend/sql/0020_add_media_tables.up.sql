@@ -0,0 +1,28 @@
+--- up
+
+--- entry_id is set to NULL when an entry is purged so the files can be
+--- cleaned out of storage before the rows are removed
+CREATE TABLE media (
+    id SERIAL PRIMARY KEY,
+    entry_id INTEGER,
+    uploader_id INTEGER,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    thumbnail_key VARCHAR(255),
+    mime_type VARCHAR(100) NOT NULL,
+    size_bytes INTEGER NOT NULL,
+    width INTEGER,
+    height INTEGER,
+    original_filename VARCHAR(255),
+    date_created TIMESTAMP DEFAULT now(),
+    FOREIGN KEY (entry_id) REFERENCES entry(id) ON DELETE SET NULL,
+    FOREIGN KEY (uploader_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE entry_revision_media (
+    entry_revision_id INTEGER,
+    media_id INTEGER,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (entry_revision_id, media_id),
+    FOREIGN KEY (entry_revision_id) REFERENCES entry_revision(id) ON DELETE CASCADE,
+    FOREIGN KEY (media_id) REFERENCES media(id) ON DELETE CASCADE
+);
@@ -0,0 +1,16 @@
+--- up
+
+CREATE TABLE entry_revision_attributes (
+    entry_revision_id INTEGER PRIMARY KEY,
+    permit_numbers TEXT[],
+    developer VARCHAR(255),
+    units INTEGER,
+    square_footage INTEGER,
+    parcel_id VARCHAR(50),
+    estimated_completion DATE,
+    estimated_cost NUMERIC(14, 2),
+    FOREIGN KEY (entry_revision_id) REFERENCES entry_revision(id) ON DELETE CASCADE
+);
+
+CREATE INDEX entry_revision_attributes_permit_numbers_idx
+    ON entry_revision_attributes USING GIN (permit_numbers);
@@ -0,0 +1,6 @@
+--- down
+
+DROP INDEX IF EXISTS entry_contributors_entry_id_idx;
+
+ALTER TABLE entry_contributors DROP COLUMN last_contributed_at;
+ALTER TABLE entry_contributors DROP COLUMN contribution_count;
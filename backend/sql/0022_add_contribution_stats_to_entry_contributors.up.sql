@@ -0,0 +1,20 @@
+--- up
+
+ALTER TABLE entry_contributors ADD COLUMN contribution_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE entry_contributors ADD COLUMN last_contributed_at TIMESTAMP NOT NULL DEFAULT now();
+
+CREATE INDEX entry_contributors_entry_id_idx ON entry_contributors (entry_id);
+
+--- credit everyone who already wrote a revision or an update/source comment
+INSERT INTO entry_contributors (entry_id, user_id, contribution_count, last_contributed_at)
+SELECT entry_id, user_id, COUNT(*), COALESCE(MAX(date_created), now())
+FROM (
+  SELECT entry_id, creator_id AS user_id, date_created FROM entry_revision
+  UNION ALL
+  SELECT entry_id, user_id, now() FROM conversation
+  WHERE type IN ('update', 'source') AND entry_id IS NOT NULL AND user_id IS NOT NULL
+) contributions
+GROUP BY entry_id, user_id
+ON CONFLICT (user_id, entry_id) DO UPDATE
+SET contribution_count = EXCLUDED.contribution_count,
+    last_contributed_at = EXCLUDED.last_contributed_at;
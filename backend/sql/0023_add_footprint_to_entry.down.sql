@@ -0,0 +1,6 @@
+--- down
+
+DROP INDEX IF EXISTS entry_footprint_idx;
+
+ALTER TABLE entry DROP COLUMN footprint;
+ALTER TABLE entry_revision DROP COLUMN footprint;
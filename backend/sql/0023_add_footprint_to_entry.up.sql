@@ -0,0 +1,8 @@
+--- up
+
+--- every revision keeps the footprint it was submitted with; entry.footprint
+--- mirrors the latest one so spatial queries don't have to go through revisions
+ALTER TABLE entry_revision ADD COLUMN footprint GEOGRAPHY(MultiPolygon, 4326);
+ALTER TABLE entry ADD COLUMN footprint GEOGRAPHY(MultiPolygon, 4326);
+
+CREATE INDEX entry_footprint_idx ON entry USING GIST (footprint);
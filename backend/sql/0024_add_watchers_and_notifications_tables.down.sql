@@ -0,0 +1,4 @@
+--- down
+
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS entry_watchers;
@@ -0,0 +1,33 @@
+--- up
+
+CREATE TABLE entry_watchers (
+    entry_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    date_created TIMESTAMP DEFAULT now(),
+    PRIMARY KEY (user_id, entry_id),
+    FOREIGN KEY (entry_id) REFERENCES entry(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX entry_watchers_entry_id_idx ON entry_watchers (entry_id);
+
+--- creators watch their own entries
+INSERT INTO entry_watchers (entry_id, user_id)
+SELECT id, creator_id FROM entry
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    entry_id INTEGER,
+    actor_id INTEGER,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('revision', 'comment', 'progress')),
+    details JSONB,
+    read_at TIMESTAMP,
+    date_created TIMESTAMP DEFAULT now(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (entry_id) REFERENCES entry(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, date_created DESC);
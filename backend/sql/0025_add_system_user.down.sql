@@ -0,0 +1,19 @@
+--- down
+
+-- Entries and revisions cascade with their creator, so refuse to roll back
+-- rather than delete everything that was imported.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM entry e JOIN users u ON u.id = e.creator_id
+        WHERE u.username = 'system' AND u.password = '!'
+    ) OR EXISTS (
+        SELECT 1 FROM entry_revision er JOIN users u ON u.id = er.creator_id
+        WHERE u.username = 'system' AND u.password = '!'
+    ) THEN
+        RAISE EXCEPTION 'the system user owns imported entries, reassign or delete them first';
+    END IF;
+END
+$$;
+
+DELETE FROM users WHERE username = 'system' AND password = '!';
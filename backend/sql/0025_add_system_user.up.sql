@@ -0,0 +1,7 @@
+--- up
+
+-- Bulk imports are attributed to this account. The password is not a valid
+-- bcrypt hash, so nobody can log in as it.
+INSERT INTO users (username, first_name, last_name, password, email, phone_number, role)
+VALUES ('system', 'System', 'Import', '!', 'system@localhost', '+10000000000', 'trusted')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+--- down
+
+DROP TABLE IF EXISTS entry_relation_history;
+DROP TABLE IF EXISTS entry_relations;
@@ -0,0 +1,45 @@
+--- up
+
+-- Symmetric relation types are stored with from_entry_id < to_entry_id so a
+-- pair can only be linked once per type.
+CREATE TABLE entry_relations (
+    id SERIAL PRIMARY KEY,
+    from_entry_id INTEGER NOT NULL,
+    to_entry_id INTEGER NOT NULL,
+    type VARCHAR(30) NOT NULL
+        CHECK (type IN ('phase_of', 'replaces', 'same_developer', 'adjacent_to')),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'rejected', 'removed')),
+    proposed_by INTEGER,
+    reviewed_by INTEGER,
+    date_created TIMESTAMP DEFAULT now(),
+    date_reviewed TIMESTAMP,
+    CHECK (from_entry_id <> to_entry_id),
+    FOREIGN KEY (from_entry_id) REFERENCES entry(id) ON DELETE CASCADE,
+    FOREIGN KEY (to_entry_id) REFERENCES entry(id) ON DELETE CASCADE,
+    FOREIGN KEY (proposed_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (reviewed_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX entry_relations_active_idx ON entry_relations (from_entry_id, to_entry_id, type)
+WHERE status IN ('pending', 'approved');
+
+CREATE INDEX entry_relations_to_entry_idx ON entry_relations (to_entry_id);
+
+-- Every status change of a relation, so changes can be audited and reverted.
+CREATE TABLE entry_relation_history (
+    id SERIAL PRIMARY KEY,
+    relation_id INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL
+        CHECK (action IN ('proposed', 'approved', 'rejected', 'removed', 'reverted')),
+    status_from VARCHAR(20),
+    status_to VARCHAR(20) NOT NULL,
+    actor_id INTEGER,
+    reverts_id INTEGER,
+    date_created TIMESTAMP DEFAULT now(),
+    FOREIGN KEY (relation_id) REFERENCES entry_relations(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (reverts_id) REFERENCES entry_relation_history(id) ON DELETE SET NULL
+);
+
+CREATE INDEX entry_relation_history_relation_idx ON entry_relation_history (relation_id);
@@ -0,0 +1,14 @@
+--- down
+
+DROP TABLE IF EXISTS user_suspensions;
+DROP TABLE IF EXISTS flags;
+
+ALTER TABLE conversation
+DROP COLUMN IF EXISTS hidden_reason,
+DROP COLUMN IF EXISTS hidden_by,
+DROP COLUMN IF EXISTS hidden_at;
+
+ALTER TABLE entry
+DROP COLUMN IF EXISTS hidden_reason,
+DROP COLUMN IF EXISTS hidden_by,
+DROP COLUMN IF EXISTS hidden_at;
@@ -0,0 +1,59 @@
+--- up
+
+ALTER TABLE entry
+ADD COLUMN hidden_at TIMESTAMP,
+ADD COLUMN hidden_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN hidden_reason TEXT;
+
+ALTER TABLE conversation
+ADD COLUMN hidden_at TIMESTAMP,
+ADD COLUMN hidden_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN hidden_reason TEXT;
+
+-- target_id points at entry, entry_revision or conversation depending on
+-- target_type; entry_id is the entry the target belongs to so flags go away
+-- with it.
+CREATE TABLE flags (
+    id SERIAL PRIMARY KEY,
+    target_type VARCHAR(20) NOT NULL CHECK (target_type IN ('entry', 'revision', 'comment')),
+    target_id INTEGER NOT NULL,
+    entry_id INTEGER NOT NULL,
+    reporter_id INTEGER NOT NULL,
+    reason VARCHAR(20) NOT NULL
+        CHECK (reason IN ('spam', 'inaccurate', 'harassment', 'private_info')),
+    details TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+    claimed_by INTEGER,
+    claimed_at TIMESTAMP,
+    resolution VARCHAR(20) CHECK (resolution IN ('dismiss', 'hide', 'revert', 'suspend')),
+    resolution_reason TEXT,
+    resolved_by INTEGER,
+    resolved_at TIMESTAMP,
+    date_created TIMESTAMP DEFAULT now(),
+    FOREIGN KEY (entry_id) REFERENCES entry(id) ON DELETE CASCADE,
+    FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (claimed_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (resolved_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX flags_open_reporter_idx ON flags (target_type, target_id, reporter_id)
+WHERE status = 'open';
+
+CREATE INDEX flags_open_target_idx ON flags (target_type, target_id) WHERE status = 'open';
+
+-- ends_at NULL is a permanent ban.
+CREATE TABLE user_suspensions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    suspended_by INTEGER,
+    ends_at TIMESTAMP,
+    lifted_at TIMESTAMP,
+    lifted_by INTEGER,
+    date_created TIMESTAMP DEFAULT now(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (suspended_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (lifted_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX user_suspensions_user_idx ON user_suspensions (user_id);
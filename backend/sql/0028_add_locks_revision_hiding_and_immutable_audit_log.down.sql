@@ -0,0 +1,19 @@
+--- down
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+DROP FUNCTION IF EXISTS audit_log_immutable();
+
+ALTER TABLE audit_log
+ADD CONSTRAINT audit_log_actor_id_fkey FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+NOT VALID;
+
+ALTER TABLE entry_revision
+DROP COLUMN IF EXISTS hidden_reason,
+DROP COLUMN IF EXISTS hidden_by,
+DROP COLUMN IF EXISTS hidden_at;
+
+ALTER TABLE entry
+DROP COLUMN IF EXISTS lock_reason,
+DROP COLUMN IF EXISTS locked_by,
+DROP COLUMN IF EXISTS locked_at;
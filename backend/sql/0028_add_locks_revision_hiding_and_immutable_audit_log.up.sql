@@ -0,0 +1,29 @@
+--- up
+
+ALTER TABLE entry
+ADD COLUMN locked_at TIMESTAMP,
+ADD COLUMN locked_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN lock_reason TEXT;
+
+ALTER TABLE entry_revision
+ADD COLUMN hidden_at TIMESTAMP,
+ADD COLUMN hidden_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN hidden_reason TEXT;
+
+-- The audit log is append-only. actor_id keeps the id of deleted users
+-- rather than being nulled, which would be an update.
+ALTER TABLE audit_log DROP CONSTRAINT IF EXISTS audit_log_actor_id_fkey;
+
+CREATE FUNCTION audit_log_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION audit_log_immutable();
+
+CREATE TRIGGER audit_log_no_truncate
+BEFORE TRUNCATE ON audit_log
+FOR EACH STATEMENT EXECUTE FUNCTION audit_log_immutable();
@@ -0,0 +1,16 @@
+--- down
+
+DROP INDEX IF EXISTS audit_log_request_idx;
+DROP INDEX IF EXISTS audit_log_date_created_idx;
+DROP INDEX IF EXISTS audit_log_action_idx;
+DROP INDEX IF EXISTS audit_log_actor_idx;
+DROP INDEX IF EXISTS audit_log_hash_idx;
+
+ALTER TABLE audit_log
+DROP COLUMN IF EXISTS hash,
+DROP COLUMN IF EXISTS prev_hash,
+DROP COLUMN IF EXISTS request_id,
+DROP COLUMN IF EXISTS user_agent,
+DROP COLUMN IF EXISTS ip_address,
+DROP COLUMN IF EXISTS after_state,
+DROP COLUMN IF EXISTS before_state;
@@ -0,0 +1,17 @@
+--- up
+
+-- Rows written before the hash chain have no hash and are left out of it.
+ALTER TABLE audit_log
+ADD COLUMN before_state JSONB,
+ADD COLUMN after_state JSONB,
+ADD COLUMN ip_address VARCHAR(45),
+ADD COLUMN user_agent TEXT,
+ADD COLUMN request_id VARCHAR(64),
+ADD COLUMN prev_hash CHAR(64),
+ADD COLUMN hash CHAR(64);
+
+CREATE UNIQUE INDEX audit_log_hash_idx ON audit_log (hash);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor_id, date_created);
+CREATE INDEX audit_log_action_idx ON audit_log (action, date_created);
+CREATE INDEX audit_log_date_created_idx ON audit_log (date_created);
+CREATE INDEX audit_log_request_idx ON audit_log (request_id);
@@ -0,0 +1,5 @@
+--- down
+
+DROP INDEX IF EXISTS conversation_entry_id_idx;
+DROP INDEX IF EXISTS entry_interactions_entry_idx;
+DROP INDEX IF EXISTS entry_date_created_idx;
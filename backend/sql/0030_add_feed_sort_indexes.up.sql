@@ -0,0 +1,5 @@
+--- up
+
+CREATE INDEX entry_date_created_idx ON entry (date_created DESC, id DESC);
+CREATE INDEX entry_interactions_entry_idx ON entry_interactions (entry_id, created_at);
+CREATE INDEX conversation_entry_id_idx ON conversation (entry_id);
@@ -0,0 +1,5 @@
+--- down
+
+DROP INDEX IF EXISTS entry_search_document_idx;
+DROP FUNCTION IF EXISTS entry_search_document(INTEGER);
+ALTER TABLE entry DROP COLUMN IF EXISTS search_document;
@@ -0,0 +1,30 @@
+--- up
+
+ALTER TABLE entry ADD COLUMN search_document tsvector;
+
+-- The search document of an entry: its latest revision's title, then the
+-- tag names, the address and the content, weighted in that order.
+CREATE FUNCTION entry_search_document(target_id INTEGER) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('english', COALESCE(er.title, '')), 'A')
+        || setweight(to_tsvector('english', COALESCE((
+            SELECT string_agg(t.name, ' ')
+            FROM tags_entry_revision ter
+            JOIN tags t ON t.id = ter.tag_id
+            WHERE ter.entry_revision_id = er.id
+        ), '')), 'B')
+        || setweight(to_tsvector('english', COALESCE(e.address, '')), 'C')
+        || setweight(to_tsvector('english', COALESCE(er.content, '')), 'D')
+    FROM entry e
+    JOIN LATERAL (
+        SELECT id, title, content
+        FROM entry_revision
+        WHERE entry_id = e.id
+        ORDER BY revision_number DESC
+        LIMIT 1
+    ) er ON true
+    WHERE e.id = target_id;
+$$ LANGUAGE sql STABLE;
+
+UPDATE entry SET search_document = entry_search_document(id);
+
+CREATE INDEX entry_search_document_idx ON entry USING GIN (search_document);
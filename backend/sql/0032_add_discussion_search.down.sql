@@ -0,0 +1,6 @@
+--- down
+
+DROP INDEX IF EXISTS conversation_user_id_idx;
+DROP INDEX IF EXISTS conversation_search_document_idx;
+ALTER TABLE conversation DROP COLUMN IF EXISTS search_document;
+ALTER TABLE conversation DROP COLUMN IF EXISTS date_created;
@@ -0,0 +1,14 @@
+--- up
+
+-- Comments had no timestamp. Existing ones stay NULL rather than all
+-- claiming to be from today.
+ALTER TABLE conversation ADD COLUMN date_created TIMESTAMP;
+ALTER TABLE conversation ALTER COLUMN date_created SET DEFAULT now();
+
+-- Generated, so it follows context through inserts and edits on its own.
+ALTER TABLE conversation
+ADD COLUMN search_document tsvector
+GENERATED ALWAYS AS (to_tsvector('english', COALESCE(context, ''))) STORED;
+
+CREATE INDEX conversation_search_document_idx ON conversation USING GIN (search_document);
+CREATE INDEX conversation_user_id_idx ON conversation (user_id);
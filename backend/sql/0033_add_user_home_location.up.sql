@@ -0,0 +1,3 @@
+--- up
+
+ALTER TABLE users ADD COLUMN home_location GEOGRAPHY(Point, 4326);
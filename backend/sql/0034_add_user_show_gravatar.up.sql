@@ -0,0 +1,5 @@
+--- up
+
+-- Gravatar URLs carry a hash of the email address, so contributors only get
+-- one when they ask for it.
+ALTER TABLE users ADD COLUMN show_gravatar BOOLEAN NOT NULL DEFAULT false;